@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CollisionError reports datatypes whose names map to the same BigQuery
+// table or view.
+type CollisionError struct {
+	Kind      string      // "table" or "view".
+	Name      string      // Qualified name (e.g., "raw_ndt.ndt7" or "mlab-oti.raw_ndt.ndt7").
+	Datatypes []*Datatype // Colliding datatypes.
+}
+
+func (e *CollisionError) Error() string {
+	ids := make([]string, 0, len(e.Datatypes))
+	for _, dt := range e.Datatypes {
+		ids = append(ids, dt.ID())
+	}
+	return fmt.Sprintf("%s %s is shared by datatypes %s", e.Kind, e.Name, strings.Join(ids, ", "))
+}
+
+// Projects returns the BigQuery projects of a datatype's table and view.
+type Projects func(dt *Datatype) (project, viewProject string)
+
+// CheckCollisions returns the datatypes whose BigQuery names do not collide
+// with any other datatype, along with a CollisionError for each table or view
+// shared by more than one of them. Loading colliding datatypes would overwrite
+// each other's partitions, so all datatypes involved in a collision are
+// excluded.
+//
+// Datatypes from different organizations sharing an experiment and datatype
+// name are expected to share a view, so views only collide for datatypes with
+// different experiment or datatype names.
+//
+// If projects is not nil, tables and views only collide within the same
+// BigQuery project. Otherwise, all datatypes are assumed to share the
+// projects.
+func CheckCollisions(datatypes []*Datatype, projects Projects) ([]*Datatype, error) {
+	tables := make(map[string][]*Datatype)
+	views := make(map[string][]*Datatype)
+	for _, dt := range datatypes {
+		var project, viewProject string
+		if projects != nil {
+			project, viewProject = projects(dt)
+		}
+		name := qualify(project, dt.Dataset()+"."+dt.Table())
+		tables[name] = append(tables[name], dt)
+		if dt.UpdateView {
+			name = qualify(viewProject, dt.ViewDataset()+"."+dt.ViewTable())
+			views[name] = append(views[name], dt)
+		}
+	}
+
+	collided := make(map[*Datatype]bool)
+	errs := make([]error, 0)
+	for _, name := range sortedKeys(tables) {
+		if dts := tables[name]; len(dts) > 1 {
+			errs = append(errs, &CollisionError{Kind: "table", Name: name, Datatypes: dts})
+			for _, dt := range dts {
+				collided[dt] = true
+			}
+		}
+	}
+	for _, name := range sortedKeys(views) {
+		dts := views[name]
+		if !sameSource(dts) {
+			errs = append(errs, &CollisionError{Kind: "view", Name: name, Datatypes: dts})
+			for _, dt := range dts {
+				collided[dt] = true
+			}
+		}
+	}
+
+	valid := make([]*Datatype, 0, len(datatypes))
+	for _, dt := range datatypes {
+		if !collided[dt] {
+			valid = append(valid, dt)
+		}
+	}
+	return valid, errors.Join(errs...)
+}
+
+// qualify prefixes name with the project, if any.
+func qualify(project, name string) string {
+	if project == "" {
+		return name
+	}
+	return project + "." + name
+}
+
+// sameSource returns whether all datatypes have the same experiment and
+// datatype name.
+func sameSource(dts []*Datatype) bool {
+	for _, dt := range dts[1:] {
+		if dt.Experiment != dts[0].Experiment || dt.Name != dts[0].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string][]*Datatype) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
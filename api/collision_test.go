@@ -0,0 +1,125 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckCollisions(t *testing.T) {
+	mlab := func(bucket, exp, name string) *Datatype {
+		return NewMlabDatatype(DatatypeOpts{Name: name, Experiment: exp, BucketName: bucket})
+	}
+	thirdParty := func(exp, name string) *Datatype {
+		dt := NewThirdPartyDatatype(DatatypeOpts{Name: name, Experiment: exp, BucketName: "bucket"}, "mlab-project")
+		dt.UpdateView = true
+		return dt
+	}
+	byOrg := func(org string) *Datatype {
+		n, err := NewTemplateNamer(NamingTemplates{
+			Dataset:     "{{.Organization}}_{{.Experiment}}",
+			Table:       "{{.Datatype}}",
+			ViewDataset: "{{.Experiment}}",
+			ViewTable:   "{{.Datatype}}",
+		}, NamingData{Datatype: "ndt7", Experiment: "ndt", Organization: org})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Datatype{
+			DatatypeOpts: DatatypeOpts{Name: "ndt7", Experiment: "ndt", Organization: org, BucketName: "bucket"},
+			Namer:        n,
+			UpdateView:   true,
+		}
+	}
+
+	ndt := mlab("archive", "ndt", "ndt7")
+	host := mlab("archive", "host", "nodeinfo1")
+	dashed := mlab("archive", "my-exp", "ndt7")
+	underscored := mlab("archive", "my_exp", "ndt7")
+	pusher := mlab("pusher", "ndt", "ndt7")
+	ab := thirdParty("a_b", "c")
+	a := thirdParty("a", "b_c")
+	org1, org2 := byOrg("org1"), byOrg("org2")
+
+	tests := []struct {
+		name      string
+		datatypes []*Datatype
+		projects  Projects
+		want      []*Datatype
+		wantNames []string
+	}{
+		{
+			name:      "no-collisions",
+			datatypes: []*Datatype{ndt, host},
+			want:      []*Datatype{ndt, host},
+		},
+		{
+			name:      "sanitized-table",
+			datatypes: []*Datatype{dashed, host, underscored},
+			want:      []*Datatype{host},
+			wantNames: []string{"raw_my_exp.ndt7"},
+		},
+		{
+			name:      "same-datatype-in-two-buckets",
+			datatypes: []*Datatype{ndt, pusher},
+			want:      []*Datatype{},
+			wantNames: []string{"raw_ndt.ndt7"},
+		},
+		{
+			name:      "same-datatype-in-two-projects",
+			datatypes: []*Datatype{ndt, pusher},
+			projects: func(dt *Datatype) (string, string) {
+				return "project-" + dt.BucketName, "view-project"
+			},
+			want: []*Datatype{ndt, pusher},
+		},
+		{
+			name:      "same-datatype-in-one-project",
+			datatypes: []*Datatype{ndt, pusher},
+			projects: func(dt *Datatype) (string, string) {
+				return "project", "view-project"
+			},
+			want:      []*Datatype{},
+			wantNames: []string{"project.raw_ndt.ndt7"},
+		},
+		{
+			name:      "view",
+			datatypes: []*Datatype{ab, a},
+			want:      []*Datatype{},
+			wantNames: []string{"project.a_b_c"},
+		},
+		{
+			name:      "shared-view",
+			datatypes: []*Datatype{org1, org2},
+			want:      []*Datatype{org1, org2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckCollisions(tt.datatypes, tt.projects)
+			if !cmp.Equal(ids(got), ids(tt.want)) {
+				t.Errorf("CheckCollisions() = %v, want %v", got, tt.want)
+			}
+			names := []string{}
+			if err != nil {
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					names = append(names, e.(*CollisionError).Name)
+				}
+			}
+			if len(tt.wantNames) == 0 {
+				tt.wantNames = []string{}
+			}
+			if !cmp.Equal(names, tt.wantNames) {
+				t.Errorf("CheckCollisions() collisions = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func ids(datatypes []*Datatype) []string {
+	s := []string{}
+	for _, dt := range datatypes {
+		s = append(s, dt.ID())
+	}
+	return s
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"strings"
 	"time"
 
 	"github.com/m-lab/go/storagex"
@@ -16,6 +17,7 @@ type DatatypeOpts struct {
 	Schema       []byte           // Contents of schema file in GCS.
 	UpdatedTime  time.Time        // Last time the schema was updated in GCS.
 	Bucket       *storagex.Bucket // GCS Bucket.
+	BucketName   string           // GCS Bucket name (e.g., "archive-mlab-sandbox").
 }
 
 // Namer provides the appropriate naming conventions for a Datatype.
@@ -37,6 +39,12 @@ type Datatype struct {
 	UpdateView bool
 }
 
+// ID returns a string identifying the datatype's source in GCS (e.g.,
+// "archive-mlab-sandbox/mlab/ndt/ndt7").
+func (dt *Datatype) ID() string {
+	return strings.Join([]string{dt.BucketName, dt.Organization, dt.Experiment, dt.Name}, "/")
+}
+
 // NewMlabDatatype returns a new Datatype with an MlabNamer.
 func NewMlabDatatype(opts DatatypeOpts) *Datatype {
 	return &Datatype{
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxNameLength is the maximum length of BigQuery dataset and table names.
+	maxNameLength = 1024
+)
+
+var (
+	// datasetPattern matches valid BigQuery dataset names.
+	datasetPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	// tablePattern matches valid BigQuery table names.
+	tablePattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}\p{Pc}\p{Pd}\p{Zs}]+$`)
+)
+
+// DatasetName normalizes a string to a valid BigQuery dataset name by
+// replacing every character other than letters, digits and underscores with
+// an underscore (e.g., "autoload_v2_my-org_ndt" becomes "autoload_v2_my_org_ndt").
+func DatasetName(s string) string {
+	return sanitize(s, func(r rune) bool {
+		return r < utf8.RuneSelf && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+}
+
+// TableName normalizes a string to a valid BigQuery table name by replacing
+// every unsupported character (e.g., "." or "/") with an underscore.
+func TableName(s string) string {
+	return sanitize(s, func(r rune) bool {
+		return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.Pc, unicode.Pd, unicode.Zs)
+	})
+}
+
+// sanitize replaces the runes not accepted by valid with underscores and
+// truncates the result to maxNameLength bytes.
+func sanitize(s string, valid func(rune) bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !valid(r) {
+			r = '_'
+		}
+		if b.Len()+utf8.RuneLen(r) > maxNameLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
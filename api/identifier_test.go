@@ -0,0 +1,78 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDatasetName(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "valid",
+			s:    "autoload_v2_mlab_ndt",
+			want: "autoload_v2_mlab_ndt",
+		},
+		{
+			name: "hyphen",
+			s:    "autoload_v2_my-org_ndt",
+			want: "autoload_v2_my_org_ndt",
+		},
+		{
+			name: "non-ascii",
+			s:    "exp.é/ü",
+			want: "exp____",
+		},
+		{
+			name: "too-long",
+			s:    strings.Repeat("a", maxNameLength+10),
+			want: strings.Repeat("a", maxNameLength),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DatasetName(tt.s); got != tt.want {
+				t.Errorf("DatasetName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableName(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "valid",
+			s:    "ndt7_raw",
+			want: "ndt7_raw",
+		},
+		{
+			name: "unicode-and-dash",
+			s:    "tcp-info é",
+			want: "tcp-info é",
+		},
+		{
+			name: "unsupported",
+			s:    "ndt7.raw/v1",
+			want: "ndt7_raw_v1",
+		},
+		{
+			name: "too-long-multibyte",
+			s:    strings.Repeat("é", maxNameLength),
+			want: strings.Repeat("é", maxNameLength/2),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TableName(tt.s); got != tt.want {
+				t.Errorf("TableName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
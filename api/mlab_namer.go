@@ -13,7 +13,8 @@ func NewMlabNamer(dt, exp string) *MlabNamer {
 	}
 }
 
-// MlabNamer provides the naming conventions for M-Lab datatypes.
+// MlabNamer provides the naming conventions for M-Lab datatypes. Names are
+// normalized to valid BigQuery identifiers.
 type MlabNamer struct {
 	Datatype   string // Datatype name.
 	Experiment string // Experiment name.
@@ -21,20 +22,20 @@ type MlabNamer struct {
 
 // Dataset name (e.g., "raw_ndt").
 func (m *MlabNamer) Dataset() string {
-	return rawPrefix + m.Experiment
+	return DatasetName(rawPrefix + m.Experiment)
 }
 
 // Table name (e.g., "ndt7").
 func (m *MlabNamer) Table() string {
-	return m.Datatype
+	return TableName(m.Datatype)
 }
 
 // ViewDataset name (e.g., "ndt_raw").
 func (m *MlabNamer) ViewDataset() string {
-	return m.Experiment + rawSuffix
+	return DatasetName(m.Experiment + rawSuffix)
 }
 
 // ViewTable name (e.g., "ndt7").
 func (m *MlabNamer) ViewTable() string {
-	return m.Datatype
+	return TableName(m.Datatype)
 }
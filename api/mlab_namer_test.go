@@ -27,6 +27,12 @@ func TestMlabNamer_Dataset(t *testing.T) {
 			experiment: "host",
 			want:       "raw_host",
 		},
+		{
+			name:       "sanitized",
+			datatype:   "ndt7",
+			experiment: "my-exp",
+			want:       "raw_my_exp",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -63,6 +69,12 @@ func TestMlabNamer_Table(t *testing.T) {
 			experiment: "host",
 			want:       "nodeinfo1",
 		},
+		{
+			name:       "sanitized",
+			datatype:   "ndt7.v2",
+			experiment: "ndt",
+			want:       "ndt7_v2",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NamingRule assigns naming templates to the datatypes of a bucket or of all
+// the buckets in a project.
+type NamingRule struct {
+	Bucket     string `json:"bucket,omitempty"`  // Bucket name. Takes precedence over Project.
+	Project    string `json:"project,omitempty"` // GCS project (e.g., "mlab-autojoin").
+	UpdateView bool   `json:"update_view"`       // Whether to update the views on schema changes.
+	NamingTemplates
+}
+
+// NamingRules is a list of naming rules. Bucket rules take precedence over
+// project rules.
+type NamingRules []NamingRule
+
+// LoadNamingRules reads a JSON file containing a list of NamingRules and
+// validates them.
+func LoadNamingRules(path string) (NamingRules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules NamingRules
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("invalid naming rules %s: %w", path, err)
+	}
+	return rules, rules.Validate()
+}
+
+// Validate checks that every rule selects a bucket or project and that its
+// templates produce valid names for a sample datatype.
+func (r NamingRules) Validate() error {
+	errs := make([]error, 0)
+	sample := NamingData{
+		Datatype:     "datatype",
+		Experiment:   "experiment",
+		Organization: "organization",
+		Version:      "v2",
+		Bucket:       "bucket",
+		Project:      "mlab-project",
+		SubProject:   "project",
+	}
+	for i, rule := range r {
+		if rule.Bucket == "" && rule.Project == "" {
+			errs = append(errs, fmt.Errorf("naming rule %d: bucket or project is required", i))
+			continue
+		}
+		if _, err := NewTemplateNamer(rule.NamingTemplates, sample); err != nil {
+			errs = append(errs, fmt.Errorf("naming rule %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the rule for the given bucket and project, or nil if there is
+// none.
+func (r NamingRules) Match(bucket, project string) *NamingRule {
+	var match *NamingRule
+	for i := range r {
+		switch {
+		case r[i].Bucket != "" && r[i].Bucket == bucket:
+			return &r[i]
+		case r[i].Bucket == "" && project != "" && r[i].Project == project && match == nil:
+			match = &r[i]
+		}
+	}
+	return match
+}
+
+// NewDatatype returns a new Datatype named according to the rule matching the
+// bucket and project. It returns a nil Datatype if no rule matches.
+func (r NamingRules) NewDatatype(opts DatatypeOpts, project string) (*Datatype, error) {
+	rule := r.Match(opts.BucketName, project)
+	if rule == nil {
+		return nil, nil
+	}
+	namer, err := NewTemplateNamer(rule.NamingTemplates, NamingData{
+		Datatype:     opts.Name,
+		Experiment:   opts.Experiment,
+		Organization: opts.Organization,
+		Version:      opts.Version,
+		Bucket:       opts.BucketName,
+		Project:      project,
+		SubProject:   strings.TrimPrefix(project, mlabPrefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Datatype{
+		DatatypeOpts: opts,
+		Namer:        namer,
+		UpdateView:   rule.UpdateView,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testTemplates = NamingTemplates{
+		Dataset:     "autoload_{{.Version}}_{{.Organization}}_{{.Experiment}}",
+		Table:       "{{.Datatype}}_raw",
+		ViewDataset: "{{.SubProject}}_{{.Version}}_{{.Experiment}}",
+		ViewTable:   "{{.Datatype}}_raw",
+	}
+)
+
+func TestLoadNamingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "success",
+			content: `[{"project": "mlab-newsub", "update_view": true, "dataset": "{{.SubProject}}_{{.Experiment}}",
+				"table": "{{.Datatype}}", "view_dataset": "{{.Experiment}}", "view_table": "{{.Datatype}}"}]`,
+			want: 1,
+		},
+		{
+			name:    "invalid-json",
+			content: `[{`,
+			wantErr: true,
+		},
+		{
+			name: "missing-selector",
+			content: `[{"dataset": "{{.Experiment}}", "table": "{{.Datatype}}",
+				"view_dataset": "{{.Experiment}}", "view_table": "{{.Datatype}}"}]`,
+			want:    1,
+			wantErr: true,
+		},
+		{
+			name: "invalid-template",
+			content: `[{"bucket": "b", "dataset": "{{.Unknown}}", "table": "{{.Datatype}}",
+				"view_dataset": "{{.Experiment}}", "view_table": "{{.Datatype}}"}]`,
+			want:    1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "naming.json")
+			if err := os.WriteFile(p, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadNamingRules(p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadNamingRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("LoadNamingRules() = %d rules, want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadNamingRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("LoadNamingRules() error = nil, want error for missing file")
+	}
+}
+
+func TestNamingRules_NewDatatype(t *testing.T) {
+	bucketRule := NamingRule{Bucket: "archive-special", NamingTemplates: NamingTemplates{
+		Dataset: "special", Table: "{{.Datatype}}", ViewDataset: "special_views", ViewTable: "{{.Datatype}}",
+	}}
+	rules := NamingRules{
+		{Project: "mlab-newsub", UpdateView: true, NamingTemplates: testTemplates},
+		bucketRule,
+		{Project: "mlab-broken", NamingTemplates: NamingTemplates{Dataset: "{{.Organization}}"}},
+	}
+	tests := []struct {
+		name        string
+		bucket      string
+		project     string
+		org         string
+		wantDataset string
+		wantView    string
+		wantErr     bool
+	}{
+		{
+			name:        "project",
+			bucket:      "archive-mlab-newsub",
+			project:     "mlab-newsub",
+			org:         "org",
+			wantDataset: "autoload_v2_org_ndt",
+			wantView:    "newsub_v2_ndt",
+		},
+		{
+			name:        "bucket",
+			bucket:      "archive-special",
+			project:     "mlab-newsub",
+			wantDataset: "special",
+			wantView:    "special_views",
+		},
+		{
+			name:    "no-match",
+			bucket:  "archive-mlab-sandbox",
+			project: "mlab-sandbox",
+		},
+		{
+			name:    "invalid-name",
+			bucket:  "archive-mlab-broken",
+			project: "mlab-broken",
+			org:     "my-org",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DatatypeOpts{Name: "ndt7", Experiment: "ndt", Organization: tt.org, Version: "v2", BucketName: tt.bucket}
+			dt, err := rules.NewDatatype(opts, tt.project)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NamingRules.NewDatatype() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantDataset == "" {
+				if dt != nil {
+					t.Errorf("NamingRules.NewDatatype() = %v, want nil", dt)
+				}
+				return
+			}
+			if dt.Dataset() != tt.wantDataset || dt.ViewDataset() != tt.wantView {
+				t.Errorf("NamingRules.NewDatatype() = %s, %s, want %s, %s", dt.Dataset(), dt.ViewDataset(), tt.wantDataset, tt.wantView)
+			}
+		})
+	}
+}
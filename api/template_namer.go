@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+)
+
+// NamingTemplates contains the text/template patterns used to derive the
+// BigQuery names of a datatype (e.g., "autoload_{{.Version}}_{{.Organization}}_{{.Experiment}}").
+// The templates are executed with a NamingData value.
+type NamingTemplates struct {
+	Dataset     string `json:"dataset"`
+	Table       string `json:"table"`
+	ViewDataset string `json:"view_dataset"`
+	ViewTable   string `json:"view_table"`
+}
+
+// NamingData contains the values available to the naming templates.
+type NamingData struct {
+	Datatype     string // Datatype name (e.g., "ndt7").
+	Experiment   string // Experiment name (e.g., "ndt").
+	Organization string // Organization name (e.g., "mlab").
+	Version      string // Version (e.g., "v2").
+	Bucket       string // GCS bucket name (e.g., "archive-mlab-autojoin").
+	Project      string // GCS project (e.g., "mlab-autojoin").
+	SubProject   string // GCS project without the "mlab-" prefix (e.g., "autojoin").
+}
+
+// TemplateNamer provides naming conventions defined by NamingTemplates.
+type TemplateNamer struct {
+	dataset     string
+	table       string
+	viewDataset string
+	viewTable   string
+}
+
+// NewTemplateNamer executes the templates with the given data and returns a
+// Namer for the resulting names, normalized to valid BigQuery identifiers. It
+// returns an error if any template fails or produces an empty name.
+func NewTemplateNamer(t NamingTemplates, data NamingData) (*TemplateNamer, error) {
+	n := &TemplateNamer{}
+	names := []struct {
+		field    string
+		text     string
+		pattern  *regexp.Regexp
+		sanitize func(string) string
+		dst      *string
+	}{
+		{"dataset", t.Dataset, datasetPattern, DatasetName, &n.dataset},
+		{"table", t.Table, tablePattern, TableName, &n.table},
+		{"view_dataset", t.ViewDataset, datasetPattern, DatasetName, &n.viewDataset},
+		{"view_table", t.ViewTable, tablePattern, TableName, &n.viewTable},
+	}
+	for _, name := range names {
+		tmpl, err := template.New(name.field).Option("missingkey=error").Parse(name.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name.field, err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name.field, err)
+		}
+		// Values derived from GCS paths may contain unsupported characters.
+		id := name.sanitize(b.String())
+		if !name.pattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid %s %q: not a valid BigQuery identifier", name.field, b.String())
+		}
+		*name.dst = id
+	}
+	return n, nil
+}
+
+// Dataset name.
+func (n *TemplateNamer) Dataset() string {
+	return n.dataset
+}
+
+// Table name.
+func (n *TemplateNamer) Table() string {
+	return n.table
+}
+
+// ViewDataset name.
+func (n *TemplateNamer) ViewDataset() string {
+	return n.viewDataset
+}
+
+// ViewTable name.
+func (n *TemplateNamer) ViewTable() string {
+	return n.viewTable
+}
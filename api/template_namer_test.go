@@ -0,0 +1,85 @@
+package api
+
+import "testing"
+
+func TestNewTemplateNamer(t *testing.T) {
+	data := NamingData{
+		Datatype:     "ndt7",
+		Experiment:   "ndt",
+		Organization: "mlab",
+		Version:      "v2",
+		SubProject:   "autojoin",
+	}
+	tests := []struct {
+		name      string
+		templates NamingTemplates
+		want      [4]string
+		wantErr   bool
+	}{
+		{
+			name: "success",
+			templates: NamingTemplates{
+				Dataset:     "autoload_{{.Version}}_{{.Organization}}_{{.Experiment}}",
+				Table:       "{{.Datatype}}_raw",
+				ViewDataset: "{{.SubProject}}_{{.Version}}_{{.Experiment}}",
+				ViewTable:   "{{.Datatype}}_raw",
+			},
+			want: [4]string{"autoload_v2_mlab_ndt", "ndt7_raw", "autojoin_v2_ndt", "ndt7_raw"},
+		},
+		{
+			name: "invalid-template",
+			templates: NamingTemplates{
+				Dataset:     "{{.Experiment",
+				Table:       "{{.Datatype}}",
+				ViewDataset: "{{.Experiment}}",
+				ViewTable:   "{{.Datatype}}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown-field",
+			templates: NamingTemplates{
+				Dataset:     "{{.Unknown}}",
+				Table:       "{{.Datatype}}",
+				ViewDataset: "{{.Experiment}}",
+				ViewTable:   "{{.Datatype}}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "sanitized",
+			templates: NamingTemplates{
+				Dataset:     "{{.Experiment}}-{{.Organization}}",
+				Table:       "{{.Datatype}}.raw",
+				ViewDataset: "{{.Experiment}}.{{.Version}}",
+				ViewTable:   "{{.Datatype}}/raw",
+			},
+			want: [4]string{"ndt_mlab", "ndt7_raw", "ndt_v2", "ndt7_raw"},
+		},
+		{
+			name: "empty-table",
+			templates: NamingTemplates{
+				Dataset:     "{{.Experiment}}",
+				Table:       "",
+				ViewDataset: "{{.Experiment}}",
+				ViewTable:   "{{.Datatype}}",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewTemplateNamer(tt.templates, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTemplateNamer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := [4]string{n.Dataset(), n.Table(), n.ViewDataset(), n.ViewTable()}
+			if got != tt.want {
+				t.Errorf("NewTemplateNamer() names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
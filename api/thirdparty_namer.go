@@ -16,7 +16,7 @@ func NewThirdPartyNamer(dt, exp, project string) *ThirdPartyNamer {
 }
 
 // ThirdPartyNamer provides the naming conventions for third-party
-// datatypes.
+// datatypes. Names are normalized to valid BigQuery identifiers.
 type ThirdPartyNamer struct {
 	Datatype   string // Datatype name.
 	Experiment string // Experiment name.
@@ -25,20 +25,20 @@ type ThirdPartyNamer struct {
 
 // Dataset name (e.g., "experiment").
 func (tp *ThirdPartyNamer) Dataset() string {
-	return tp.Experiment
+	return DatasetName(tp.Experiment)
 }
 
 // Table name (e.g., "datatype").
 func (tp *ThirdPartyNamer) Table() string {
-	return tp.Datatype
+	return TableName(tp.Datatype)
 }
 
 // ViewDataset name (e.g., "project").
 func (tp *ThirdPartyNamer) ViewDataset() string {
-	return tp.Project
+	return DatasetName(tp.Project)
 }
 
 // ViewTable name (e.g., "experiment_datatype").
 func (tp *ThirdPartyNamer) ViewTable() string {
-	return tp.Experiment + "_" + tp.Datatype
+	return TableName(tp.Experiment + "_" + tp.Datatype)
 }
@@ -90,6 +90,13 @@ func TestThirdPartyNamer_ViewDataset(t *testing.T) {
 			project:    "mlab-cloudflare",
 			want:       "cloudflare",
 		},
+		{
+			name:       "sanitized",
+			datatype:   "speed1",
+			experiment: "speedtest",
+			project:    "mlab-my-org",
+			want:       "my_org",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -17,7 +17,8 @@ func NewNamer(opts api.DatatypeOpts, sp string) *Namer {
 	}
 }
 
-// Namer provides the naming conventions for a datatype.
+// Namer provides the naming conventions for a datatype. Names are normalized
+// to valid BigQuery identifiers.
 type Namer struct {
 	Datatype     string // Datatype name (e.g., "ndt7").
 	Experiment   string // Experiment name (e.g., "ndt").
@@ -28,17 +29,17 @@ type Namer struct {
 
 // Dataset name (e.g., "autoload_v2_mlab_ndt").
 func (n *Namer) Dataset() string {
-	return fmt.Sprintf("autoload_%s_%s_%s", n.Version, n.Organization, n.Experiment)
+	return api.DatasetName(fmt.Sprintf("autoload_%s_%s_%s", n.Version, n.Organization, n.Experiment))
 }
 
 // Table name (e.g., "ndt7_raw").
 func (n *Namer) Table() string {
-	return n.Datatype + "_raw"
+	return api.TableName(n.Datatype + "_raw")
 }
 
 // ViewDataset name (e.g., "mlab_v2_ndt").
 func (n *Namer) ViewDataset() string {
-	return fmt.Sprintf("%s_%s_%s", n.SubProject, n.Version, n.Experiment)
+	return api.DatasetName(fmt.Sprintf("%s_%s_%s", n.SubProject, n.Version, n.Experiment))
 }
 
 // ViewTable name (e.g., "ndt7_raw").
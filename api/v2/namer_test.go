@@ -85,6 +85,12 @@ func TestNamer_Dataset(t *testing.T) {
 			sp:   "thirdparty",
 			want: "autoload_v2_thirdpartyorg_thirdpartyexp",
 		},
+		{
+			name: "sanitized",
+			opts: api.DatatypeOpts{Name: "ndt7", Experiment: "ndt", Organization: "my-org", Version: "v2"},
+			sp:   "autojoin",
+			want: "autoload_v2_my_org_ndt",
+		},
 	}
 
 	for _, tt := range tests {
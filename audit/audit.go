@@ -0,0 +1,119 @@
+// Package audit keeps an append-only record of the mutations the autoloader
+// makes to BigQuery (e.g., creating tables, changing schemas or truncating
+// partitions), along with the request that triggered them.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/metrics"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreateDataset = "create-dataset"
+	ActionCreateTable   = "create-table"
+	ActionUpdateSchema  = "update-schema"
+	// ActionLoad replaces the contents of a partition (WRITE_TRUNCATE).
+	ActionLoad = "load"
+	// ActionAppend adds rows to a partition (WRITE_APPEND).
+	ActionAppend = "append"
+	// ActionMerge upserts rows into a partition or table (MERGE).
+	ActionMerge = "merge"
+	// ActionReplace replaces the contents of an unpartitioned table.
+	ActionReplace = "replace"
+)
+
+// Record describes a single mutation.
+type Record struct {
+	Time   time.Time `json:"time" bigquery:"time"`
+	Action string    `json:"action" bigquery:"action"`
+	Status string    `json:"status" bigquery:"status"` // "OK" or "error".
+	Error  string    `json:"error,omitempty" bigquery:"error"`
+
+	// Triggering request.
+	RunID   string `json:"run_id,omitempty" bigquery:"run_id"`
+	Caller  string `json:"caller,omitempty" bigquery:"caller"`
+	Request string `json:"request,omitempty" bigquery:"request"`
+
+	// Source datatype.
+	Experiment   string `json:"experiment" bigquery:"experiment"`
+	Datatype     string `json:"datatype" bigquery:"datatype"`
+	Organization string `json:"organization,omitempty" bigquery:"organization"`
+	Bucket       string `json:"bucket" bigquery:"bucket"`
+
+	// Mutated resources.
+	Dataset   string `json:"dataset" bigquery:"dataset"`
+	Table     string `json:"table,omitempty" bigquery:"table"`
+	Partition string `json:"partition,omitempty" bigquery:"partition"`
+	// View is the view whose schema is updated along with the table, if it
+	// exists.
+	View       string   `json:"view,omitempty" bigquery:"view"`
+	OldSchema  string   `json:"old_schema,omitempty" bigquery:"old_schema"`
+	NewSchema  string   `json:"new_schema,omitempty" bigquery:"new_schema"`
+	SourceURIs []string `json:"source_uris,omitempty" bigquery:"source_uris"`
+	JobID      string   `json:"job_id,omitempty" bigquery:"job_id"`
+}
+
+// Sink stores audit records.
+type Sink interface {
+	Write(ctx context.Context, r *Record) error
+}
+
+// Multi is a Sink writing records to every sink in the list.
+type Multi []Sink
+
+// Write writes the record to every sink, returning the first error.
+func (m Multi) Write(ctx context.Context, r *Record) error {
+	var first error
+	for _, s := range m {
+		if err := s.Write(ctx, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Trigger identifies the request causing a set of mutations.
+type Trigger struct {
+	RunID   string
+	Caller  string
+	Request string // Method and URI of the request.
+}
+
+type contextKey struct{}
+
+// WithTrigger returns a copy of the context carrying the trigger.
+func WithTrigger(ctx context.Context, t Trigger) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// TriggerFromContext returns the trigger carried by the context, if any.
+func TriggerFromContext(ctx context.Context) Trigger {
+	t, _ := ctx.Value(contextKey{}).(Trigger)
+	return t
+}
+
+// Write completes the record with the current time, the context's trigger
+// and the outcome of the mutation, then writes it to the sink. Write failures
+// are logged and counted, but do not fail the mutation. A nil sink discards
+// the record.
+func Write(ctx context.Context, s Sink, r *Record, err error) {
+	if s == nil {
+		return
+	}
+	r.Time = time.Now().UTC()
+	t := TriggerFromContext(ctx)
+	r.RunID, r.Caller, r.Request = t.RunID, t.Caller, t.Request
+	r.Status = "OK"
+	if err != nil {
+		r.Status, r.Error = "error", err.Error()
+	}
+	if err := s.Write(ctx, r); err != nil {
+		logging.FromContext(ctx).Error("failed to write audit record",
+			"action", r.Action, logging.ErrorKey, err)
+		metrics.AuditWriteErrorsTotal.WithLabelValues(r.Action, r.Organization, r.Bucket).Inc()
+	}
+}
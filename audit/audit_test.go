@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-lab/autoloader/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type memSink struct {
+	records []*Record
+	err     error
+}
+
+func (s *memSink) Write(ctx context.Context, r *Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+		wantError  string
+	}{
+		{name: "ok", wantStatus: "OK"},
+		{name: "error", err: errors.New("failed"), wantStatus: "error", wantError: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &memSink{}
+			ctx := WithTrigger(context.Background(), Trigger{RunID: "run", Caller: "caller", Request: "POST /v2/load"})
+			Write(ctx, s, &Record{Action: ActionLoad}, tt.err)
+
+			if len(s.records) != 1 {
+				t.Fatalf("Write() records = %d, want 1", len(s.records))
+			}
+			r := s.records[0]
+			if r.Time.IsZero() || r.RunID != "run" || r.Caller != "caller" || r.Request != "POST /v2/load" {
+				t.Errorf("Write() record = %+v, want time and trigger", r)
+			}
+			if r.Status != tt.wantStatus || r.Error != tt.wantError {
+				t.Errorf("Write() status = %q, error = %q, want %q, %q", r.Status, r.Error, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	// A nil sink discards the record.
+	Write(context.Background(), nil, &Record{Action: ActionLoad}, nil)
+
+	l := []string{ActionCreateTable, "org", "bucket"}
+	before := testutil.ToFloat64(metrics.AuditWriteErrorsTotal.WithLabelValues(l...))
+	Write(context.Background(), &memSink{err: errors.New("unavailable")},
+		&Record{Action: ActionCreateTable, Organization: "org", Bucket: "bucket"}, nil)
+	if got := testutil.ToFloat64(metrics.AuditWriteErrorsTotal.WithLabelValues(l...)) - before; got != 1 {
+		t.Errorf("Write() AuditWriteErrorsTotal = %v, want 1", got)
+	}
+}
+
+func TestMulti_Write(t *testing.T) {
+	a, b := &memSink{err: errors.New("a")}, &memSink{}
+	err := Multi{a, b}.Write(context.Background(), &Record{})
+	if err == nil || err.Error() != "a" {
+		t.Errorf("Multi.Write() error = %v, want a", err)
+	}
+	if len(b.records) != 1 {
+		t.Errorf("Multi.Write() records = %d, want 1", len(b.records))
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+)
+
+// FileSink appends records to a local file, one JSON object per line.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileSink opens the file at path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Write appends the record to the file and flushes it to stable storage.
+func (s *FileSink) Write(ctx context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// BigQuerySink streams records to a BigQuery table.
+type BigQuerySink struct {
+	table bqiface.Table
+}
+
+// NewBigQuerySink returns a sink writing to the table.
+func NewBigQuerySink(t bqiface.Table) *BigQuerySink {
+	return &BigQuerySink{table: t}
+}
+
+// CreateTable creates the sink's table, partitioned by the record time, if it
+// does not exist.
+func (s *BigQuerySink) CreateTable(ctx context.Context) error {
+	if _, err := s.table.Metadata(ctx); err == nil {
+		return nil
+	}
+	schema, err := bigquery.InferSchema(Record{})
+	if err != nil {
+		return err
+	}
+	return s.table.Create(ctx, &bigquery.TableMetadata{
+		Name:   s.table.TableID(),
+		Schema: schema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Type:  bigquery.DayPartitioningType,
+			Field: "time",
+		},
+	})
+}
+
+// Write inserts the record into the table.
+func (s *BigQuerySink) Write(ctx context.Context, r *Record) error {
+	return s.table.Uploader().Put(ctx, r)
+}
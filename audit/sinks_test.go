@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	records := []*Record{
+		{Action: ActionCreateTable, Dataset: "ds", Table: "t", NewSchema: `[{"name":"a"}]`},
+		{Action: ActionLoad, Dataset: "ds", Table: "t", Partition: "20230601", SourceURIs: []string{"gs://b/p/*"}, JobID: "job"},
+	}
+
+	// Records are appended across reopens.
+	for _, r := range records {
+		s, err := NewFileSink(path)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+		if err := s.Write(context.Background(), r); err != nil {
+			t.Fatalf("FileSink.Write() error = %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("FileSink.Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := []*Record{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		got = append(got, r)
+	}
+	if diff := cmp.Diff(got, records); diff != "" {
+		t.Errorf("FileSink records diff (-got +want):\n%s", diff)
+	}
+
+	if _, err := NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.jsonl")); err == nil {
+		t.Errorf("NewFileSink() error = nil, want error")
+	}
+}
+
+type fakeUploader struct {
+	bqiface.Uploader
+	rows []any
+}
+
+func (u *fakeUploader) Put(ctx context.Context, src interface{}) error {
+	u.rows = append(u.rows, src)
+	return nil
+}
+
+type fakeTable struct {
+	bqiface.Table
+	md       *bigquery.TableMetadata
+	created  *bigquery.TableMetadata
+	uploader *fakeUploader
+}
+
+func (t *fakeTable) Metadata(ctx context.Context) (*bigquery.TableMetadata, error) {
+	if t.md == nil {
+		return nil, errors.New("not found")
+	}
+	return t.md, nil
+}
+
+func (t *fakeTable) Create(ctx context.Context, md *bigquery.TableMetadata) error {
+	t.created = md
+	return nil
+}
+
+func (t *fakeTable) TableID() string {
+	return "audit"
+}
+
+func (t *fakeTable) Uploader() bqiface.Uploader {
+	return t.uploader
+}
+
+func TestBigQuerySink(t *testing.T) {
+	table := &fakeTable{uploader: &fakeUploader{}}
+	s := NewBigQuerySink(table)
+	ctx := context.Background()
+
+	if err := s.CreateTable(ctx); err != nil {
+		t.Fatalf("BigQuerySink.CreateTable() error = %v", err)
+	}
+	if table.created == nil || table.created.TimePartitioning.Field != "time" {
+		t.Fatalf("BigQuerySink.CreateTable() created = %v, want time-partitioned table", table.created)
+	}
+	if _, err := table.created.Schema.ToJSONFields(); err != nil {
+		t.Errorf("BigQuerySink.CreateTable() schema error = %v", err)
+	}
+
+	// Existing tables are kept.
+	table.md, table.created = &bigquery.TableMetadata{}, nil
+	if err := s.CreateTable(ctx); err != nil || table.created != nil {
+		t.Errorf("BigQuerySink.CreateTable() error = %v, created = %v", err, table.created)
+	}
+
+	r := &Record{Action: ActionLoad}
+	if err := s.Write(ctx, r); err != nil {
+		t.Fatalf("BigQuerySink.Write() error = %v", err)
+	}
+	if len(table.uploader.rows) != 1 || table.uploader.rows[0] != r {
+		t.Errorf("BigQuerySink.Write() rows = %v, want %v", table.uploader.rows, r)
+	}
+}
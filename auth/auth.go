@@ -0,0 +1,129 @@
+// Package auth authenticates and authorizes the callers of the autoloader's
+// HTTP endpoints. Callers present a bearer token, which is either a static
+// token from a file or a JWT signed by a trusted issuer, and are granted a set
+// of scopes (e.g., "load:daily").
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/m-lab/autoloader/logging"
+)
+
+const (
+	// CallerKey is the log key identifying the caller of a request.
+	CallerKey = "caller"
+)
+
+var (
+	// ErrNoCredentials is returned when a request has no bearer token.
+	ErrNoCredentials = errors.New("missing bearer token")
+	// ErrInvalidCredentials is returned when no authenticator accepts a token.
+	ErrInvalidCredentials = errors.New("invalid bearer token")
+)
+
+// Caller is an authenticated caller.
+type Caller struct {
+	ID     string   // Caller identity (e.g., a token name or JWT email).
+	Scopes []string // Granted scopes (e.g., "load:daily", "load:*" or "*").
+}
+
+// HasScope returns whether the caller was granted the scope, directly or
+// through a wildcard ("*" or "<prefix>:*").
+func (c *Caller) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == "*" || s == scope {
+			return true
+		}
+		if p, ok := strings.CutSuffix(s, "*"); ok && strings.HasSuffix(p, ":") && strings.HasPrefix(scope, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the caller presenting a bearer token. It returns
+// ErrInvalidCredentials if it does not accept the token.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Caller, error)
+}
+
+type contextKey struct{}
+
+// WithCaller returns a copy of the context carrying the caller.
+func WithCaller(ctx context.Context, c *Caller) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the caller carried by the context, or nil if there is
+// none.
+func FromContext(ctx context.Context) *Caller {
+	c, _ := ctx.Value(contextKey{}).(*Caller)
+	return c
+}
+
+// Middleware requires the requests to be made by callers with a given scope.
+// Authenticators are tried in order until one accepts the token. A nil
+// Middleware, or one without authenticators, allows all requests.
+type Middleware struct {
+	Authenticators []Authenticator
+}
+
+// Require returns a handler that calls next only if the request's caller has
+// the scope returned by the scope function. Unauthenticated requests get a 401
+// response and unauthorized ones a 403. Every request is audit-logged with the
+// caller's identity.
+func (m *Middleware) Require(scope func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	if m == nil || len(m.Authenticators) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		want := scope(r)
+		logger := logging.FromContext(ctx).With("audit", true, "method", r.Method,
+			logging.PathKey, r.URL.Path, "query", r.URL.RawQuery, "scope", want)
+
+		caller, err := m.authenticate(ctx, r)
+		if err != nil {
+			logger.Warn("denied unauthenticated request", logging.ErrorKey, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		logger = logger.With(CallerKey, caller.ID)
+		if !caller.HasScope(want) {
+			logger.Warn("denied unauthorized request")
+			http.Error(w, "caller "+caller.ID+" lacks scope "+want, http.StatusForbidden)
+			return
+		}
+
+		logger.Info("authorized request")
+		ctx = logging.With(WithCaller(ctx, caller), CallerKey, caller.ID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Scope returns a scope function always returning s.
+func Scope(s string) func(*http.Request) string {
+	return func(*http.Request) string { return s }
+}
+
+func (m *Middleware) authenticate(ctx context.Context, r *http.Request) (*Caller, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+	for _, a := range m.Authenticators {
+		c, err := a.Authenticate(ctx, token)
+		if err == nil {
+			return c, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			logging.FromContext(ctx).Debug("authenticator rejected token", logging.ErrorKey, err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaller_HasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{name: "exact", scopes: []string{"load:daily"}, scope: "load:daily", want: true},
+		{name: "missing", scopes: []string{"load:daily"}, scope: "load:everything", want: false},
+		{name: "prefix-wildcard", scopes: []string{"load:*"}, scope: "load:everything", want: true},
+		{name: "prefix-wildcard-other", scopes: []string{"load:*"}, scope: "admin", want: false},
+		{name: "wildcard", scopes: []string{"*"}, scope: "admin", want: true},
+		{name: "partial-prefix", scopes: []string{"lo*"}, scope: "load:daily", want: false},
+		{name: "none", scope: "read", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Caller{ID: "c", Scopes: tt.scopes}
+			if got := c.HasScope(tt.scope); got != tt.want {
+				t.Errorf("Caller.HasScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Require(t *testing.T) {
+	tokens, err := NewTokens([]TokenEntry{
+		{Caller: "scheduler", Token: "daily-token", Scopes: []string{"load:daily", "read"}},
+		{Caller: "operator", Token: "admin-token", Scopes: []string{"*"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokens() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		m          *Middleware
+		header     string
+		scope      string
+		wantStatus int
+		wantCaller string
+	}{
+		{
+			name:       "allowed",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			header:     "Bearer daily-token",
+			scope:      "load:daily",
+			wantStatus: http.StatusOK,
+			wantCaller: "scheduler",
+		},
+		{
+			name:       "admin",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			header:     "Bearer admin-token",
+			scope:      "load:everything",
+			wantStatus: http.StatusOK,
+			wantCaller: "operator",
+		},
+		{
+			name:       "forbidden",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			header:     "Bearer daily-token",
+			scope:      "load:everything",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing-token",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			scope:      "read",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid-token",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			header:     "Bearer wrong",
+			scope:      "read",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not-bearer",
+			m:          &Middleware{Authenticators: []Authenticator{tokens}},
+			header:     "Basic daily-token",
+			scope:      "read",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "chain",
+			m:          &Middleware{Authenticators: []Authenticator{&Tokens{}, tokens}},
+			header:     "Bearer daily-token",
+			scope:      "read",
+			wantStatus: http.StatusOK,
+			wantCaller: "scheduler",
+		},
+		{
+			name:       "disabled",
+			scope:      "admin",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var caller string
+			next := func(w http.ResponseWriter, r *http.Request) {
+				if c := FromContext(r.Context()); c != nil {
+					caller = c.ID
+				}
+			}
+			h := tt.m.Require(Scope(tt.scope), next)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/load", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rw := httptest.NewRecorder()
+			h(rw, req)
+
+			if rw.Code != tt.wantStatus {
+				t.Errorf("Middleware.Require() status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+			if caller != tt.wantCaller {
+				t.Errorf("Middleware.Require() caller = %q, want %q", caller, tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if c := FromContext(context.Background()); c != nil {
+		t.Errorf("FromContext() = %v, want nil", c)
+	}
+	want := &Caller{ID: "c"}
+	if got := FromContext(WithCaller(context.Background(), want)); got != want {
+		t.Errorf("FromContext() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownKey is returned when a JWT is signed by a key not in the key set.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrInvalidSignature is returned when a JWT's signature does not verify.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInvalidClaims is returned when a JWT's claims are not accepted.
+	ErrInvalidClaims = errors.New("invalid claims")
+)
+
+// KeySet provides the public keys verifying JWT signatures.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWKS is a static JSON Web Key Set.
+type JWKS struct {
+	keys map[string]crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads a JSON Web Key Set from a file.
+func LoadJWKS(path string) (*JWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses a JSON Web Key Set. Only RSA and P-256 EC signing keys are
+// kept; other keys are ignored.
+func ParseJWKS(b []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	ks := &JWKS{keys: make(map[string]crypto.PublicKey)}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k.Kid, err)
+		}
+		if pub != nil {
+			ks.keys[k.Kid] = pub
+		}
+	}
+	return ks, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Key returns the key with the given ID. If the ID is empty and the set has a
+// single key, that key is returned.
+func (ks *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if k, ok := ks.keys[kid]; ok {
+		return k, nil
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// RemoteJWKS is a JSON Web Key Set fetched from a URL. The keys are fetched on
+// first use and again when a token names an unknown key, at most once per
+// MinRefresh interval.
+type RemoteJWKS struct {
+	URL        string
+	Client     *http.Client
+	MinRefresh time.Duration
+
+	mu      sync.Mutex
+	keys    *JWKS
+	fetched time.Time
+}
+
+// NewRemoteJWKS returns a key set fetched from the URL.
+func NewRemoteJWKS(url string) *RemoteJWKS {
+	return &RemoteJWKS{URL: url, Client: http.DefaultClient, MinRefresh: time.Minute}
+}
+
+// Key returns the key with the given ID, refreshing the keys if it is unknown.
+func (r *RemoteJWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys != nil {
+		k, err := r.keys.Key(ctx, kid)
+		if err == nil || time.Since(r.fetched) < r.MinRefresh {
+			return k, err
+		}
+	}
+	keys, err := r.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.keys, r.fetched = keys, time.Now()
+	return r.keys.Key(ctx, kid)
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: %s", r.URL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// JWT authenticates callers presenting a JWT (e.g., an OIDC identity token)
+// signed with RS256 or ES256 by a trusted issuer. The caller is identified by
+// the token's "email" claim or, if absent, its "sub" claim.
+type JWT struct {
+	Issuer   string // Required "iss" claim.
+	Audience string // Required "aud" claim. Every JWT is rejected if empty.
+	Keys     KeySet
+	// Callers maps caller identities to their scopes. Callers not listed are
+	// authenticated, but granted no scope. A token's "scope" claim can only
+	// narrow the scopes of its caller, never extend them.
+	Callers map[string][]string
+	// Leeway is the clock skew tolerated when checking "exp" and "nbf".
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Iss   string   `json:"iss"`
+	Sub   string   `json:"sub"`
+	Email string   `json:"email"`
+	Aud   audience `json:"aud"`
+	Exp   *int64   `json:"exp"`
+	Nbf   *int64   `json:"nbf"`
+	Scope string   `json:"scope"`
+}
+
+// audience is a JWT "aud" claim, which is either a string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = l
+	return nil
+}
+
+// Authenticate verifies the token and returns its caller. Tokens that are not
+// JWTs are rejected with ErrInvalidCredentials.
+func (j *JWT) Authenticate(ctx context.Context, token string) (*Caller, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	key, err := j.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verify(h.Alg, key, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	var c jwtClaims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClaims, err)
+	}
+	if err := j.check(&c); err != nil {
+		return nil, err
+	}
+
+	id := c.Email
+	if id == "" {
+		id = c.Sub
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%w: missing email and sub", ErrInvalidClaims)
+	}
+	listed := &Caller{ID: id, Scopes: append([]string{}, j.Callers[id]...)}
+	claimed := strings.Fields(c.Scope)
+	if len(claimed) == 0 {
+		return listed, nil
+	}
+	scopes := make([]string, 0, len(claimed))
+	for _, s := range claimed {
+		if listed.HasScope(s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return &Caller{ID: id, Scopes: scopes}, nil
+}
+
+// check validates the issuer, audience and validity period of the claims.
+func (j *JWT) check(c *jwtClaims) error {
+	if c.Iss != j.Issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, c.Iss)
+	}
+	if j.Audience == "" {
+		return fmt.Errorf("%w: no audience configured", ErrInvalidClaims)
+	}
+	if !contains(c.Aud, j.Audience) {
+		return fmt.Errorf("%w: unexpected audience %v", ErrInvalidClaims, c.Aud)
+	}
+	now := time.Now()
+	if j.now != nil {
+		now = j.now()
+	}
+	if c.Exp == nil || now.After(time.Unix(*c.Exp, 0).Add(j.Leeway)) {
+		return fmt.Errorf("%w: expired or missing exp", ErrInvalidClaims)
+	}
+	if c.Nbf != nil && now.Add(j.Leeway).Before(time.Unix(*c.Nbf, 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidClaims)
+	}
+	return nil
+}
+
+func verify(alg string, key crypto.PublicKey, digest, sig []byte) error {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, alg)
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadCallers reads the scopes of JWT callers from a JSON file mapping caller
+// identities to their scopes.
+func LoadCallers(path string) (map[string][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	callers := make(map[string][]string)
+	if err := json.Unmarshal(b, &callers); err != nil {
+		return nil, fmt.Errorf("failed to parse callers file %s: %w", path, err)
+	}
+	return callers, nil
+}
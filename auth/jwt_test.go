@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	rsaKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _    = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS writes a JWKS with the test keys to a temporary file.
+func writeJWKS(t *testing.T) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa", "use": "sig",
+			"n": b64(rsaKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign returns a JWT with the given header and claims signed by key.
+func sign(t *testing.T, header, claims map[string]any, key crypto.Signer) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = s
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(sig)
+}
+
+func TestJWT_Authenticate(t *testing.T) {
+	keys, err := LoadJWKS(writeJWKS(t))
+	if err != nil {
+		t.Fatalf("LoadJWKS() error = %v", err)
+	}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   "https://accounts.google.com",
+			"aud":   "https://autoloader.example.com",
+			"email": "scheduler@mlab-sandbox.iam.gserviceaccount.com",
+			"sub":   "1234",
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	rs256 := map[string]any{"alg": "RS256", "kid": "rsa"}
+
+	tests := []struct {
+		name       string
+		token      string
+		noAudience bool
+		want       *Caller
+		wantErr    error
+	}{
+		{
+			name:  "rs256",
+			token: sign(t, rs256, claims(nil), rsaKey),
+			want: &Caller{
+				ID:     "scheduler@mlab-sandbox.iam.gserviceaccount.com",
+				Scopes: []string{"load:daily", "read"},
+			},
+		},
+		{
+			name:  "es256",
+			token: sign(t, map[string]any{"alg": "ES256", "kid": "ec"}, claims(nil), ecKey),
+			want: &Caller{
+				ID:     "scheduler@mlab-sandbox.iam.gserviceaccount.com",
+				Scopes: []string{"load:daily", "read"},
+			},
+		},
+		{
+			name:  "sub-and-scope-claim",
+			token: sign(t, rs256, claims(map[string]any{"email": nil, "scope": "read admin", "aud": []string{"other", "https://autoloader.example.com"}}), rsaKey),
+			want:  &Caller{ID: "1234", Scopes: []string{}},
+		},
+		{
+			name:  "scope-claim-narrows",
+			token: sign(t, rs256, claims(map[string]any{"scope": "read admin"}), rsaKey),
+			want: &Caller{
+				ID:     "scheduler@mlab-sandbox.iam.gserviceaccount.com",
+				Scopes: []string{"read"},
+			},
+		},
+		{
+			name:    "wrong-key",
+			token:   sign(t, rs256, claims(nil), otherKey),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "unknown-kid",
+			token:   sign(t, map[string]any{"alg": "RS256", "kid": "unknown"}, claims(nil), rsaKey),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "alg-mismatch",
+			token:   sign(t, map[string]any{"alg": "ES256", "kid": "rsa"}, claims(nil), rsaKey),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "alg-none",
+			token:   sign(t, map[string]any{"alg": "none", "kid": "rsa"}, claims(nil), rsaKey),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "hmac-key-ignored",
+			token:   sign(t, map[string]any{"alg": "HS256", "kid": "hmac"}, claims(nil), rsaKey),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "wrong-issuer",
+			token:   sign(t, rs256, claims(map[string]any{"iss": "https://evil.example.com"}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:    "wrong-audience",
+			token:   sign(t, rs256, claims(map[string]any{"aud": "other"}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:       "no-audience-configured",
+			token:      sign(t, rs256, claims(nil), rsaKey),
+			noAudience: true,
+			wantErr:    ErrInvalidClaims,
+		},
+		{
+			name:    "expired",
+			token:   sign(t, rs256, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:  "expired-within-leeway",
+			token: sign(t, rs256, claims(map[string]any{"exp": now.Add(-time.Second).Unix(), "email": nil}), rsaKey),
+			want:  &Caller{ID: "1234", Scopes: []string{}},
+		},
+		{
+			name:    "missing-exp",
+			token:   sign(t, rs256, claims(map[string]any{"exp": nil}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:    "not-yet-valid",
+			token:   sign(t, rs256, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:    "missing-identity",
+			token:   sign(t, rs256, claims(map[string]any{"email": nil, "sub": nil}), rsaKey),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:    "not-jwt",
+			token:   "opaque-token",
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &JWT{
+				Issuer:   "https://accounts.google.com",
+				Audience: "https://autoloader.example.com",
+				Keys:     keys,
+				Callers: map[string][]string{
+					"scheduler@mlab-sandbox.iam.gserviceaccount.com": {"load:daily", "read"},
+				},
+				Leeway: time.Minute,
+				now:    func() time.Time { return now },
+			}
+			if tt.noAudience {
+				j.Audience = ""
+			}
+			got, err := j.Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("JWT.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("JWT.Authenticate() diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJWT_RequireUnlistedCaller(t *testing.T) {
+	keys, err := LoadJWKS(writeJWKS(t))
+	if err != nil {
+		t.Fatalf("LoadJWKS() error = %v", err)
+	}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	j := &JWT{
+		Issuer:   "https://accounts.google.com",
+		Audience: "https://autoloader.example.com",
+		Keys:     keys,
+		Callers:  map[string][]string{"admin@example.com": {"admin"}},
+		now:      func() time.Time { return now },
+	}
+	token := sign(t, map[string]any{"alg": "RS256", "kid": "rsa"}, map[string]any{
+		"iss":   "https://accounts.google.com",
+		"aud":   "https://autoloader.example.com",
+		"email": "unlisted@example.com",
+		"scope": "admin",
+		"exp":   now.Add(time.Hour).Unix(),
+	}, rsaKey)
+
+	m := &Middleware{Authenticators: []Authenticator{j}}
+	h := m.Require(Scope("admin"), func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Middleware.Require() called the handler of an unlisted caller")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Middleware.Require() status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestRemoteJWKS_Key(t *testing.T) {
+	b, err := os.ReadFile(writeJWKS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	r := NewRemoteJWKS(srv.URL)
+	ctx := context.Background()
+	if _, err := r.Key(ctx, "rsa"); err != nil {
+		t.Errorf("RemoteJWKS.Key() error = %v", err)
+	}
+	if _, err := r.Key(ctx, "ec"); err != nil {
+		t.Errorf("RemoteJWKS.Key() error = %v", err)
+	}
+	if _, err := r.Key(ctx, "unknown"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("RemoteJWKS.Key() error = %v, want %v", err, ErrUnknownKey)
+	}
+	if fetches != 1 {
+		t.Errorf("RemoteJWKS.Key() fetches = %d, want 1", fetches)
+	}
+
+	// Unknown keys trigger a refresh once the minimum interval elapsed.
+	r.MinRefresh = 0
+	if _, err := r.Key(ctx, "unknown"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("RemoteJWKS.Key() error = %v, want %v", err, ErrUnknownKey)
+	}
+	if fetches != 2 {
+		t.Errorf("RemoteJWKS.Key() fetches = %d, want 2", fetches)
+	}
+}
+
+func TestLoadCallers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "callers.json")
+	if err := os.WriteFile(path, []byte(`{"a@example.com": ["read"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadCallers(path)
+	if err != nil {
+		t.Fatalf("LoadCallers() error = %v", err)
+	}
+	if diff := cmp.Diff(got, map[string][]string{"a@example.com": {"read"}}); diff != "" {
+		t.Errorf("LoadCallers() diff (-got +want):\n%s", diff)
+	}
+	if err := os.WriteFile(path, []byte(`["read"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCallers(path); err == nil {
+		t.Errorf("LoadCallers() error = nil, want error")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TokenEntry describes a caller authenticated by a static bearer token.
+type TokenEntry struct {
+	Caller string   `json:"caller"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+// Tokens authenticates callers presenting one of a fixed set of bearer tokens.
+type Tokens struct {
+	entries []tokenEntry
+}
+
+type tokenEntry struct {
+	caller Caller
+	sum    [sha256.Size]byte
+}
+
+// LoadTokens reads the tokens from a JSON file containing a list of
+// TokenEntry objects.
+func LoadTokens(path string) (*Tokens, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []TokenEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens file %s: %w", path, err)
+	}
+	return NewTokens(entries)
+}
+
+// NewTokens returns an authenticator for the given tokens. Every entry must
+// have a caller and a token, and tokens must be unique.
+func NewTokens(entries []TokenEntry) (*Tokens, error) {
+	t := &Tokens{}
+	seen := make(map[[sha256.Size]byte]bool)
+	for i, e := range entries {
+		if e.Caller == "" || e.Token == "" {
+			return nil, fmt.Errorf("token entry %d: caller and token are required", i)
+		}
+		sum := sha256.Sum256([]byte(e.Token))
+		if seen[sum] {
+			return nil, fmt.Errorf("token entry %d (%s): duplicate token", i, e.Caller)
+		}
+		seen[sum] = true
+		t.entries = append(t.entries, tokenEntry{
+			caller: Caller{ID: e.Caller, Scopes: e.Scopes},
+			sum:    sum,
+		})
+	}
+	return t, nil
+}
+
+// Authenticate returns the caller owning the token. Tokens are compared in
+// constant time.
+func (t *Tokens) Authenticate(ctx context.Context, token string) (*Caller, error) {
+	sum := sha256.Sum256([]byte(token))
+	var found *Caller
+	for i := range t.entries {
+		if subtle.ConstantTimeCompare(sum[:], t.entries[i].sum[:]) == 1 {
+			found = &t.entries[i].caller
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidCredentials
+	}
+	c := *found
+	return &c, nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		token   string
+		want    *Caller
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			content: `[{"caller": "scheduler", "token": "secret", "scopes": ["load:daily"]}]`,
+			token:   "secret",
+			want:    &Caller{ID: "scheduler", Scopes: []string{"load:daily"}},
+		},
+		{
+			name:    "wrong-token",
+			content: `[{"caller": "scheduler", "token": "secret", "scopes": ["load:daily"]}]`,
+			token:   "secrets",
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			tokens, err := LoadTokens(path)
+			if err != nil {
+				t.Fatalf("LoadTokens() error = %v", err)
+			}
+			got, err := tokens.Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Tokens.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Tokens.Authenticate() diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadTokens_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not-json", content: `tokens`},
+		{name: "missing-token", content: `[{"caller": "scheduler"}]`},
+		{name: "missing-caller", content: `[{"token": "secret"}]`},
+		{name: "duplicate", content: `[{"caller": "a", "token": "secret"}, {"caller": "b", "token": "secret"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadTokens(path); err == nil {
+				t.Errorf("LoadTokens() error = nil, want error")
+			}
+		})
+	}
+	if _, err := LoadTokens(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("LoadTokens() error = nil, want error")
+	}
+}
@@ -3,13 +3,21 @@ package bq
 import (
 	"context"
 	"errors"
-	"log"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
 	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
 )
 
+// partitionField is the field partitioning the tables of datatypes.
+const partitionField = "date"
+
 // Client is used to perform BigQuery operations.
 type Client struct {
 	bqiface.Client
@@ -27,14 +35,19 @@ func NewClient(c *bigquery.Client, vc *bigquery.Client) *Client {
 // GetDataset returns a handle to the input dataset and an error indicating whether the
 // dataset exists.
 func (c *Client) GetDataset(ctx context.Context, name string) (bqiface.Dataset, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.GetDataset",
+		trace.WithAttributes(tracing.Dataset.String(name)))
 	ds := c.Dataset(name)
 	_, err := ds.Metadata(ctx)
+	tracing.End(span, err)
 	return ds, err
 }
 
 // CreateDataset creates a new dataset for the input `api.Datatype`.
 // It returns an error if the dataset already exists.
 func (c *Client) CreateDataset(ctx context.Context, dt *api.Datatype) (bqiface.Dataset, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.CreateDataset",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...))
 	ds := c.Dataset(dt.Dataset())
 	err := ds.Create(ctx, &bqiface.DatasetMetadata{
 		DatasetMetadata: bigquery.DatasetMetadata{
@@ -43,35 +56,48 @@ func (c *Client) CreateDataset(ctx context.Context, dt *api.Datatype) (bqiface.D
 			Location: "US",
 		},
 	})
+	tracing.End(span, err)
 	return ds, err
 }
 
 // GetTableMetadata returns the metadata for the input table and an error indicating whether
 // the table exists.
 func (c *Client) GetTableMetadata(ctx context.Context, ds bqiface.Dataset, name string) (*bigquery.TableMetadata, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.GetTableMetadata",
+		trace.WithAttributes(tracing.Table.String(name)))
 	t := ds.Table(name)
 	md, err := t.Metadata(ctx)
+	tracing.End(span, err)
 	return md, err
 }
 
-// CreateTable creates a new date-partitioned table for the input `api.Datatype`.
+// CreateTable creates a new table for the input `api.Datatype`, partitioned by its
+// `date` field. Tables without a `date` field (e.g., small dimension tables
+// replaced as a whole) are not partitioned.
 // It returns the table's metadata and an error if the table creation was not successful.
-func (c *Client) CreateTable(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype) (*bigquery.TableMetadata, error) {
+func (c *Client) CreateTable(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype) (md *bigquery.TableMetadata, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.CreateTable",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...))
+	defer func() { tracing.End(span, err) }()
+
 	bqSchema, err := bigquery.SchemaFromJSON(dt.Schema)
 	if err != nil {
 		return nil, err
 	}
 
 	t := ds.Table(dt.Table())
-	err = t.Create(ctx, &bigquery.TableMetadata{
+	md = &bigquery.TableMetadata{
 		Name:   dt.Table(),
 		Schema: bqSchema,
-		TimePartitioning: &bigquery.TimePartitioning{
+	}
+	if hasField(bqSchema, partitionField) {
+		md.TimePartitioning = &bigquery.TimePartitioning{
 			Type:                   bigquery.DayPartitioningType,
-			Field:                  "date",
+			Field:                  partitionField,
 			RequirePartitionFilter: true,
-		},
-	})
+		}
+	}
+	err = t.Create(ctx, md)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +105,11 @@ func (c *Client) CreateTable(ctx context.Context, ds bqiface.Dataset, dt *api.Da
 }
 
 // UpdateSchema updates the schema for the input `api.Datatype` table.
-func (c *Client) UpdateSchema(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype) error {
+func (c *Client) UpdateSchema(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.UpdateSchema",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...))
+	defer func() { tracing.End(span, err) }()
+
 	bqSchema, err := bigquery.SchemaFromJSON(dt.Schema)
 	if err != nil {
 		return err
@@ -100,13 +130,18 @@ func (c *Client) UpdateSchema(ctx context.Context, ds bqiface.Dataset, dt *api.D
 	return c.updateView(ctx, dt, bqSchema)
 }
 
-func (c *Client) updateView(ctx context.Context, dt *api.Datatype, bqSchema bigquery.Schema) error {
+func (c *Client) updateView(ctx context.Context, dt *api.Datatype, bqSchema bigquery.Schema) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.updateView",
+		trace.WithAttributes(tracing.Dataset.String(dt.ViewDataset()), tracing.Table.String(dt.ViewTable())))
+	defer func() { tracing.End(span, err) }()
+
 	ds := c.ViewClient.Dataset(dt.ViewDataset())
-	_, err := ds.Metadata(ctx)
+	_, err = ds.Metadata(ctx)
 	if err != nil {
 		// Dataset doesn't exist. Nothing to update.
 		// NOTE: Error could also be caused by insufficient permissions.
-		log.Printf("failed to get BigQuery view dataset %s: %v", dt.ViewDataset(), err)
+		logging.FromContext(ctx).Warn("failed to get BigQuery view dataset",
+			logging.DatasetKey, dt.ViewDataset(), logging.ErrorKey, err)
 		return nil
 	}
 
@@ -114,7 +149,8 @@ func (c *Client) updateView(ctx context.Context, dt *api.Datatype, bqSchema bigq
 	_, err = view.Metadata(ctx)
 	if err != nil {
 		// View doesn't exist. Nothing to update.
-		log.Printf("failed to get BigQuery view table %s.%s: %v", dt.ViewDataset(), dt.ViewTable(), err)
+		logging.FromContext(ctx).Warn("failed to get BigQuery view table",
+			logging.DatasetKey, dt.ViewDataset(), logging.TableKey, dt.ViewTable(), logging.ErrorKey, err)
 		return nil
 	}
 
@@ -124,10 +160,61 @@ func (c *Client) updateView(ctx context.Context, dt *api.Datatype, bqSchema bigq
 	return err
 }
 
+// LoadStatistics describes the outcome of a completed load job.
+type LoadStatistics struct {
+	bigquery.LoadStatistics
+	// BadRecords is the number of invalid records skipped by the job. The
+	// BigQuery API reports each skipped record as an error in the status of
+	// an otherwise successful job.
+	BadRecords int64
+	// JobID is the ID of the load job.
+	JobID string
+	// StagedJobID is the ID of the job writing the data of a staging table
+	// to the destination table (a copy or a merge), if any (see LoadStaged
+	// and Merge).
+	StagedJobID string
+}
+
+// JobError is returned when a BigQuery job was started but did not complete
+// successfully.
+type JobError struct {
+	JobID string
+	Err   error
+}
+
+func (e *JobError) Error() string {
+	return "job " + e.JobID + ": " + e.Err.Error()
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
 // Load loads data from a set of GCS uris to a BigQuery table. It overwrites the existing data in
 // the destination table. If the table name includes a partition decoration (e.g., table$YYYYMMDD),
 // it will only overwrite said partition.
-func (c *Client) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) error {
+// It returns the statistics of the completed load job. If the job fails, the error is a
+// *JobError.
+func (c *Client) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (stats *LoadStatistics, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.Load",
+		trace.WithAttributes(tracing.Table.String(name)))
+	defer func() { tracing.End(span, err) }()
+	return c.load(ctx, ds, name, bigquery.WriteTruncate, uri...)
+}
+
+// Append loads data from a set of GCS uris to a BigQuery table (or partition,
+// like Load), keeping its existing data.
+// It returns the statistics of the completed load job. If the job fails, the error is a
+// *JobError.
+func (c *Client) Append(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (stats *LoadStatistics, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.Append",
+		trace.WithAttributes(tracing.Table.String(name)))
+	defer func() { tracing.End(span, err) }()
+	return c.load(ctx, ds, name, bigquery.WriteAppend, uri...)
+}
+
+// load runs a load job with the write disposition and waits for it.
+func (c *Client) load(ctx context.Context, ds bqiface.Dataset, name string, disposition bigquery.TableWriteDisposition, uri ...string) (*LoadStatistics, error) {
 	gcsRef := bigquery.NewGCSReference(uri...)
 	gcsRef.SourceFormat = bigquery.JSON
 	tbl := ds.Table(name)
@@ -135,26 +222,46 @@ func (c *Client) Load(ctx context.Context, ds bqiface.Dataset, name string, uri
 	loader.SetLoadConfig(bqiface.LoadConfig{
 		LoadConfig: bigquery.LoadConfig{
 			Src:              gcsRef,
-			WriteDisposition: bigquery.WriteTruncate,
+			WriteDisposition: disposition,
 		},
 		Dst: tbl,
 	})
 
 	job, err := loader.Run(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	trace.SpanFromContext(ctx).SetAttributes(tracing.JobID.String(job.ID()))
+	logger := logging.FromContext(ctx).With(logging.JobIDKey, job.ID())
+	logger.Debug("started BigQuery load job", "uris", uri, "disposition", disposition)
 
 	status, err := job.Wait(ctx)
 	if err != nil {
-		return err
+		return nil, &JobError{JobID: job.ID(), Err: err}
 	}
 
 	if status.Err() != nil {
-		return jobErrors(status)
+		return nil, &JobError{JobID: job.ID(), Err: jobErrors(status)}
 	}
 
-	return nil
+	stats := loadStatistics(status)
+	stats.JobID = job.ID()
+	logger.Info("finished BigQuery load job", "rows", stats.OutputRows, "bad_records", stats.BadRecords)
+	return stats, nil
+}
+
+// loadStatistics extracts the load statistics from a successful job's status.
+func loadStatistics(status *bigquery.JobStatus) *LoadStatistics {
+	stats := &LoadStatistics{
+		BadRecords: int64(len(status.Errors)),
+	}
+	if status.Statistics == nil {
+		return stats
+	}
+	if ls, ok := status.Statistics.Details.(*bigquery.LoadStatistics); ok && ls != nil {
+		stats.LoadStatistics = *ls
+	}
+	return stats
 }
 
 func jobErrors(status *bigquery.JobStatus) error {
@@ -164,3 +271,79 @@ func jobErrors(status *bigquery.JobStatus) error {
 	}
 	return err
 }
+
+// Partition describes a partition of a table.
+type Partition struct {
+	ID           string // YYYYMMDD.
+	Rows         int64
+	LastModified time.Time
+}
+
+// PartitionInfo returns the partitions of a table, including empty ones,
+// keyed by partition ID (YYYYMMDD). Special partitions (e.g., __NULL__) are
+// omitted.
+func (c *Client) PartitionInfo(ctx context.Context, dataset, table string) (parts map[string]*Partition, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.PartitionInfo",
+		trace.WithAttributes(tracing.Dataset.String(dataset), tracing.Table.String(table)))
+	defer func() { tracing.End(span, err) }()
+
+	q := "SELECT partition_id, total_rows, last_modified_time FROM `" + dataset + ".INFORMATION_SCHEMA.PARTITIONS`" +
+		" WHERE table_name = @table"
+	query := c.Query(q)
+	query.SetQueryConfig(bqiface.QueryConfig{
+		QueryConfig: bigquery.QueryConfig{
+			Q:          q,
+			Parameters: []bigquery.QueryParameter{{Name: "table", Value: table}},
+		},
+	})
+	it, err := query.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts = make(map[string]*Partition)
+	for {
+		var row map[string]bigquery.Value
+		err := it.Next(&row)
+		if err == iterator.Done {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, _ := row["partition_id"].(string)
+		if strings.HasPrefix(id, "__") {
+			continue
+		}
+		p := &Partition{ID: id}
+		p.Rows, _ = row["total_rows"].(int64)
+		p.LastModified, _ = row["last_modified_time"].(time.Time)
+		parts[id] = p
+	}
+}
+
+// Partitions returns the number of rows of each non-empty partition of a
+// table, keyed by partition ID (YYYYMMDD).
+func (c *Client) Partitions(ctx context.Context, dataset, table string) (map[string]int64, error) {
+	info, err := c.PartitionInfo(ctx, dataset, table)
+	if err != nil {
+		return nil, err
+	}
+	parts := make(map[string]int64, len(info))
+	for id, p := range info {
+		if p.Rows > 0 {
+			parts[id] = p.Rows
+		}
+	}
+	return parts, nil
+}
+
+// hasField reports whether the schema has a top-level field of the name.
+func hasField(schema bigquery.Schema, name string) bool {
+	for _, f := range schema {
+		if strings.EqualFold(f.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
@@ -20,10 +21,10 @@ var (
 )
 
 func TestNewClient(t *testing.T) {
-	bqMain, err := bigquery.NewClient(context.Background(), "foo")
+	bqMain, err := bigquery.NewClient(context.Background(), "foo", testOptions...)
 	testingx.Must(t, err, "failed to create fake BQ client")
 	defer bqMain.Close()
-	bqView, err := bigquery.NewClient(context.Background(), "bar")
+	bqView, err := bigquery.NewClient(context.Background(), "bar", testOptions...)
 	testingx.Must(t, err, "failed to create fake BQ view client")
 	defer bqView.Close()
 	got := NewClient(bqMain, bqView)
@@ -192,11 +193,22 @@ func TestClient_GetTableMetadata(t *testing.T) {
 
 func TestClient_CreateTable(t *testing.T) {
 	tests := []struct {
-		name    string
-		mdType  bigquery.TableType
-		dt      *api.Datatype
-		wantErr bool
+		name            string
+		mdType          bigquery.TableType
+		dt              *api.Datatype
+		wantPartitioned bool
+		wantErr         bool
 	}{
+		{
+			name: "success-partitioned",
+			dt: api.NewMlabDatatype(
+				api.DatatypeOpts{
+					Name:       datatypeID,
+					Experiment: experimentID,
+					Schema:     testingx.MustReadFile(t, "./testdata/date-schema.json"),
+				}),
+			wantPartitioned: true,
+		},
 		{
 			name: "success-mlab",
 			dt: api.NewMlabDatatype(
@@ -279,6 +291,9 @@ func TestClient_CreateTable(t *testing.T) {
 			if got != md {
 				t.Errorf("Client.CreateTable() = %v, want = %v", got, md)
 			}
+			if (got.TimePartitioning != nil) != tt.wantPartitioned {
+				t.Errorf("Client.CreateTable() partitioning = %v, want partitioned = %v", got.TimePartitioning, tt.wantPartitioned)
+			}
 		})
 	}
 }
@@ -415,38 +430,67 @@ func TestClient_UpdateSchemaAndView(t *testing.T) {
 }
 
 func TestClient_Load(t *testing.T) {
+	stats := &bigquery.LoadStatistics{
+		InputFiles:     2,
+		InputFileBytes: 1024,
+		OutputRows:     100,
+		OutputBytes:    2048,
+	}
+
 	tests := []struct {
-		name    string
-		loader  *bqfake.Loader
-		uris    []string
-		wantErr bool
+		name      string
+		loader    bqiface.Loader
+		uris      []string
+		wantStats *LoadStatistics
+		wantErr   bool
+		wantJobID string
 	}{
 		{
-			name:    "success",
-			loader:  bqfake.NewLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil), nil),
-			wantErr: false,
+			name:      "success",
+			loader:    newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil), nil),
+			wantStats: &LoadStatistics{JobID: "job-id"},
+			wantErr:   false,
+		},
+		{
+			name: "success-with-stats",
+			loader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{
+				Statistics: &bigquery.JobStatistics{Details: stats},
+			}, nil), nil),
+			wantStats: &LoadStatistics{LoadStatistics: *stats, JobID: "job-id"},
+			wantErr:   false,
+		},
+		{
+			name: "success-with-bad-records",
+			loader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{
+				Statistics: &bigquery.JobStatistics{Details: stats},
+				Errors:     []*bigquery.Error{{Message: "bad record"}},
+			}, nil), nil),
+			wantStats: &LoadStatistics{LoadStatistics: *stats, BadRecords: 1, JobID: "job-id"},
+			wantErr:   false,
 		},
 		{
 			name:   "success-multiple-uris",
-			loader: bqfake.NewLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil), nil),
+			loader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil), nil),
 			uris: []string{
 				"gs://fake-bucket/autoload/v1/experiment/datatype/2023/03/26/*",
 				"gs://fake-bucket/autoload/v1/experiment/datatype/2023/03/27/*",
 				"gs://fake-bucket/autoload/v1/experiment/datatype/2023/03/28/*",
 			},
-			wantErr: false,
+			wantStats: &LoadStatistics{JobID: "job-id"},
+			wantErr:   false,
 		},
 		{
 			name: "loader-err",
-			loader: bqfake.NewLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil),
+			loader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil),
 				errors.New("loader err")),
 			wantErr: true,
 		},
 		{
 			name: "job-err",
-			loader: bqfake.NewLoader(bqfake.NewJob(&bigquery.JobStatus{}, errors.New("job error")),
+			loader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, errors.New("job error")),
 				nil),
-			wantErr: true,
+			wantErr:   true,
+			wantJobID: "job-id",
 		},
 	}
 
@@ -465,10 +509,139 @@ func TestClient_Load(t *testing.T) {
 			c := &Client{Client: bq}
 
 			uris := append(tt.uris, "gs://fake-bucket/autoload/v1/experiment/datatype/YYYY/MM/DD/*")
-			err = c.Load(context.Background(), ds, datatypeID, uris...)
+			got, err := c.Load(context.Background(), ds, datatypeID, uris...)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("Client.Load() error = %v, wantErr = %v", err, tt.wantErr)
 			}
+			var jobErr *JobError
+			if errors.As(err, &jobErr) != (tt.wantJobID != "") || (jobErr != nil && jobErr.JobID != tt.wantJobID) {
+				t.Errorf("Client.Load() error = %v, want job ID %q", err, tt.wantJobID)
+			}
+
+			if !reflect.DeepEqual(got, tt.wantStats) {
+				t.Errorf("Client.Load() = %v, want = %v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestClient_Append(t *testing.T) {
+	loader := &recordingLoader{fakeLoader: newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, nil), nil)}
+	table := bqfake.NewTable(bqfake.TableOpts{
+		Dataset:  bqfake.Dataset{},
+		Name:     datatypeID,
+		Metadata: &bigquery.TableMetadata{},
+		Loader:   loader,
+	})
+	ds := bqfake.NewDataset(map[string]*bqfake.Table{datatypeID: table}, nil, nil)
+	c := &Client{}
+
+	got, err := c.Append(context.Background(), ds, datatypeID, "gs://fake-bucket/file1.json")
+	testingx.Must(t, err, "failed to append")
+	if got.JobID != "job-id" {
+		t.Errorf("Client.Append() job ID = %q, want %q", got.JobID, "job-id")
+	}
+	if loader.config.WriteDisposition != bigquery.WriteAppend {
+		t.Errorf("Client.Append() disposition = %v, want %v", loader.config.WriteDisposition, bigquery.WriteAppend)
+	}
+}
+
+func TestClient_Partitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  bqfake.QueryConfig
+		want    map[string]int64
+		wantErr bool
+	}{
+		{
+			name: "success",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{
+					Rows: []map[string]bigquery.Value{
+						{"partition_id": "20230306", "total_rows": int64(10)},
+						{"partition_id": "20230307", "total_rows": int64(20)},
+						{"partition_id": "20230308", "total_rows": int64(0)},
+					},
+				},
+			},
+			want: map[string]int64{"20230306": 10, "20230307": 20},
+		},
+		{
+			name:    "read-error",
+			config:  bqfake.QueryConfig{ReadErr: errors.New("failed to read")},
+			wantErr: true,
+		},
+		{
+			name: "iterator-error",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{IterErr: errors.New("failed to iterate")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Client: bqfake.NewQueryReadClient(tt.config)}
+			got, err := c.Partitions(context.Background(), experimentID, datatypeID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Partitions() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Partitions() = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_PartitionInfo(t *testing.T) {
+	modified := time.Date(2023, 3, 8, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		config  bqfake.QueryConfig
+		want    map[string]*Partition
+		wantErr bool
+	}{
+		{
+			name: "success",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{
+					Rows: []map[string]bigquery.Value{
+						{"partition_id": "20230306", "total_rows": int64(10), "last_modified_time": modified},
+						{"partition_id": "20230307", "total_rows": int64(0), "last_modified_time": modified},
+						{"partition_id": "__NULL__", "total_rows": int64(5), "last_modified_time": modified},
+					},
+				},
+			},
+			want: map[string]*Partition{
+				"20230306": {ID: "20230306", Rows: 10, LastModified: modified},
+				"20230307": {ID: "20230307", Rows: 0, LastModified: modified},
+			},
+		},
+		{
+			name:    "read-error",
+			config:  bqfake.QueryConfig{ReadErr: errors.New("failed to read")},
+			wantErr: true,
+		},
+		{
+			name: "iterator-error",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{IterErr: errors.New("failed to iterate")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Client: bqfake.NewQueryReadClient(tt.config)}
+			got, err := c.PartitionInfo(context.Background(), experimentID, datatypeID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.PartitionInfo() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.PartitionInfo() = %v, want = %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -534,3 +707,41 @@ func TestClient_jobErrors(t *testing.T) {
 		})
 	}
 }
+
+// fakeJob extends bqfake.Job with a job ID.
+type fakeJob struct {
+	*bqfake.Job
+}
+
+func (j *fakeJob) ID() string {
+	return "job-id"
+}
+
+// fakeLoader returns a fakeJob when run.
+type fakeLoader struct {
+	*bqfake.Loader
+	job *fakeJob
+	err error
+}
+
+func newFakeLoader(job *bqfake.Job, err error) *fakeLoader {
+	return &fakeLoader{
+		Loader: bqfake.NewLoader(job, err),
+		job:    &fakeJob{Job: job},
+		err:    err,
+	}
+}
+
+func (l *fakeLoader) Run(ctx context.Context) (bqiface.Job, error) {
+	return l.job, l.err
+}
+
+// recordingLoader records its configuration.
+type recordingLoader struct {
+	*fakeLoader
+	config bqiface.LoadConfig
+}
+
+func (l *recordingLoader) SetLoadConfig(config bqiface.LoadConfig) {
+	l.config = config
+}
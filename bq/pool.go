@@ -0,0 +1,84 @@
+package bq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/option"
+)
+
+// Pool keeps a BigQuery client per project, so datatypes can be loaded to
+// different raw-data and view projects. Clients are created on first use and
+// shared by all the destinations using their project.
+type Pool struct {
+	ctx  context.Context
+	opts []option.ClientOption
+
+	mu       sync.Mutex
+	projects map[string]*bigquery.Client
+	clients  map[[2]string]*Client
+}
+
+// NewPool returns a new, empty Pool. The context and options are used to
+// create the BigQuery clients.
+func NewPool(ctx context.Context, opts ...option.ClientOption) *Pool {
+	return &Pool{
+		ctx:      ctx,
+		opts:     opts,
+		projects: make(map[string]*bigquery.Client),
+		clients:  make(map[[2]string]*Client),
+	}
+}
+
+// Client returns the Client loading raw data to the given project and updating
+// views in the given view project.
+func (p *Pool) Client(project, viewProject string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := [2]string{project, viewProject}
+	if c, ok := p.clients[key]; ok {
+		return c, nil
+	}
+	main, err := p.project(project)
+	if err != nil {
+		return nil, err
+	}
+	view, err := p.project(viewProject)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = NewClient(main, view)
+	return p.clients[key], nil
+}
+
+// project returns the BigQuery client for a project. The caller must hold mu.
+func (p *Pool) project(project string) (*bigquery.Client, error) {
+	if c, ok := p.projects[project]; ok {
+		return c, nil
+	}
+	if project == "" {
+		return nil, errors.New("empty BigQuery project")
+	}
+	c, err := bigquery.NewClient(p.ctx, project, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.projects[project] = c
+	return c, nil
+}
+
+// Close closes all the BigQuery clients in the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := make([]error, 0)
+	for _, c := range p.projects {
+		errs = append(errs, c.Close())
+	}
+	p.projects = make(map[string]*bigquery.Client)
+	p.clients = make(map[[2]string]*Client)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package bq
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+// testOptions create BigQuery clients without credentials. They never send
+// requests.
+var testOptions = []option.ClientOption{
+	option.WithoutAuthentication(),
+	option.WithEndpoint("http://localhost:0"),
+}
+
+// checkProjects reports whether the client loads raw data to the project and
+// updates views in the view project.
+func checkProjects(t *testing.T, c *Client, project, viewProject string) {
+	t.Helper()
+	if got := c.Client.Dataset("d").ProjectID(); got != project {
+		t.Errorf("Pool.Client() project = %q, want %q", got, project)
+	}
+	if got := c.ViewClient.Dataset("d").ProjectID(); got != viewProject {
+		t.Errorf("Pool.Client() view project = %q, want %q", got, viewProject)
+	}
+}
+
+func TestPool_Client(t *testing.T) {
+	p := NewPool(context.Background(), testOptions...)
+	defer p.Close()
+
+	a, err := p.Client("foo", "bar")
+	if err != nil {
+		t.Fatalf("Pool.Client() error = %v", err)
+	}
+	checkProjects(t, a, "foo", "bar")
+
+	again, err := p.Client("foo", "bar")
+	if err != nil || again != a {
+		t.Errorf("Pool.Client() = %p, %v, want the cached client %p", again, err, a)
+	}
+
+	b, err := p.Client("baz", "bar")
+	if err != nil {
+		t.Fatalf("Pool.Client() error = %v", err)
+	}
+	if b == a {
+		t.Errorf("Pool.Client() = %p, want a new client", b)
+	}
+	checkProjects(t, b, "baz", "bar")
+	if len(p.projects) != 3 {
+		t.Errorf("Pool.Client() created %d BigQuery clients, want 3", len(p.projects))
+	}
+
+	if _, err := p.Client("", "bar"); err == nil {
+		t.Errorf("Pool.Client() error = nil, want error for empty project")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Pool.Close() error = %v", err)
+	}
+	if len(p.projects) != 0 {
+		t.Errorf("Pool.Close() kept %d BigQuery clients, want 0", len(p.projects))
+	}
+}
@@ -0,0 +1,242 @@
+package bq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/tracing"
+	"github.com/m-lab/go/timex"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+)
+
+// stagingExpiration bounds the lifetime of staging tables, in case they
+// cannot be deleted after a load.
+const stagingExpiration = 24 * time.Hour
+
+// StagingCheck validates the data loaded to a staging table before it
+// replaces the destination partition. The client is the one loading the data.
+type StagingCheck struct {
+	Name  string
+	Check func(ctx context.Context, c *Client, staging bqiface.Table, stats *LoadStatistics) error
+}
+
+// CheckError is returned when the data loaded to a staging table fails a
+// check. The destination partition is left unchanged.
+type CheckError struct {
+	Check string
+	Err   error
+}
+
+func (e *CheckError) Error() string {
+	return "staging check " + e.Check + ": " + e.Err.Error()
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// QueryCheck returns a check failing if the query returns any rows (e.g.,
+// "SELECT id FROM {table} WHERE id IS NULL LIMIT 1"). "{table}" is replaced
+// by the quoted, fully-qualified name of the staging table.
+func QueryCheck(name, query string) StagingCheck {
+	return StagingCheck{
+		Name: name,
+		Check: func(ctx context.Context, c *Client, staging bqiface.Table, _ *LoadStatistics) error {
+			q := strings.ReplaceAll(query, "{table}", "`"+sqlName(staging.FullyQualifiedName())+"`")
+			it, err := c.Query(q).Read(ctx)
+			if err != nil {
+				return err
+			}
+			var row map[string]bigquery.Value
+			err = it.Next(&row)
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("query returned rows: %v", row)
+		},
+	}
+}
+
+// LoadStaged loads data from a set of GCS uris to a new staging table with
+// the schema of the destination table, checks it, and replaces the
+// destination partition (table$YYYYMMDD) or table with its contents in a
+// single copy job. Readers of the destination see either the previous or the
+// new data, never a partial or unchecked load. The staging table is deleted
+// afterwards.
+// The load job validates the data against the destination schema: it fails on
+// values of the wrong type and on fields missing from the schema, so data
+// that does not match the schema never reaches the destination.
+// It returns the statistics of the load job, including the ID of the copy
+// job. If the data fails a check, the error is a *CheckError; if the load or
+// copy job fails, it is a *JobError.
+func (c *Client) LoadStaged(ctx context.Context, ds bqiface.Dataset, name string, checks []StagingCheck, uri ...string) (stats *LoadStatistics, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.LoadStaged",
+		trace.WithAttributes(tracing.Table.String(name)))
+	defer func() { tracing.End(span, err) }()
+
+	return c.stage(ctx, ds, name, checks, uri, func(staging bqiface.Table, _ bigquery.Schema) (bqiface.Job, error) {
+		dst := ds.Table(name)
+		copier := dst.CopierFrom(staging)
+		copier.SetCopyConfig(bqiface.CopyConfig{
+			CopyConfig: bigquery.CopyConfig{
+				WriteDisposition: bigquery.WriteTruncate,
+			},
+			Srcs: []bqiface.Table{staging},
+			Dst:  dst,
+		})
+		return copier.Run(ctx)
+	})
+}
+
+// Merge loads data from a set of GCS uris to a new staging table, like
+// LoadStaged, and upserts its rows into the destination partition
+// (table$YYYYMMDD) or table with a MERGE statement: rows matching an existing
+// row on every key field update it, and other rows are inserted. Existing rows
+// missing from the data are kept.
+// It returns the statistics of the load job, including the ID of the merge
+// job. Errors are those of LoadStaged.
+func (c *Client) Merge(ctx context.Context, ds bqiface.Dataset, name string, key []string, checks []StagingCheck, uri ...string) (stats *LoadStatistics, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "bq.Merge",
+		trace.WithAttributes(tracing.Table.String(name)))
+	defer func() { tracing.End(span, err) }()
+
+	table, partition, _ := strings.Cut(name, "$")
+	return c.stage(ctx, ds, name, checks, uri, func(staging bqiface.Table, schema bigquery.Schema) (bqiface.Job, error) {
+		sql, err := mergeQuery(ds.Table(table).FullyQualifiedName(), staging.FullyQualifiedName(), partition, schema, key)
+		if err != nil {
+			return nil, err
+		}
+		logging.FromContext(ctx).Debug("merging BigQuery staging table", "query", sql)
+		return c.Query(sql).Run(ctx)
+	})
+}
+
+// stage loads data to a new staging table with the schema of the destination
+// table, checks it, and writes it to the destination with the job started by
+// apply. The staging table is deleted once the job completes.
+func (c *Client) stage(ctx context.Context, ds bqiface.Dataset, name string, checks []StagingCheck, uri []string,
+	apply func(staging bqiface.Table, schema bigquery.Schema) (bqiface.Job, error)) (*LoadStatistics, error) {
+	table, partition, _ := strings.Cut(name, "$")
+	md, err := ds.Table(table).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingName, err := stagingTable(table, partition)
+	if err != nil {
+		return nil, err
+	}
+	staging := ds.Table(stagingName)
+	err = staging.Create(ctx, &bigquery.TableMetadata{
+		Name:           stagingName,
+		Schema:         md.Schema,
+		ExpirationTime: time.Now().Add(stagingExpiration),
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger := logging.FromContext(ctx).With("staging_table", stagingName)
+	defer func() {
+		// The staging table expires anyway, so failures are only logged.
+		if err := staging.Delete(ctx); err != nil {
+			logger.Warn("failed to delete BigQuery staging table", logging.ErrorKey, err)
+		}
+	}()
+
+	stats, err := c.Load(ctx, ds, stagingName, uri...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range checks {
+		if err := check.Check(ctx, c, staging, stats); err != nil {
+			logger.Warn("staged partition failed check", "check", check.Name, logging.ErrorKey, err)
+			return stats, &CheckError{Check: check.Name, Err: err}
+		}
+	}
+
+	job, err := apply(staging, md.Schema)
+	if err != nil {
+		return stats, err
+	}
+	stats.StagedJobID = job.ID()
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return stats, &JobError{JobID: job.ID(), Err: err}
+	}
+	if status.Err() != nil {
+		return stats, &JobError{JobID: job.ID(), Err: jobErrors(status)}
+	}
+	logger.Info("wrote BigQuery staging table to destination", logging.JobIDKey, job.ID())
+	return stats, nil
+}
+
+// mergeQuery returns the MERGE statement upserting the rows of the staging
+// table into the destination table, or only into the partition of a date
+// (YYYYMMDD), if not empty. Tables are fully-qualified names (project:dataset.table).
+func mergeQuery(dst, staging, partition string, schema bigquery.Schema, key []string) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("merge requires a key")
+	}
+	keys := make(map[string]bool, len(key))
+	on := make([]string, 0, len(key)+1)
+	for _, k := range key {
+		if !hasField(schema, k) {
+			return "", fmt.Errorf("merge key %s is not in the destination schema", k)
+		}
+		keys[strings.ToLower(k)] = true
+		on = append(on, fmt.Sprintf("T.`%s` = S.`%s`", k, k))
+	}
+	if partition != "" {
+		date, err := time.Parse(timex.YYYYMMDD, partition)
+		if err != nil {
+			return "", err
+		}
+		// Also satisfies the partition filter required by the table.
+		on = append(on, fmt.Sprintf("T.`%s` = DATE '%s'", partitionField, date.Format(time.DateOnly)))
+	}
+
+	var set, cols, vals []string
+	for _, f := range schema {
+		cols = append(cols, "`"+f.Name+"`")
+		vals = append(vals, "S.`"+f.Name+"`")
+		if !keys[strings.ToLower(f.Name)] {
+			set = append(set, fmt.Sprintf("`%s` = S.`%s`", f.Name, f.Name))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "MERGE `%s` T USING `%s` S ON %s", sqlName(dst), sqlName(staging), strings.Join(on, " AND "))
+	if len(set) != 0 {
+		fmt.Fprintf(&b, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(set, ", "))
+	}
+	fmt.Fprintf(&b, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)", strings.Join(cols, ", "), strings.Join(vals, ", "))
+	return b.String(), nil
+}
+
+// sqlName converts a fully-qualified table name (project:dataset.table) to
+// its GoogleSQL form (project.dataset.table).
+func sqlName(fqn string) string {
+	return strings.Replace(fqn, ":", ".", 1)
+}
+
+// stagingTable returns a unique name for the staging table of a partition.
+func stagingTable(table, partition string) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return table + "_staging_" + partition + "_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,407 @@
+package bq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/go/cloudtest/bqfake"
+)
+
+// fakeDataset returns the destination table by name and a single
+// fakeTable for any staging table.
+type fakeDataset struct {
+	bqiface.Dataset
+	dst     *fakeTable
+	staging *fakeTable
+}
+
+func (ds *fakeDataset) Table(name string) bqiface.Table {
+	if strings.Contains(name, "_staging_") {
+		ds.staging.name = name
+		return ds.staging
+	}
+	return ds.dst
+}
+
+// fakeTable records its creation, deletion and copies.
+type fakeTable struct {
+	bqiface.Table
+	name      string
+	md        *bigquery.TableMetadata
+	loader    bqiface.Loader
+	copier    *fakeCopier
+	createErr error
+	created   *bigquery.TableMetadata
+	deleted   bool
+}
+
+func (t *fakeTable) FullyQualifiedName() string {
+	return projectID + ":" + experimentID + "." + t.name
+}
+
+func (t *fakeTable) Metadata(ctx context.Context) (*bigquery.TableMetadata, error) {
+	if t.md == nil {
+		return nil, errors.New("not found")
+	}
+	return t.md, nil
+}
+
+func (t *fakeTable) Create(ctx context.Context, md *bigquery.TableMetadata) error {
+	t.created = md
+	return t.createErr
+}
+
+func (t *fakeTable) Delete(ctx context.Context) error {
+	t.deleted = true
+	return nil
+}
+
+func (t *fakeTable) LoaderFrom(src bigquery.LoadSource) bqiface.Loader {
+	return t.loader
+}
+
+func (t *fakeTable) CopierFrom(srcs ...bqiface.Table) bqiface.Copier {
+	return t.copier
+}
+
+// fakeCopier records its configuration and returns a fakeJob when run.
+type fakeCopier struct {
+	bqiface.Copier
+	config *bqiface.CopyConfig
+	job    *fakeJob
+	err    error
+}
+
+func (c *fakeCopier) SetCopyConfig(config bqiface.CopyConfig) {
+	c.config = &config
+}
+
+func (c *fakeCopier) Run(ctx context.Context) (bqiface.Job, error) {
+	return c.job, c.err
+}
+
+func TestClient_LoadStaged(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "a", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "x", Type: bigquery.IntegerFieldType},
+		}},
+	}
+	stats := &bigquery.LoadStatistics{OutputRows: 100}
+	okJob := bqfake.NewJob(&bigquery.JobStatus{Statistics: &bigquery.JobStatistics{Details: stats}}, nil)
+	failing := StagingCheck{
+		Name:  "failing",
+		Check: func(context.Context, *Client, bqiface.Table, *LoadStatistics) error { return errors.New("bad data") },
+	}
+
+	tests := []struct {
+		name        string
+		dstMD       *bigquery.TableMetadata
+		createErr   error
+		loader      bqiface.Loader
+		copyJob     *bqfake.Job
+		copyErr     error
+		checks      []StagingCheck
+		wantStats   *LoadStatistics
+		wantCheck   string
+		wantJobErr  bool
+		wantErr     bool
+		wantCreated bool
+		wantCopy    bool
+	}{
+		{
+			name:        "success",
+			dstMD:       &bigquery.TableMetadata{Schema: schema},
+			loader:      newFakeLoader(okJob, nil),
+			copyJob:     bqfake.NewJob(&bigquery.JobStatus{}, nil),
+			wantStats:   &LoadStatistics{LoadStatistics: *stats, JobID: "job-id", StagedJobID: "job-id"},
+			wantCreated: true,
+			wantCopy:    true,
+		},
+		{
+			name:    "no-destination",
+			wantErr: true,
+		},
+		{
+			name:        "create-err",
+			dstMD:       &bigquery.TableMetadata{Schema: schema},
+			createErr:   errors.New("create error"),
+			wantErr:     true,
+			wantCreated: true,
+		},
+		{
+			name:        "load-err",
+			dstMD:       &bigquery.TableMetadata{Schema: schema},
+			loader:      newFakeLoader(bqfake.NewJob(&bigquery.JobStatus{}, errors.New("job error")), nil),
+			wantErr:     true,
+			wantJobErr:  true,
+			wantCreated: true,
+		},
+		{
+			name:        "custom-check",
+			dstMD:       &bigquery.TableMetadata{Schema: schema},
+			loader:      newFakeLoader(okJob, nil),
+			checks:      []StagingCheck{failing},
+			wantStats:   &LoadStatistics{LoadStatistics: *stats, JobID: "job-id"},
+			wantErr:     true,
+			wantCheck:   "failing",
+			wantCreated: true,
+		},
+		{
+			name:        "copy-err",
+			dstMD:       &bigquery.TableMetadata{Schema: schema},
+			loader:      newFakeLoader(okJob, nil),
+			copyJob:     bqfake.NewJob(&bigquery.JobStatus{}, errors.New("copy error")),
+			wantStats:   &LoadStatistics{LoadStatistics: *stats, JobID: "job-id", StagedJobID: "job-id"},
+			wantErr:     true,
+			wantJobErr:  true,
+			wantCreated: true,
+			wantCopy:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copier := &fakeCopier{err: tt.copyErr}
+			if tt.copyJob != nil {
+				copier.job = &fakeJob{Job: tt.copyJob}
+			}
+			ds := &fakeDataset{
+				dst: &fakeTable{name: datatypeID, md: tt.dstMD, copier: copier},
+				staging: &fakeTable{
+					loader:    tt.loader,
+					createErr: tt.createErr,
+				},
+			}
+			c := &Client{}
+
+			got, err := c.LoadStaged(context.Background(), ds, datatypeID+"$20230601", tt.checks, "gs://fake-bucket/*")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.LoadStaged() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			var checkErr *CheckError
+			if errors.As(err, &checkErr) != (tt.wantCheck != "") || (checkErr != nil && checkErr.Check != tt.wantCheck) {
+				t.Errorf("Client.LoadStaged() error = %v, want failed check %q", err, tt.wantCheck)
+			}
+			var jobErr *JobError
+			if errors.As(err, &jobErr) != tt.wantJobErr {
+				t.Errorf("Client.LoadStaged() error = %v, want job error = %v", err, tt.wantJobErr)
+			}
+			if tt.wantStats != nil && (got == nil || *got != *tt.wantStats) {
+				t.Errorf("Client.LoadStaged() = %v, want = %v", got, tt.wantStats)
+			}
+
+			staging := ds.staging
+			if (staging.created != nil) != tt.wantCreated {
+				t.Fatalf("Client.LoadStaged() created staging table = %v, want %v", staging.created != nil, tt.wantCreated)
+			}
+			if tt.wantCreated {
+				if !strings.HasPrefix(staging.name, datatypeID+"_staging_20230601_") {
+					t.Errorf("Client.LoadStaged() staging table = %q", staging.name)
+				}
+				if staging.created.ExpirationTime.IsZero() {
+					t.Errorf("Client.LoadStaged() staging table does not expire")
+				}
+				if staging.deleted != (tt.createErr == nil) {
+					t.Errorf("Client.LoadStaged() deleted staging table = %v", staging.deleted)
+				}
+			}
+			if (copier.config != nil) != tt.wantCopy {
+				t.Fatalf("Client.LoadStaged() copied = %v, want %v", copier.config != nil, tt.wantCopy)
+			}
+			if tt.wantCopy && copier.config.WriteDisposition != bigquery.WriteTruncate {
+				t.Errorf("Client.LoadStaged() copy disposition = %v, want %v", copier.config.WriteDisposition, bigquery.WriteTruncate)
+			}
+		})
+	}
+}
+
+func TestQueryCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  bqfake.QueryConfig
+		wantErr bool
+	}{
+		{
+			name: "no-rows",
+		},
+		{
+			name: "rows",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{
+					Rows: []map[string]bigquery.Value{{"id": nil}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "query-err",
+			config: bqfake.QueryConfig{
+				ReadErr: errors.New("read error"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Client: bqfake.NewQueryReadClient(tt.config)}
+			check := QueryCheck("ids", "SELECT id FROM {table} WHERE id IS NULL")
+			staging := &fakeTable{name: "table_staging"}
+			err := check.Check(context.Background(), c, staging, &LoadStatistics{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryCheck() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeQueryClient records the queries it runs, returning a fakeJob.
+type fakeQueryClient struct {
+	bqiface.Client
+	queries []string
+	job     *fakeJob
+}
+
+func (c *fakeQueryClient) Query(q string) bqiface.Query {
+	c.queries = append(c.queries, q)
+	return &fakeQuery{job: c.job}
+}
+
+type fakeQuery struct {
+	bqiface.Query
+	job *fakeJob
+}
+
+func (q *fakeQuery) Run(ctx context.Context) (bqiface.Job, error) {
+	return q.job, nil
+}
+
+func TestClient_Merge(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "date", Type: bigquery.DateFieldType},
+		{Name: "value", Type: bigquery.IntegerFieldType},
+	}
+	stats := &bigquery.LoadStatistics{OutputRows: 100}
+	okJob := bqfake.NewJob(&bigquery.JobStatus{Statistics: &bigquery.JobStatistics{Details: stats}}, nil)
+
+	tests := []struct {
+		name      string
+		key       []string
+		mergeJob  *bqfake.Job
+		wantStats *LoadStatistics
+		wantQuery bool
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			key:       []string{"id"},
+			mergeJob:  bqfake.NewJob(&bigquery.JobStatus{}, nil),
+			wantStats: &LoadStatistics{LoadStatistics: *stats, JobID: "job-id", StagedJobID: "job-id"},
+			wantQuery: true,
+		},
+		{
+			name:      "unknown-key",
+			key:       []string{"missing"},
+			wantStats: &LoadStatistics{LoadStatistics: *stats, JobID: "job-id"},
+			wantErr:   true,
+		},
+		{
+			name:      "merge-err",
+			key:       []string{"id"},
+			mergeJob:  bqfake.NewJob(&bigquery.JobStatus{}, errors.New("merge error")),
+			wantStats: &LoadStatistics{LoadStatistics: *stats, JobID: "job-id", StagedJobID: "job-id"},
+			wantQuery: true,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &fakeDataset{
+				dst: &fakeTable{name: datatypeID, md: &bigquery.TableMetadata{Schema: schema}},
+				staging: &fakeTable{
+					md:     &bigquery.TableMetadata{Schema: schema},
+					loader: newFakeLoader(okJob, nil),
+				},
+			}
+			client := &fakeQueryClient{}
+			if tt.mergeJob != nil {
+				client.job = &fakeJob{Job: tt.mergeJob}
+			}
+			c := &Client{Client: client}
+
+			got, err := c.Merge(context.Background(), ds, datatypeID+"$20230601", tt.key, nil, "gs://fake-bucket/*")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Merge() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if got == nil || *got != *tt.wantStats {
+				t.Errorf("Client.Merge() = %v, want = %v", got, tt.wantStats)
+			}
+			if (len(client.queries) != 0) != tt.wantQuery {
+				t.Errorf("Client.Merge() queries = %v, want query = %v", client.queries, tt.wantQuery)
+			}
+			if !ds.staging.deleted {
+				t.Errorf("Client.Merge() did not delete staging table")
+			}
+		})
+	}
+}
+
+func Test_mergeQuery(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "date", Type: bigquery.DateFieldType},
+		{Name: "value", Type: bigquery.IntegerFieldType},
+	}
+	tests := []struct {
+		name      string
+		partition string
+		key       []string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "partition",
+			partition: "20230601",
+			key:       []string{"id"},
+			want: "MERGE `p.d.t` T USING `p.d.s` S ON T.`id` = S.`id` AND T.`date` = DATE '2023-06-01'" +
+				" WHEN MATCHED THEN UPDATE SET `date` = S.`date`, `value` = S.`value`" +
+				" WHEN NOT MATCHED THEN INSERT (`id`, `date`, `value`) VALUES (S.`id`, S.`date`, S.`value`)",
+		},
+		{
+			name: "table",
+			key:  []string{"id", "date", "value"},
+			want: "MERGE `p.d.t` T USING `p.d.s` S ON T.`id` = S.`id` AND T.`date` = S.`date` AND T.`value` = S.`value`" +
+				" WHEN NOT MATCHED THEN INSERT (`id`, `date`, `value`) VALUES (S.`id`, S.`date`, S.`value`)",
+		},
+		{
+			name:    "no-key",
+			wantErr: true,
+		},
+		{
+			name:    "unknown-key",
+			key:     []string{"missing"},
+			wantErr: true,
+		},
+		{
+			name:      "invalid-partition",
+			partition: "2023",
+			key:       []string{"id"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeQuery("p:d.t", "p:d.s", tt.partition, schema, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeQuery() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("mergeQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// autoload-lint validates a table schema (and, optionally, a sample of data)
+// before it is uploaded to `autoload/v2/tables/<org>/<experiment>/<datatype>.table.json`.
+// It applies the same rules the autoloader uses during discovery.
+//
+// Example:
+//
+//	autoload-lint -schema datatype.table.json -data sample.json -previous old.table.json
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-lab/autoloader/schema"
+	"github.com/m-lab/go/flagx"
+)
+
+var (
+	schemaFile   string
+	dataFile     string
+	previousFile string
+	maxErrors    int
+)
+
+func init() {
+	flag.StringVar(&schemaFile, "schema", "", "Path to the JSON schema file (<datatype>.table.json) to validate.")
+	flag.StringVar(&dataFile, "data", "", "Optional path to a newline delimited JSON sample to validate against the schema.")
+	flag.StringVar(&previousFile, "previous", "", "Optional path to the previous version of the schema to check compatibility with.")
+	flag.IntVar(&maxErrors, "max-errors", 20, "Maximum number of invalid data rows to report.")
+}
+
+func main() {
+	flag.Parse()
+	flagx.ArgsFromEnv(flag.CommandLine)
+	log.SetFlags(0)
+
+	if schemaFile == "" {
+		log.Fatal("-schema is required")
+	}
+
+	ok := true
+	s, err := parse(schemaFile)
+	if err != nil {
+		report(schemaFile, err)
+		ok = false
+	}
+
+	if s != nil && previousFile != "" {
+		prev, err := bigquery.SchemaFromJSON(mustReadFile(previousFile))
+		if err != nil {
+			log.Fatalf("%s: invalid JSON schema: %v", previousFile, err)
+		}
+		if err := schema.Compatible(prev, s); err != nil {
+			report(schemaFile+" (compared to "+previousFile+")", err)
+			ok = false
+		}
+	}
+
+	if s != nil && dataFile != "" {
+		if !lintData(s, dataFile) {
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+// parse reads and validates a schema file. It returns the schema if it could
+// be parsed, even if it breaks any of the autoloader rules.
+func parse(name string) (bigquery.Schema, error) {
+	s, err := schema.Parse(mustReadFile(name))
+	var fe *schema.FieldError
+	if s == nil && errors.As(err, &fe) {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return s, err
+}
+
+// lintData validates every row of a newline delimited JSON file. It returns
+// whether all the rows are valid.
+func lintData(s bigquery.Schema, name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	invalid := 0
+	for line := 1; ; line++ {
+		row, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(row)) > 0 {
+			if rerr := schema.ValidateRow(s, row); rerr != nil {
+				invalid++
+				if invalid <= maxErrors {
+					report(fmt.Sprintf("%s:%d", name, line), rerr)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if invalid > maxErrors {
+		fmt.Printf("%s: %d more invalid rows not shown\n", name, invalid-maxErrors)
+	}
+	return invalid == 0
+}
+
+// report prints one line per error joined in err.
+func report(prefix string, err error) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		fmt.Printf("%s: %v\n", prefix, e)
+	}
+}
+
+func mustReadFile(name string) []byte {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/auth"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/config"
+	"github.com/m-lab/autoloader/deploy"
+	"github.com/m-lab/autoloader/handler"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/metrics"
+	"github.com/m-lab/autoloader/state"
+)
+
+// deployment contains the clients and handlers built from a configuration.
+type deployment struct {
+	v1, v2   *handler.Client
+	pool     *bq.Pool
+	inflight sync.WaitGroup
+}
+
+// shared contains the clients used by every deployment, which are not
+// affected by configuration reloads.
+type shared struct {
+	storage *storage.Client
+	audit   audit.Sink
+	state   state.Store
+}
+
+// newDeployment builds the clients and handlers for a configuration. If prev is
+// not nil, the new handlers keep its run history.
+func newDeployment(ctx context.Context, sh *shared, cfg *config.Config, prev *deployment) (*deployment, error) {
+	pool := bq.NewPool(ctx)
+	d := &deployment{pool: pool}
+	d.v1, d.v2 = deploy.Handlers(sh.storage, cfg, pool)
+	for _, h := range []*handler.Client{d.v1, d.v2} {
+		h.Audit = sh.audit
+		h.State = sh.state
+	}
+	if prev != nil {
+		d.v1.ShareRuns(prev.v1)
+		d.v2.ShareRuns(prev.v2)
+	}
+	return d, nil
+}
+
+// close closes the deployment's clients once its in-flight requests finish.
+func (d *deployment) close() {
+	go func() {
+		d.inflight.Wait()
+		d.pool.Close()
+	}()
+}
+
+// server serves the requests with the current deployment and replaces it when
+// the configuration is reloaded. Requests in flight during a reload complete
+// with the deployment they started with.
+type server struct {
+	ctx    context.Context
+	shared *shared
+	// loadConfig returns the configuration to deploy.
+	loadConfig func() (*config.Config, error)
+
+	mu      sync.RWMutex // Protects current.
+	current *deployment
+	reload  sync.Mutex // Serializes reloads.
+}
+
+// newServer creates a server with the current configuration.
+func newServer(ctx context.Context, sh *shared, loadConfig func() (*config.Config, error)) (*server, error) {
+	s := &server{ctx: ctx, shared: sh, loadConfig: loadConfig}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	s.current, err = newDeployment(ctx, sh, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload builds a deployment for the latest configuration and replaces the
+// current one. If the configuration is invalid, the current deployment is
+// kept.
+func (s *server) Reload(trigger string) (err error) {
+	s.reload.Lock()
+	defer s.reload.Unlock()
+	logger := logging.FromContext(s.ctx)
+	defer func() {
+		status := "OK"
+		if err != nil {
+			status = "error"
+			logger.Error("failed to reload config", "trigger", trigger, logging.ErrorKey, err)
+		}
+		metrics.ConfigReloadsTotal.WithLabelValues(trigger, status).Inc()
+	}()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	prev := s.current
+	s.mu.RUnlock()
+	d, err := newDeployment(s.ctx, s.shared, cfg, prev)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.current = d
+	s.mu.Unlock()
+	prev.close()
+	logger.Info("reloaded config", "trigger", trigger, "buckets", len(cfg.Buckets))
+	return nil
+}
+
+// handle returns a handler calling the function selected by f from the
+// current deployment.
+func (s *server) handle(f func(d *deployment) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		d := s.current
+		d.inflight.Add(1)
+		s.mu.RUnlock()
+		defer d.inflight.Done()
+		f(d)(w, r)
+	}
+}
+
+// ReloadHandler reloads the configuration on POST requests. Reloads are
+// audit-logged with the identity of the caller.
+func (s *server) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Authenticated requests already log their caller.
+	logger := logging.FromContext(r.Context())
+	if auth.FromContext(r.Context()) == nil {
+		logger = logger.With(auth.CallerKey, "anonymous")
+	}
+	logger.Info("config reload requested", "audit", true)
+	if err := s.Reload("admin"); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// watch reloads the configuration whenever the contents of the file at path
+// change, checking every interval until the context is canceled.
+func (s *server) watch(ctx context.Context, path string, interval time.Duration) {
+	last, _ := os.ReadFile(path)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			b, err := os.ReadFile(path)
+			if err != nil || string(b) == string(last) {
+				continue
+			}
+			last = b
+			s.Reload("watch")
+		}
+	}
+}
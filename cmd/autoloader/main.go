@@ -2,15 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/storage"
-	"github.com/m-lab/autoloader/bq"
-	"github.com/m-lab/autoloader/gcs"
-	gcsv2 "github.com/m-lab/autoloader/gcs/v2"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/auth"
+	"github.com/m-lab/autoloader/config"
 	"github.com/m-lab/autoloader/handler"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/autoloader/tracing"
 	"github.com/m-lab/go/flagx"
 	"github.com/m-lab/go/prometheusx"
 	"github.com/m-lab/go/rtx"
@@ -23,6 +34,20 @@ var (
 	gcsProject          string
 	mlabBucket          string
 	bucketNames         flagx.StringArray
+	namingConfig        string
+	configFile          string
+	configPoll          time.Duration
+	authTokens          string
+	authIssuer          string
+	authAudience        string
+	authJWKS            string
+	authCallers         string
+	auditFile           string
+	auditTable          string
+	stateFile           string
+	stateTable          string
+	tracingExporter     string
+	logLevel            string
 	mainCtx, mainCancel = context.WithCancel(context.Background())
 )
 
@@ -33,47 +58,275 @@ func init() {
 	flag.StringVar(&gcsProject, "gcs-project", "mlab-sandbox", "GCS project")
 	flag.StringVar(&mlabBucket, "mlab-bucket", "", "Archive bucket name containing data from M-Lab's platform")
 	flag.Var(&bucketNames, "buckets", "Archive bucket names in Google Cloud Storage")
+	flag.StringVar(&namingConfig, "naming-config", "", "JSON file with the v2 naming rules for buckets or projects not using the default naming conventions")
+	flag.StringVar(&configFile, "config", "", "YAML or JSON file describing the buckets to load and their destination projects. Replaces -buckets, -mlab-bucket, -naming-config and the project flags")
+	flag.DurationVar(&configPoll, "config-poll", time.Minute, "How often to check the -config file for changes. Zero disables the check")
+	flag.StringVar(&authTokens, "auth-tokens", "", "JSON file with the bearer tokens of the callers and their scopes")
+	flag.StringVar(&authIssuer, "auth-issuer", "", "Issuer of the JWTs accepted as bearer tokens (e.g., https://accounts.google.com). Requires -auth-jwks and -auth-audience")
+	flag.StringVar(&authAudience, "auth-audience", "", "Audience required in the accepted JWTs (e.g., the autoloader's URL)")
+	flag.StringVar(&authJWKS, "auth-jwks", "", "File or https URL of the JWKS verifying the JWTs")
+	flag.StringVar(&authCallers, "auth-callers", "", "JSON file mapping JWT caller identities to their scopes")
+	flag.StringVar(&auditFile, "audit-file", "", "File the audit log of BigQuery mutations is appended to")
+	flag.StringVar(&auditTable, "audit-table", "", "BigQuery table (project.dataset.table) the audit log of BigQuery mutations is written to")
+	flag.StringVar(&stateFile, "state-file", "", "BoltDB file keeping the load history of each partition")
+	flag.StringVar(&stateTable, "state-table", "", "BigQuery table (project.dataset.table) keeping the load history of each partition. Backfill checkpoints are kept in the table with the _backfills suffix. Replaces -state-file")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum log level (debug, info, warn or error)")
+	flag.StringVar(&tracingExporter, "tracing-exporter", tracing.ExporterNone, "OpenTelemetry trace exporter (none, stdout or otlp)")
 }
 
 func main() {
 	defer mainCancel()
 	flag.Parse()
 	rtx.Must(flagx.ArgsFromEnv(flag.CommandLine), "Could not parse env args")
+	rtx.Must(logging.Setup(os.Stderr, logLevel), "Failed to set up logging")
 
 	prom := prometheusx.MustServeMetrics()
 	defer prom.Close()
 
+	shutdown, err := tracing.Setup(mainCtx, tracingExporter)
+	rtx.Must(err, "Failed to set up tracing")
+	defer shutdown(context.Background())
+
 	storage, err := storage.NewClient(mainCtx)
 	rtx.Must(err, "Failed to create storage client")
 	defer storage.Close()
-	gcs := gcs.NewClient(storage, bucketNames, mlabBucket, gcsProject)
 
-	bqMain, err := bigquery.NewClient(mainCtx, bqProject)
-	rtx.Must(err, "Failed to create BigQuery client")
-	defer bqMain.Close()
+	sink, closeAudit, err := newAuditSink(mainCtx)
+	rtx.Must(err, "Failed to set up audit log")
+	defer closeAudit()
 
-	bqView := bqMain
-	if bqProject != viewProject {
-		bqView, err = bigquery.NewClient(mainCtx, viewProject)
-		rtx.Must(err, "Failed to create BigQuery view client")
-		defer bqView.Close()
+	store, err := newStateStore(mainCtx)
+	rtx.Must(err, "Failed to open state store")
+	if store != nil {
+		defer store.Close()
 	}
 
-	bq := bq.NewClient(bqMain, bqView)
-	hndlr := handler.NewClient(gcs, bq)
+	s, err := newServer(mainCtx, &shared{storage: storage, audit: sink, state: store}, loadConfig)
+	rtx.Must(err, "Failed to load config")
+
+	authn, err := newAuth()
+	rtx.Must(err, "Failed to set up authentication")
+	if authn == nil {
+		logging.FromContext(mainCtx).Warn("authentication disabled, all requests are allowed")
+	}
+	read := auth.Scope("read")
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/load", http.HandlerFunc(hndlr.Load))
+	mux.HandleFunc("/v1/load", authn.Require(s.loadScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v1.Load })))
+	mux.HandleFunc("/v1/datatypes", authn.Require(read, s.handle(func(d *deployment) http.HandlerFunc { return d.v1.Datatypes })))
+	mux.HandleFunc("/v1/status", authn.Require(read, s.handle(func(d *deployment) http.HandlerFunc { return d.v1.Status })))
+	mux.HandleFunc("/v1/backfills", authn.Require(backfillScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v1.Backfills })))
+	mux.HandleFunc("/v1/reconcile", authn.Require(reconcileScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v1.Reconcile })))
 
 	// V2 API.
-	gcsV2 := gcsv2.NewClient(storage, bucketNames)
-	hndlrV2 := handler.NewClient(gcsV2, bq)
-	mux.HandleFunc("/v2/load", http.HandlerFunc(hndlrV2.Load))
+	mux.HandleFunc("/v2/load", authn.Require(s.loadScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v2.Load })))
+	mux.HandleFunc("/v2/datatypes", authn.Require(read, s.handle(func(d *deployment) http.HandlerFunc { return d.v2.Datatypes })))
+	mux.HandleFunc("/v2/status", authn.Require(read, s.handle(func(d *deployment) http.HandlerFunc { return d.v2.Status })))
+	mux.HandleFunc("/v2/backfills", authn.Require(backfillScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v2.Backfills })))
+	mux.HandleFunc("/v2/reconcile", authn.Require(reconcileScope, s.handle(func(d *deployment) http.HandlerFunc { return d.v2.Reconcile })))
+
+	// Configuration reloads.
+	mux.HandleFunc("/admin/reload", authn.Require(auth.Scope("admin"), s.ReloadHandler))
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			s.Reload("sighup")
+		}
+	}()
+	if configFile != "" && configPoll > 0 {
+		go s.watch(mainCtx, configFile, configPoll)
+	}
 
 	srv := &http.Server{
 		Addr:    listenAddr,
-		Handler: mux,
+		Handler: tracing.Handler(mux),
 	}
 	rtx.Must(srv.ListenAndServe(), "Could not start HTTP server")
 	defer srv.Close()
 }
+
+// loadConfig returns the configuration from the -config file or, if not
+// given, from the legacy flags.
+func loadConfig() (*config.Config, error) {
+	if configFile != "" {
+		return config.Load(configFile)
+	}
+	cfg := config.FromFlags(bucketNames, mlabBucket, gcsProject, bqProject, viewProject)
+	if namingConfig != "" {
+		rules, err := api.LoadNamingRules(namingConfig)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Naming = rules
+	}
+	return cfg, nil
+}
+
+// loadScope returns the scope required by a load request (e.g., "load:daily",
+// or "load:custom" for a date range). Requests without a period load the
+// default period of each bucket, so they require "load:everything" if any
+// bucket defaults to it, and "load:default" otherwise.
+func (s *server) loadScope(r *http.Request) string {
+	period := handler.RequestPeriod(r.URL.Query())
+	if period != "default" {
+		return "load:" + period
+	}
+	s.mu.RLock()
+	periods := s.current.v1.Periods
+	s.mu.RUnlock()
+	for _, p := range periods {
+		if p == "everything" {
+			return "load:everything"
+		}
+	}
+	return "load:default"
+}
+
+// backfillScope returns the scope required by a backfills request: listing
+// them only reads, but cancelling them is an admin operation.
+func backfillScope(r *http.Request) string {
+	if r.Method == http.MethodGet {
+		return "read"
+	}
+	return "admin"
+}
+
+// reconcileScope returns the scope required by a reconcile request: reporting
+// gaps only reads, but loading them requires "load:reconcile".
+func reconcileScope(r *http.Request) string {
+	if r.URL.Query().Get("load") == "true" {
+		return "load:reconcile"
+	}
+	return "read"
+}
+
+// newAuth returns the authentication middleware configured by the -auth flags,
+// or nil if authentication is disabled.
+func newAuth() (*auth.Middleware, error) {
+	m := &auth.Middleware{}
+	if authTokens != "" {
+		tokens, err := auth.LoadTokens(authTokens)
+		if err != nil {
+			return nil, err
+		}
+		m.Authenticators = append(m.Authenticators, tokens)
+	}
+	if authIssuer != "" {
+		if authJWKS == "" {
+			return nil, errors.New("-auth-issuer requires -auth-jwks")
+		}
+		if authAudience == "" {
+			return nil, errors.New("-auth-issuer requires -auth-audience")
+		}
+		j := &auth.JWT{Issuer: authIssuer, Audience: authAudience, Leeway: time.Minute}
+		if strings.HasPrefix(authJWKS, "https://") {
+			j.Keys = auth.NewRemoteJWKS(authJWKS)
+		} else {
+			keys, err := auth.LoadJWKS(authJWKS)
+			if err != nil {
+				return nil, err
+			}
+			j.Keys = keys
+		}
+		if authCallers != "" {
+			callers, err := auth.LoadCallers(authCallers)
+			if err != nil {
+				return nil, err
+			}
+			j.Callers = callers
+		}
+		m.Authenticators = append(m.Authenticators, j)
+	}
+	if len(m.Authenticators) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// newAuditSink returns the audit sinks configured by the -audit flags, or nil
+// if there are none, along with a function closing them.
+func newAuditSink(ctx context.Context) (audit.Sink, func(), error) {
+	sinks := audit.Multi{}
+	closers := []func() error{}
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	if auditFile != "" {
+		f, err := audit.NewFileSink(auditFile)
+		if err != nil {
+			return nil, closeAll, err
+		}
+		sinks = append(sinks, f)
+		closers = append(closers, f.Close)
+	}
+	if auditTable != "" {
+		c, t, err := bigQueryTable(ctx, "-audit-table", auditTable)
+		if err != nil {
+			return nil, closeAll, err
+		}
+		closers = append(closers, c.Close)
+		b := audit.NewBigQuerySink(t)
+		if err := b.CreateTable(ctx); err != nil {
+			return nil, closeAll, err
+		}
+		sinks = append(sinks, b)
+	}
+	if len(sinks) == 0 {
+		return nil, closeAll, nil
+	}
+	return sinks, closeAll, nil
+}
+
+// newStateStore returns the state store configured by the -state flags, or nil
+// if there is none.
+func newStateStore(ctx context.Context) (state.Store, error) {
+	switch {
+	case stateTable != "":
+		c, t, err := bigQueryTable(ctx, "-state-table", stateTable)
+		if err != nil {
+			return nil, err
+		}
+		backfills := c.Dataset(t.DatasetID()).Table(t.TableID() + "_backfills")
+		s := state.NewBigQueryStore(c, t, backfills)
+		if err := s.CreateTable(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return &closingStore{Store: s, close: c.Close}, nil
+	case stateFile != "":
+		s, err := state.OpenBolt(stateFile)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, nil
+}
+
+// closingStore closes its BigQuery client along with the store.
+type closingStore struct {
+	state.Store
+	close func() error
+}
+
+func (s *closingStore) Close() error {
+	return errors.Join(s.Store.Close(), s.close())
+}
+
+// bigQueryTable returns a client for the project of a table given as
+// project.dataset.table in a flag, and a handle to the table.
+func bigQueryTable(ctx context.Context, flagName, name string) (bqiface.Client, bqiface.Table, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.New(flagName + " must be project.dataset.table")
+	}
+	c, err := bigquery.NewClient(ctx, parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	client := bqiface.AdaptClient(c)
+	return client, client.Dataset(parts[1]).Table(parts[2]), nil
+}
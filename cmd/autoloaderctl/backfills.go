@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/m-lab/autoloader/state"
+)
+
+func backfills(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("backfills")
+	cancel := fs.Bool("cancel", false, "Cancel the in-progress backfills of the selected datatypes")
+	discard := fs.Bool("discard", false, "With -cancel, also delete the checkpoints of the selected datatypes, so their next backfill starts over")
+	fs.Parse(args)
+	if c.server == "" {
+		return fmt.Errorf("backfills requires -server: backfills are only known to the server")
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if *discard && !*cancel {
+		return fmt.Errorf("-discard requires -cancel")
+	}
+
+	values := c.filter.Values()
+	var list []state.Backfill
+	if *cancel {
+		if *discard {
+			values.Set("discard", "true")
+		}
+		body, err := c.do(ctx, http.MethodDelete, "backfills", values)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return err
+		}
+		fmt.Printf("Cancelled %d backfills\n", len(list))
+	} else {
+		if err := c.getJSON(ctx, "backfills", values, &list); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATATYPE\tSTATUS\tNEXT\tLOADED\tSTARTED\tUPDATED\tERROR")
+	for _, b := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", b.Datatype, b.Status, b.Next, b.Loaded,
+			b.Started.Format(time.RFC3339), b.Updated.Format(time.RFC3339), b.Error)
+	}
+	w.Flush()
+	return nil
+}
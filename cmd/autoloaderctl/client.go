@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	autoconfig "github.com/m-lab/autoloader/config"
+	"github.com/m-lab/autoloader/deploy"
+	"github.com/m-lab/autoloader/handler"
+	"github.com/m-lab/go/flagx"
+)
+
+var errServerMode = errors.New("this command is not supported in server mode (unset -server)")
+
+// tokenEnv is the environment variable containing the token sent to the
+// server, if neither -token nor -token-file is set.
+const tokenEnv = "AUTOLOADER_TOKEN"
+
+// config holds the flags shared by all the commands.
+type config struct {
+	server    string
+	version   string
+	filter    handler.Filter
+	token     string
+	tokenFile string
+
+	// Direct mode.
+	configFile  string
+	bqProject   string
+	viewProject string
+	gcsProject  string
+	mlabBucket  string
+	buckets     flagx.StringArray
+	naming      string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *config) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	c := &config{}
+	fs.StringVar(&c.server, "server", "", "Autoloader base URL (e.g., http://localhost:8080). If empty, GCS and BigQuery are accessed directly.")
+	fs.StringVar(&c.version, "version", "v2", "Autoloader API version (v1 or v2)")
+	fs.StringVar(&c.token, "token", "", "Bearer token or JWT sent to the server (default $"+tokenEnv+")")
+	fs.StringVar(&c.tokenFile, "token-file", "", "File containing the bearer token or JWT sent to the server")
+	fs.StringVar(&c.filter.Experiment, "experiment", "", "Only include datatypes of this experiment")
+	fs.StringVar(&c.filter.Datatype, "datatype", "", "Only include datatypes with this name")
+	fs.StringVar(&c.filter.Organization, "organization", "", "Only include datatypes of this organization")
+	fs.StringVar(&c.configFile, "config", "", "The server's -config file describing the buckets to load. Replaces -buckets, -mlab-bucket, -naming-config and the project flags (direct mode)")
+	fs.StringVar(&c.bqProject, "bq-project", "mlab-sandbox", "BigQuery project (direct mode)")
+	fs.StringVar(&c.viewProject, "view-project", "mlab-sandbox", "BigQuery project for views (direct mode)")
+	fs.StringVar(&c.gcsProject, "gcs-project", "mlab-sandbox", "GCS project (direct mode)")
+	fs.StringVar(&c.mlabBucket, "mlab-bucket", "", "Archive bucket name containing data from M-Lab's platform (direct mode)")
+	fs.Var(&c.buckets, "buckets", "Archive bucket names in Google Cloud Storage (direct mode)")
+	fs.StringVar(&c.naming, "naming-config", "", "JSON file with the v2 naming rules (direct mode)")
+	return fs, c
+}
+
+func (c *config) validate() error {
+	if c.version != "v1" && c.version != "v2" {
+		return fmt.Errorf("invalid -version %q (want v1 or v2)", c.version)
+	}
+	if c.server == "" && len(c.buckets) == 0 && c.configFile == "" {
+		return errors.New("either -server, -config or -buckets is required")
+	}
+	if c.token != "" && c.tokenFile != "" {
+		return errors.New("-token and -token-file are mutually exclusive")
+	}
+	if c.tokenFile != "" {
+		b, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return err
+		}
+		c.token = strings.TrimSpace(string(b))
+	}
+	if c.token == "" {
+		c.token = os.Getenv(tokenEnv)
+	}
+	return nil
+}
+
+// authorize adds the token, if any, to a request to the server.
+func (c *config) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// get sends a GET request to the server endpoint and returns the response
+// body. It returns an error if the response status is not 200 OK.
+func (c *config) get(ctx context.Context, endpoint string, values url.Values) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, endpoint, values)
+}
+
+// do sends a request with the given method to the server endpoint and returns
+// the response body. It returns an error if the response status is not 200 OK.
+func (c *config) do(ctx context.Context, method, endpoint string, values url.Values) ([]byte, error) {
+	u := strings.TrimSuffix(c.server, "/") + "/" + c.version + "/" + endpoint
+	if len(values) != 0 {
+		u += "?" + values.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s\n%s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// getJSON sends a GET request to the server endpoint and decodes the JSON
+// response into v.
+func (c *config) getJSON(ctx context.Context, endpoint string, values url.Values, v any) error {
+	body, err := c.get(ctx, endpoint, values)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// direct holds the clients used in direct mode.
+type direct struct {
+	storage handler.StorageClient
+	// handler is configured like the server's handler of the API version.
+	handler *handler.Client
+	cfg     *autoconfig.Config
+	pool    *bq.Pool
+	closers []io.Closer
+}
+
+// newDirect creates the GCS and BigQuery clients used in direct mode, from
+// the -config file or, like the server, from the legacy flags.
+func (c *config) newDirect(ctx context.Context) (*direct, error) {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	sc, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d := &direct{cfg: cfg, pool: bq.NewPool(ctx)}
+	d.closers = append(d.closers, sc, d.pool)
+
+	v1, v2 := deploy.Handlers(sc, cfg, d.pool)
+	d.handler = v2
+	if c.version == "v1" {
+		d.handler = v1
+	}
+	d.storage = d.handler.StorageClient
+	return d, nil
+}
+
+// loadConfig returns the configuration from the -config file or, if not
+// given, from the legacy flags.
+func (c *config) loadConfig() (*autoconfig.Config, error) {
+	if c.configFile != "" {
+		return autoconfig.Load(c.configFile)
+	}
+	cfg := autoconfig.FromFlags(c.buckets, c.mlabBucket, c.gcsProject, c.bqProject, c.viewProject)
+	if c.naming != "" {
+		rules, err := api.LoadNamingRules(c.naming)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Naming = rules
+	}
+	return cfg, nil
+}
+
+// bq returns the BigQuery client of the datatype's destination projects.
+func (d *direct) bq(dt *api.Datatype) (*bq.Client, error) {
+	return d.pool.Client(d.cfg.Projects(dt.BucketName, dt.Organization))
+}
+
+// Close closes all the clients.
+func (d *direct) Close() error {
+	var errs []error
+	for _, c := range d.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-lab/autoloader/schema"
+	"google.golang.org/api/googleapi"
+)
+
+func diff(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("diff")
+	fs.Parse(args)
+	if c.server != "" {
+		return errServerMode
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	d, err := c.newDirect(ctx)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	datatypes, err := d.storage.GetDatatypes(ctx)
+	if err != nil {
+		fmt.Println("warning:", err)
+	}
+
+	for _, dt := range datatypes {
+		if !c.filter.Match(dt) {
+			continue
+		}
+		fmt.Printf("%s/%s (%s.%s):\n", dt.Experiment, dt.Name, dt.Dataset(), dt.Table())
+
+		next, err := bigquery.SchemaFromJSON(dt.Schema)
+		if err != nil {
+			fmt.Println("  invalid GCS schema:", err)
+			continue
+		}
+		client, err := d.bq(dt)
+		if err != nil {
+			return err
+		}
+		md, err := client.Dataset(dt.Dataset()).Table(dt.Table()).Metadata(ctx)
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
+			fmt.Println("  table does not exist; it will be created on the next load")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		changes := schema.Diff(md.Schema, next)
+		if len(changes) == 0 {
+			fmt.Println("  no changes")
+			continue
+		}
+		for _, ch := range changes {
+			fmt.Println(" ", ch)
+		}
+		if err := schema.Compatible(md.Schema, next); err != nil {
+			fmt.Printf("  incompatible with the BigQuery table:\n%v\n", err)
+		}
+	}
+	return nil
+}
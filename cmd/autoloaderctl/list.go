@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/handler"
+)
+
+func list(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("list")
+	asJSON := fs.Bool("json", false, "Print the datatypes as JSON")
+	fs.Parse(args)
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	resp, err := c.datatypes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "EXPERIMENT\tDATATYPE\tORGANIZATION\tBUCKET\tTABLE\tVIEW\tSCHEMA UPDATED")
+	for _, dt := range resp.Datatypes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s.%s\t%s.%s\t%s\n", dt.Experiment, dt.Name, dt.Organization,
+			dt.Bucket, dt.Dataset, dt.Table, dt.ViewDataset, dt.ViewTable, dt.SchemaUpdated.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+
+	for _, e := range resp.Errors {
+		fmt.Fprintln(os.Stderr, "warning:", e)
+	}
+	return nil
+}
+
+// datatypes returns the datatypes selected by the filter, either from the
+// server or directly from GCS.
+func (c *config) datatypes(ctx context.Context) (*handler.DatatypesResponse, error) {
+	resp := &handler.DatatypesResponse{}
+	if c.server != "" {
+		err := c.getJSON(ctx, "datatypes", c.filter.Values(), resp)
+		return resp, err
+	}
+
+	d, err := c.newDirect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	datatypes, err := d.storage.GetDatatypes(ctx)
+	if err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	datatypes, err = api.CheckCollisions(datatypes, nil)
+	if err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	for _, dt := range datatypes {
+		if c.filter.Match(dt) {
+			resp.Datatypes = append(resp.Datatypes, handler.NewDatatypeInfo(dt))
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/m-lab/autoloader/handler"
+)
+
+func load(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("load")
+	period := fs.String("period", "", "Load period (daily, monthly, annually or everything)")
+	start := fs.String("start", "", "Start date (YYYY/MM/DD, inclusive). Requires -end.")
+	end := fs.String("end", "", "End date (YYYY/MM/DD, exclusive). Requires -start.")
+	runID := fs.String("run-id", "", "Run ID to use for the load (generated by the server if empty)")
+	fs.Parse(args)
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	values := c.filter.Values()
+	switch {
+	case *start != "" && *end != "":
+		values.Set("start", *start)
+		values.Set("end", *end)
+	case *start != "" || *end != "":
+		return errors.New("-start and -end must be specified together")
+	case *period != "":
+		values.Set("period", *period)
+	default:
+		return errors.New("either -period or -start and -end are required")
+	}
+
+	var id, body string
+	var err error
+	if c.server != "" {
+		id, body, err = c.loadServer(ctx, values, *runID)
+	} else {
+		id, body, err = c.loadDirect(ctx, values, *runID)
+	}
+	if id != "" {
+		fmt.Println("run:", id)
+	}
+	if body != "" {
+		fmt.Println(body)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func (c *config) loadServer(ctx context.Context, values url.Values, runID string) (string, string, error) {
+	u := strings.TrimSuffix(c.server, "/") + "/" + c.version + "/load?" + values.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	c.authorize(req)
+	if runID != "" {
+		req.Header.Set(handler.RunIDHeader, runID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	return result(resp)
+}
+
+// loadDirect runs the load handler in-process, so the load behaves exactly
+// as it would on the server.
+func (c *config) loadDirect(ctx context.Context, values url.Values, runID string) (string, string, error) {
+	d, err := c.newDirect(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	defer d.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/load?"+values.Encode(), nil).WithContext(ctx)
+	if runID != "" {
+		req.Header.Set(handler.RunIDHeader, runID)
+	}
+	rec := httptest.NewRecorder()
+	d.handler.Load(rec, req)
+	return result(rec.Result())
+}
+
+// result returns the run ID and body of a load response, and an error if the
+// load failed.
+func result(resp *http.Response) (string, string, error) {
+	defer resp.Body.Close()
+	id := resp.Header.Get(handler.RunIDHeader)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return id, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return id, string(body), fmt.Errorf("load failed: %s", resp.Status)
+	}
+	return id, string(body), nil
+}
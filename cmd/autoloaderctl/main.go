@@ -0,0 +1,77 @@
+// autoloaderctl is the operator CLI for the autoloader.
+//
+// It talks to a running autoloader over its HTTP API (-server) or, in direct
+// mode, reads GCS and BigQuery configured like the server (see -config).
+//
+// Usage:
+//
+//	autoloaderctl <command> [flags]
+//
+// Commands:
+//
+//	list       List the discovered datatypes and their BigQuery names.
+//	load       Load a (filtered) set of datatypes for a period or date range.
+//	status     Show the status of the most recent load runs (server mode only).
+//	backfills  List or cancel the backfills of complete histories (server mode only).
+//	diff       Diff the GCS schemas against the BigQuery tables (direct mode only).
+//	missing    Show the GCS partitions missing in BigQuery (reconcile -kind missing).
+//	reconcile  Show (and optionally load) the gaps between GCS and BigQuery partitions.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	help string
+	run  func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"list":      {"List the discovered datatypes and their BigQuery names.", list},
+	"load":      {"Load a (filtered) set of datatypes for a period or date range.", load},
+	"status":    {"Show the status of the most recent load runs (server mode only).", status},
+	"backfills": {"List or cancel the backfills of complete histories (server mode only).", backfills},
+	"diff":      {"Diff the GCS schemas against the BigQuery tables (direct mode only).", diff},
+	"missing":   {"Show the GCS partitions missing in BigQuery (reconcile -kind missing).", missing},
+	"reconcile": {"Show (and optionally load) the gaps between GCS and BigQuery partitions.", reconcile},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: autoloaderctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'autoloaderctl <command> -h' for the flags of each command.")
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(context.Background(), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/m-lab/autoloader/handler"
+	"github.com/m-lab/go/timex"
+)
+
+func reconcile(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("reconcile")
+	start, end := rangeFlags(fs)
+	load := fs.Bool("load", false, "Load the missing and stale partitions")
+	kind := fs.String("kind", "", "Only show the gaps of this kind (missing, extra or stale)")
+	fs.Parse(args)
+	return c.reconcile(ctx, *start, *end, *load, *kind)
+}
+
+// missing shows the missing gaps of reconcile.
+func missing(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("missing")
+	start, end := rangeFlags(fs)
+	fs.Parse(args)
+	return c.reconcile(ctx, *start, *end, false, handler.GapMissing)
+}
+
+// rangeFlags adds the flags of the date range to reconcile, the last 30 days
+// by default.
+func rangeFlags(fs *flag.FlagSet) (start, end *string) {
+	now := time.Now().UTC()
+	start = fs.String("start", now.AddDate(0, 0, -30).Format(timex.YYYYMMDDWithSlash), "Start date (YYYY/MM/DD, inclusive)")
+	end = fs.String("end", now.AddDate(0, 0, 1).Format(timex.YYYYMMDDWithSlash), "End date (YYYY/MM/DD, exclusive)")
+	return start, end
+}
+
+// reconcile prints the gaps of the date range, only those of the kind if it
+// is not empty, and loads them if load is true.
+func (c *config) reconcile(ctx context.Context, start, end string, load bool, kind string) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	values := c.filter.Values()
+	values.Set("start", start)
+	values.Set("end", end)
+	if load {
+		values.Set("load", "true")
+	}
+
+	var body []byte
+	var err error
+	if c.server != "" {
+		body, err = c.get(ctx, "reconcile", values)
+	} else {
+		body, err = c.reconcileDirect(ctx, values)
+	}
+	if err != nil {
+		return err
+	}
+	var resp handler.ReconcileResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+
+	if resp.RunID != "" {
+		fmt.Println("run:", resp.RunID)
+	}
+	for _, r := range resp.Datatypes {
+		gaps := make([]handler.Gap, 0, len(r.Gaps))
+		for _, g := range r.Gaps {
+			if kind == "" || g.Kind == kind {
+				gaps = append(gaps, g)
+			}
+		}
+		dt := r.Datatype
+		fmt.Printf("%s/%s (%s.%s): %d dirs, %d partitions, %d gaps\n", dt.Experiment, dt.Name,
+			dt.Dataset, dt.Table, r.Dirs, r.Partitions, len(gaps))
+		for _, g := range gaps {
+			line := fmt.Sprintf("  %s %-7s rows=%d", g.Partition, g.Kind, g.Rows)
+			switch {
+			case g.Loaded:
+				line += " loaded"
+			case g.Error != "":
+				line += " error: " + g.Error
+			}
+			fmt.Println(line)
+		}
+	}
+	for _, v := range resp.Violations {
+		fmt.Println("violation:", v)
+	}
+	for _, e := range resp.Errors {
+		fmt.Println("error:", e)
+	}
+	if len(resp.Errors) != 0 {
+		return errors.New("reconcile failed")
+	}
+	return nil
+}
+
+// reconcileDirect runs the reconcile handler in-process.
+func (c *config) reconcileDirect(ctx context.Context, values url.Values) ([]byte, error) {
+	d, err := c.newDirect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/reconcile?"+values.Encode(), nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	d.handler.Reconcile(rec, req)
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("reconcile failed: %s", rec.Body.String())
+	}
+	return rec.Body.Bytes(), nil
+}
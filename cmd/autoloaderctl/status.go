@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/m-lab/autoloader/handler"
+)
+
+func status(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("status")
+	runID := fs.String("run", "", "Only show the run with this ID, including its errors")
+	fs.Parse(args)
+	if c.server == "" {
+		return fmt.Errorf("status requires -server: runs are only known to the server")
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	values := url.Values{}
+	if *runID != "" {
+		values.Set("run", *runID)
+	}
+	var runs []handler.Run
+	if err := c.getJSON(ctx, "status", values, &runs); err != nil {
+		return err
+	}
+	if *runID != "" && len(runs) == 0 {
+		return fmt.Errorf("run %q not found", *runID)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTATUS\tPERIOD\tSTART\tEND\tSTARTED\tDURATION\tDATATYPES\tERRORS")
+	for _, r := range runs {
+		duration := "-"
+		if r.Finished != nil {
+			duration = r.Finished.Sub(r.Started).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", r.ID, r.Status, r.Period, r.Start, r.End,
+			r.Started.Format(time.RFC3339), duration, r.Datatypes, len(r.Errors))
+	}
+	w.Flush()
+
+	if *runID != "" {
+		for _, e := range runs[0].Errors {
+			fmt.Println(e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/storage"
+)
+
+// summary counts the deleted resources and records the failures.
+type summary struct {
+	objects    int
+	backups    int
+	snapshots  int
+	partitions int
+	tables     int
+	views      int
+	failures   []string
+}
+
+func (s *summary) fail(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Println("ERROR:", msg)
+	s.failures = append(s.failures, msg)
+}
+
+func (s *summary) print() {
+	log.Println("Summary:")
+	log.Printf("\tGCS objects deleted: %d (backed up: %d)", s.objects, s.backups)
+	log.Printf("\tBigQuery snapshots created: %d", s.snapshots)
+	log.Printf("\tBigQuery partitions deleted: %d", s.partitions)
+	log.Printf("\tBigQuery tables deleted: %d", s.tables)
+	log.Printf("\tBigQuery views deleted: %d", s.views)
+	log.Printf("\tFailures: %d", len(s.failures))
+	for _, f := range s.failures {
+		log.Println("\t\t" + f)
+	}
+}
+
+func (s *summary) exitCode() int {
+	if len(s.failures) != 0 {
+		return 1
+	}
+	return 0
+}
+
+// execute deletes the planned resources. Resources whose backup fails are not
+// deleted.
+func (p *planner) execute(ctx context.Context) {
+	for _, o := range p.objects {
+		if backup {
+			if err := backupObject(ctx, p.storage, o); err != nil {
+				p.summary.fail("back up gs://%s/%s: %v", o.bucketName, o.name, err)
+				continue
+			}
+			p.summary.backups++
+		}
+		if err := o.bucket.Object(o.name).Delete(ctx); err != nil {
+			p.summary.fail("delete gs://%s/%s: %v", o.bucketName, o.name, err)
+			continue
+		}
+		p.summary.objects++
+	}
+
+	for _, t := range p.tables {
+		p.deleteTable(ctx, t)
+	}
+}
+
+func (p *planner) deleteTable(ctx context.Context, t *table) {
+	ds := t.client.Dataset(t.dataset)
+
+	if t.view {
+		// Views hold no data; keep their definition in the logs.
+		log.Printf("BigQuery\tview %s query:\n%s", t, t.viewQuery)
+		if err := ds.Table(t.name).Delete(ctx); err != nil {
+			p.summary.fail("delete %s: %v", t, err)
+			return
+		}
+		p.summary.views++
+		return
+	}
+
+	if backup {
+		if err := snapshot(ctx, ds, t.name); err != nil {
+			p.summary.fail("snapshot %s: %v", t, err)
+			return
+		}
+		p.summary.snapshots++
+	}
+
+	if len(t.partitions) == 0 {
+		if err := ds.Table(t.name).Delete(ctx); err != nil {
+			p.summary.fail("delete %s: %v", t, err)
+			return
+		}
+		p.summary.tables++
+		return
+	}
+
+	for _, id := range t.partitions {
+		if err := ds.Table(t.name + "$" + id).Delete(ctx); err != nil {
+			p.summary.fail("delete %s$%s: %v", t, id, err)
+			continue
+		}
+		p.summary.partitions++
+	}
+}
+
+// backupObject copies a GCS object under the backup prefix.
+func backupObject(ctx context.Context, client *storage.Client, o object) error {
+	dst := o.bucket
+	if backupBucket != "" {
+		dst = client.Bucket(backupBucket)
+	}
+	name := path.Join(backupPrefix, o.bucketName, o.name)
+	_, err := dst.Object(name).CopierFrom(o.bucket.Object(o.name)).Run(ctx)
+	return err
+}
+
+// snapshot creates a snapshot of a table in the same dataset, which expires
+// after -snapshot-ttl.
+func snapshot(ctx context.Context, ds *bigquery.Dataset, name string) error {
+	dst := ds.Table(name + "_snapshot_" + purgeID)
+	copier := dst.CopierFrom(ds.Table(name))
+	copier.OperationType = bigquery.SnapshotOperation
+	job, err := copier.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Err() != nil {
+		return status.Err()
+	}
+	log.Printf("BigQuery\tsnapshot: %s.%s.%s", ds.ProjectID, ds.DatasetID, dst.TableID)
+
+	if snapshotTTL == 0 {
+		return nil
+	}
+	_, err = dst.Update(ctx, bigquery.TableMetadataToUpdate{
+		ExpirationTime: time.Now().Add(snapshotTTL),
+	}, "")
+	return err
+}
@@ -1,35 +1,101 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	gcsv2 "github.com/m-lab/autoloader/gcs/v2"
 	"github.com/m-lab/go/flagx"
-	"github.com/m-lab/go/storagex"
+	"github.com/m-lab/go/timex"
 
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/storage"
 )
 
 var (
-	datatypes = flagx.StringArray{}
-	project   string
-	dryrun    bool
+	datatypes    = flagx.StringArray{}
+	buckets      = flagx.StringArray{}
+	project      string
+	viewProject  string
+	mlabBucket   string
+	version      string
+	organization string
+	sharedSchema bool
+	deleteView   bool
+	namingConfig string
+	naming       api.NamingRules
+	start        string
+	end          string
+	backup       bool
+	backupBucket string
+	backupPrefix string
+	snapshotTTL  time.Duration
+	yes          bool
+	dryrun       bool
+
+	// purgeID identifies the backups created by this purge.
+	purgeID = time.Now().UTC().Format("20060102T150405")
 )
 
 func init() {
 	flag.StringVar(&project, "project", "mlab-sandbox", "Operate on the given project.")
+	flag.StringVar(&viewProject, "view-project", "", "Project containing the views (defaults to -project).")
+	flag.StringVar(&mlabBucket, "mlab-bucket", "", "v1 only: archive bucket containing data from M-Lab's platform. Datatypes in other buckets use third-party naming. If empty, all datatypes use M-Lab naming.")
+	flag.StringVar(&version, "version", "v1", "Autoload version of the datatypes (v1 or v2).")
+	flag.StringVar(&organization, "organization", "mlab", "v2 only: organization uploading the datatypes.")
+	flag.StringVar(&namingConfig, "naming-config", "", "v2 only: JSON file with the naming rules used by the autoloader.")
+	flag.BoolVar(&sharedSchema, "shared-schema", false, "v2 only: also delete the out-of-band schema file shared by all organizations.")
+	flag.BoolVar(&deleteView, "delete-view", false, "v2 only: also delete the view, which is shared by all organizations of the sub-project.")
+	flag.StringVar(&start, "start", "", "Only purge dates from this day (YYYY/MM/DD, inclusive). Requires -end. Schemas, tables and views are kept.")
+	flag.StringVar(&end, "end", "", "Only purge dates until this day (YYYY/MM/DD, exclusive). Requires -start.")
+	flag.BoolVar(&backup, "backup", true, "Snapshot tables and copy GCS objects to -backup-prefix before deleting them.")
+	flag.StringVar(&backupBucket, "backup-bucket", "", "Bucket to copy GCS objects to (defaults to the bucket of each object).")
+	flag.StringVar(&backupPrefix, "backup-prefix", "purge-backup/"+purgeID, "Prefix to copy GCS objects under.")
+	flag.DurationVar(&snapshotTTL, "snapshot-ttl", 30*24*time.Hour, "Expiration of the table snapshots. Zero means no expiration.")
+	flag.BoolVar(&yes, "yes", false, "Do not ask for confirmation before deleting.")
 	flag.BoolVar(&dryrun, "dryrun", true, "Take no action.")
 	flag.Var(&datatypes, "datatype", "The experiment/datatype to delete from GCS and BQ.")
+	flag.Var(&buckets, "buckets", "Buckets to delete data from (defaults to pusher-<project> and archive-<project>).")
 }
 
 func main() {
 	flag.Parse()
 	flagx.ArgsFromEnv(flag.CommandLine)
 
+	if version != "v1" && version != "v2" {
+		log.Fatalf("invalid -version %q (want v1 or v2)", version)
+	}
+	if (start == "") != (end == "") {
+		log.Fatal("-start and -end must be specified together")
+	}
+	for _, d := range []string{start, end} {
+		if _, err := time.Parse(timex.YYYYMMDDWithSlash, d); d != "" && err != nil {
+			log.Fatalf("invalid date %q (want YYYY/MM/DD)", d)
+		}
+	}
+	if namingConfig != "" {
+		var err error
+		naming, err = api.LoadNamingRules(namingConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if viewProject == "" {
+		viewProject = project
+	}
+	if len(buckets) == 0 {
+		buckets = flagx.StringArray{"pusher-" + project, "archive-" + project}
+	}
+
 	ctx := context.Background()
 	sclient, err := storage.NewClient(ctx)
 	if err != nil {
@@ -43,58 +109,104 @@ func main() {
 	}
 	defer bqclient.Close()
 
+	viewclient := bqclient
+	if viewProject != project {
+		viewclient, err = bigquery.NewClient(ctx, viewProject)
+		if err != nil {
+			panic(err)
+		}
+		defer viewclient.Close()
+	}
+
 	if dryrun {
 		log.Println("NOTE:")
 		log.Println("NOTE: dryrun mode! Use -dryrun=false to delete data.")
 		log.Println("NOTE:")
 	}
 
+	p := &planner{
+		storage: sclient,
+		bq:      bqclient,
+		view:    viewclient,
+		parts:   bq.NewClient(bqclient, viewclient),
+	}
 	for _, dt := range datatypes {
 		fields := strings.Split(dt, "/")
 		if len(fields) != 2 {
 			log.Printf("wrong datatype format; skipping %q", dt)
 			continue
 		}
-		log.Printf("Removing: %s", dt)
-		exp, datatype := fields[0], fields[1]
-		b := storagex.NewBucket(sclient.Bucket("pusher-" + project))
-		deleteObjects(ctx, b, fmt.Sprintf("autoload/v1/tables/%s/%s.table.json", exp, datatype))
-		deleteObjects(ctx, b, fmt.Sprintf("autoload/v1/%s/%s", exp, datatype))
-
-		b = storagex.NewBucket(sclient.Bucket("archive-" + project))
-		deleteObjects(ctx, b, fmt.Sprintf("autoload/v1/tables/%s/%s.table.json", exp, datatype))
-		deleteObjects(ctx, b, fmt.Sprintf("autoload/v1/%s/%s", exp, datatype))
+		log.Printf("Planning: %s", dt)
+		opts := api.DatatypeOpts{
+			Name:         fields[1],
+			Experiment:   fields[0],
+			Organization: organization,
+			Version:      version,
+		}
+		for _, name := range buckets {
+			d, err := newDatatype(name, opts)
+			if err != nil {
+				p.summary.fail("name %s in %s: %v", dt, name, err)
+				continue
+			}
+			p.add(ctx, d, name)
+		}
+	}
 
-		deleteTable(ctx, bqclient, "raw_"+exp, datatype)
+	p.print()
+	if dryrun {
+		p.summary.print()
+		os.Exit(p.summary.exitCode())
+	}
+	if !yes && !confirm() {
+		log.Println("Aborted.")
+		os.Exit(1)
 	}
 
-	if !dryrun {
-		log.Println("WARNING:")
-		log.Println("WARNING: active storage transfer jobs may recreate files just removed from the archive bucket")
-		log.Println("WARNING:")
+	p.execute(ctx)
+	p.summary.print()
+
+	log.Println("WARNING:")
+	log.Println("WARNING: active storage transfer jobs may recreate files just removed from the archive bucket")
+	log.Println("WARNING:")
+	os.Exit(p.summary.exitCode())
+}
+
+// newDatatype returns the datatype stored in the given bucket, using the same
+// naming conventions as the autoloader.
+func newDatatype(bucket string, opts api.DatatypeOpts) (*api.Datatype, error) {
+	opts.BucketName = bucket
+	if version == "v2" {
+		return gcsv2.NewDatatypeFromRules(naming, bucket, opts)
+	}
+	if mlabBucket == "" || bucket == mlabBucket {
+		return api.NewMlabDatatype(opts), nil
 	}
+	return api.NewThirdPartyDatatype(opts, project), nil
 }
 
-func deleteObjects(ctx context.Context, bucket *storagex.Bucket, path string) error {
-	attrs, err := bucket.Attrs(ctx)
-	if err != nil {
-		return err
+// dataPath returns the GCS path containing the data of a datatype.
+func dataPath(dt *api.Datatype) string {
+	if version == "v1" {
+		return gcs.DataPath(dt)
 	}
-	log.Println("GCS", attrs.Name)
-	return bucket.Walk(ctx, path, func(o *storagex.Object) error {
-		log.Println("\tdelete:", o.ObjectName())
-		if dryrun {
-			return nil
-		}
-		return o.Delete(ctx)
-	})
+	return gcsv2.DataPath(dt)
 }
-func deleteTable(ctx context.Context, client *bigquery.Client, dataset, table string) error {
-	t := client.Dataset(dataset).Table(table)
-	log.Println("BigQuery", client.Project())
-	log.Println("\tdelete:", t.DatasetID, t.TableID)
-	if dryrun {
-		return nil
+
+// schemaPaths returns the GCS paths of the schema files of a datatype.
+func schemaPaths(dt *api.Datatype) []string {
+	if version == "v1" {
+		return []string{gcs.SchemaFile(dt)}
 	}
-	return t.Delete(ctx)
+	if sharedSchema {
+		return []string{gcsv2.SchemaFile(dt), gcsv2.SharedSchemaFile(dt)}
+	}
+	return []string{gcsv2.SchemaFile(dt)}
+}
+
+// confirm asks the operator to confirm the deletion.
+func confirm() bool {
+	fmt.Fprint(os.Stderr, "Type 'yes' to delete the resources listed above: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/storage"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// object is a GCS object to delete.
+type object struct {
+	bucket     *storage.BucketHandle
+	bucketName string
+	name       string
+}
+
+// table is a BigQuery table or view to delete. If partitions is not empty,
+// only those partitions are deleted.
+type table struct {
+	client     *bigquery.Client
+	dataset    string
+	name       string
+	view       bool
+	viewQuery  string
+	partitions []string
+}
+
+func (t *table) String() string {
+	return fmt.Sprintf("%s.%s.%s", t.client.Project(), t.dataset, t.name)
+}
+
+// planner collects the resources to delete before deleting any of them.
+type planner struct {
+	storage *storage.Client
+	bq      *bigquery.Client
+	view    *bigquery.Client
+	parts   *bq.Client
+
+	objects []object
+	tables  []*table
+	seen    map[string]bool
+	summary summary
+}
+
+// add plans the deletion of the datatype's objects in the given bucket, and of
+// its table and view.
+func (p *planner) add(ctx context.Context, dt *api.Datatype, bucket string) {
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+
+	data := dataPath(dt) + "/"
+	if start != "" {
+		p.addObjects(ctx, bucket, &storage.Query{
+			Prefix:      data,
+			StartOffset: path.Join(data, start),
+			EndOffset:   path.Join(data, end),
+		})
+	} else {
+		for _, s := range schemaPaths(dt) {
+			// Only match the schema file itself, not other objects sharing its name
+			// as a prefix.
+			p.addObjects(ctx, bucket, &storage.Query{Prefix: s, EndOffset: s + "\x00"})
+		}
+		p.addObjects(ctx, bucket, &storage.Query{Prefix: data})
+	}
+
+	// Tables and views are shared by the datatype in all buckets (e.g., pusher
+	// and archive), so only delete them once.
+	p.addTable(ctx, &table{client: p.bq, dataset: dt.Dataset(), name: dt.Table()})
+	if start == "" {
+		p.addView(ctx, &table{client: p.view, dataset: dt.ViewDataset(), name: dt.ViewTable(), view: true})
+	}
+}
+
+// addView plans the deletion of a datatype's view. v2 views are shared by all
+// the organizations of a sub-project, so they are only deleted with
+// -delete-view.
+func (p *planner) addView(ctx context.Context, t *table) {
+	if version == "v1" {
+		p.addTable(ctx, t)
+		return
+	}
+	if p.seen[t.String()] {
+		return
+	}
+	if !deleteView {
+		p.seen[t.String()] = true
+		log.Printf("BigQuery view %s is shared by all organizations; keeping it (use -delete-view to delete it)", t)
+		return
+	}
+	log.Printf("WARNING: BigQuery view %s is shared by all organizations; other organizations will lose access to their data through it", t)
+	p.addTable(ctx, t)
+}
+
+func (p *planner) addObjects(ctx context.Context, bucket string, q *storage.Query) {
+	bh := p.storage.Bucket(bucket)
+	it := bh.Objects(ctx, q)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			p.summary.fail("list gs://%s/%s: %v", bucket, q.Prefix, err)
+			return
+		}
+		if strings.HasSuffix(attrs.Name, "/") {
+			continue
+		}
+		p.objects = append(p.objects, object{bucket: bh, bucketName: bucket, name: attrs.Name})
+	}
+}
+
+func (p *planner) addTable(ctx context.Context, t *table) {
+	if p.seen[t.String()] {
+		return
+	}
+	p.seen[t.String()] = true
+
+	md, err := t.client.Dataset(t.dataset).Table(t.name).Metadata(ctx)
+	if isNotFound(err) {
+		log.Printf("BigQuery %s does not exist; skipping", t)
+		return
+	}
+	if err != nil {
+		p.summary.fail("get %s: %v", t, err)
+		return
+	}
+	if t.view {
+		t.viewQuery = md.ViewQuery
+	}
+
+	if start != "" {
+		parts, err := p.parts.Partitions(ctx, t.dataset, t.name)
+		if err != nil {
+			p.summary.fail("list partitions of %s: %v", t, err)
+			return
+		}
+		first, last := strings.ReplaceAll(start, "/", ""), strings.ReplaceAll(end, "/", "")
+		for id := range parts {
+			if id >= first && id < last {
+				t.partitions = append(t.partitions, id)
+			}
+		}
+		if len(t.partitions) == 0 {
+			return
+		}
+		sort.Strings(t.partitions)
+	}
+	p.tables = append(p.tables, t)
+}
+
+// print logs the resources that will be deleted.
+func (p *planner) print() {
+	for _, o := range p.objects {
+		log.Printf("GCS\tdelete: gs://%s/%s", o.bucketName, o.name)
+	}
+	for _, t := range p.tables {
+		switch {
+		case t.view:
+			log.Printf("BigQuery\tdelete view: %s", t)
+		case len(t.partitions) != 0:
+			log.Printf("BigQuery\tdelete %d partitions: %s$%s..%s", len(t.partitions), t, t.partitions[0], t.partitions[len(t.partitions)-1])
+		default:
+			log.Printf("BigQuery\tdelete table: %s", t)
+		}
+	}
+	if backup {
+		log.Printf("Backups: tables will be snapshotted and objects copied under %q", backupPrefix)
+	} else {
+		log.Println("Backups: disabled")
+	}
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
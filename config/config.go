@@ -0,0 +1,456 @@
+// Package config describes the buckets served by an autoloader deployment and
+// how each of them is loaded to BigQuery.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/m-lab/autoloader/api"
+	"gopkg.in/yaml.v3"
+)
+
+// Bucket naming conventions for v1 datatypes.
+const (
+	NamingMlab       = "mlab"
+	NamingThirdParty = "thirdparty"
+)
+
+// Config is the configuration of an autoloader deployment.
+type Config struct {
+	// Buckets contains the archive buckets to load data from.
+	Buckets []Bucket `json:"buckets"`
+	// Naming contains the v2 naming rules for the buckets or projects that do
+	// not use the default naming conventions.
+	Naming api.NamingRules `json:"naming,omitempty"`
+	// RegisteredOrganizations contains the organizations accepted by buckets
+	// with VerifyOrganizations.
+	RegisteredOrganizations []string `json:"registered_organizations,omitempty"`
+}
+
+// Bucket describes an archive bucket and how its datatypes are loaded.
+type Bucket struct {
+	Name string `json:"name"`
+	// Versions contains the autoload versions of the bucket ("v1" and/or "v2").
+	Versions []string `json:"versions"`
+	// Naming is the v1 naming convention ("mlab" or "thirdparty"). Defaults to
+	// "thirdparty".
+	Naming string `json:"naming,omitempty"`
+	// GCSProject is the project the bucket belongs to. v1 third-party views are
+	// named after it.
+	GCSProject string `json:"gcs_project,omitempty"`
+	// BQProject is the BigQuery project for the raw tables.
+	BQProject string `json:"bq_project"`
+	// ViewProject is the BigQuery project for the views. Defaults to BQProject.
+	ViewProject string `json:"view_project,omitempty"`
+	// Organizations restricts the v2 organizations loaded from the bucket. If
+	// empty, all organizations are loaded. Other organizations found in the
+	// bucket are reported as errors.
+	Organizations []string `json:"organizations,omitempty"`
+	// DenyOrganizations contains v2 organizations that are never loaded from
+	// the bucket.
+	DenyOrganizations []string `json:"deny_organizations,omitempty"`
+	// VerifyOrganizations requires the v2 organizations in the bucket to be
+	// registered (see Config.RegisteredOrganizations). Unregistered
+	// organizations are reported as errors.
+	VerifyOrganizations bool `json:"verify_organizations,omitempty"`
+	// Destinations overrides the BigQuery projects for some v2 organizations.
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Load contains the default load options.
+	Load LoadDefaults `json:"load,omitempty"`
+	// Verify contains the checks of the rows loaded to each partition. If
+	// empty, loads are not verified.
+	Verify Verify `json:"verify,omitempty"`
+}
+
+// Destination contains the BigQuery projects for an organization's datatypes.
+type Destination struct {
+	Organization string `json:"organization"`
+	// BQProject is the BigQuery project for the raw tables.
+	BQProject string `json:"bq_project"`
+	// ViewProject is the BigQuery project for the views. Defaults to the
+	// bucket's view project.
+	ViewProject string `json:"view_project,omitempty"`
+}
+
+// LoadDefaults contains the load options used when a request does not
+// specify them.
+type LoadDefaults struct {
+	// Period is the period loaded when a request specifies neither a period
+	// nor a date range (e.g., "daily").
+	Period string `json:"period,omitempty"`
+	// Staging loads each partition to a staging table first, and replaces the
+	// partition only once the staged data load with the table's schema and
+	// pass the row and query checks (see Verify). It applies to the truncate and replace modes;
+	// merges are always staged.
+	Staging bool `json:"staging,omitempty"`
+	// LoadMode is the load mode of the bucket's datatypes.
+	LoadMode
+	// Datatypes overrides the bucket's load mode for some datatypes.
+	Datatypes []DatatypeLoad `json:"datatypes,omitempty"`
+}
+
+// LoadMode is how the directories of a datatype are written to its table.
+type LoadMode struct {
+	// Mode is "truncate" (the default) to replace each day's partition,
+	// "append" to append the files of each day not loaded before, "merge" to
+	// upsert the rows of each day on Key, or "replace" to replace the whole
+	// table (whose schema has no date field) with the most recent day.
+	Mode string `json:"mode,omitempty"`
+	// Key lists the fields identifying a row, in merge mode.
+	Key []string `json:"key,omitempty"`
+}
+
+// DatatypeLoad contains the load mode of a datatype.
+type DatatypeLoad struct {
+	// Experiment restricts the override to a datatype of this experiment. If
+	// empty, it applies to datatypes of the name in every experiment.
+	Experiment string `json:"experiment,omitempty"`
+	Datatype   string `json:"datatype"`
+	LoadMode
+}
+
+// RowChecks are the expectations on the number of rows loaded to a
+// partition. Zero values disable the checks.
+type RowChecks struct {
+	// MinRows is the minimum number of rows of a partition (e.g., 1 to flag
+	// empty partitions).
+	MinRows int64 `json:"min_rows,omitempty"`
+	// MaxDrop is the largest fraction (between 0 and 1) by which the rows of a
+	// partition may drop below those of the previous day.
+	MaxDrop float64 `json:"max_drop,omitempty"`
+	// Manifest requires the rows of a partition to match the lines recorded
+	// in the metadata of its source objects, if they all record them.
+	Manifest bool `json:"manifest,omitempty"`
+}
+
+// QueryCheck is a custom check of the staged data of a partition, which fails
+// if the query returns any rows. "{table}" in the query is replaced by the
+// staging table (e.g., "SELECT id FROM {table} WHERE id IS NULL LIMIT 1").
+type QueryCheck struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// Verify contains the row checks of a bucket's datatypes.
+type Verify struct {
+	RowChecks
+	// Queries are checked only by staged loads (see LoadDefaults.Staging).
+	Queries []QueryCheck `json:"queries,omitempty"`
+	// Datatypes overrides the bucket's checks for some datatypes.
+	Datatypes []DatatypeChecks `json:"datatypes,omitempty"`
+}
+
+// DatatypeChecks contains the row checks of a datatype.
+type DatatypeChecks struct {
+	// Experiment restricts the override to a datatype of this experiment. If
+	// empty, it applies to datatypes of the name in every experiment.
+	Experiment string `json:"experiment,omitempty"`
+	Datatype   string `json:"datatype"`
+	RowChecks
+	Queries []QueryCheck `json:"queries,omitempty"`
+}
+
+var (
+	versions = map[string]bool{"v1": true, "v2": true}
+	namings  = map[string]bool{"": true, NamingMlab: true, NamingThirdParty: true}
+	modes    = map[string]bool{"": true, "truncate": true, "append": true, "merge": true, "replace": true}
+	periods  = map[string]bool{"": true, "daily": true, "monthly": true, "annually": true, "everything": true}
+)
+
+// Load reads a YAML or JSON configuration file, applies the defaults and
+// validates it.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses a YAML or JSON configuration, applies the defaults and
+// validates it.
+func Parse(b []byte) (*Config, error) {
+	// Convert YAML to JSON, so the JSON field names apply to both formats.
+	var v any
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+	c.setDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FromFlags returns the configuration equivalent to the legacy command-line
+// flags: every bucket is loaded as both v1 and v2 to the same projects.
+func FromFlags(buckets []string, mlabBucket, gcsProject, bqProject, viewProject string) *Config {
+	c := &Config{}
+	for _, name := range buckets {
+		naming := NamingThirdParty
+		if name == mlabBucket {
+			naming = NamingMlab
+		}
+		c.Buckets = append(c.Buckets, Bucket{
+			Name:        name,
+			Versions:    []string{"v1", "v2"},
+			Naming:      naming,
+			GCSProject:  gcsProject,
+			BQProject:   bqProject,
+			ViewProject: viewProject,
+		})
+	}
+	c.setDefaults()
+	return c
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Buckets {
+		b := &c.Buckets[i]
+		if b.Naming == "" {
+			b.Naming = NamingThirdParty
+		}
+		if b.ViewProject == "" {
+			b.ViewProject = b.BQProject
+		}
+		for j := range b.Destinations {
+			if b.Destinations[j].ViewProject == "" {
+				b.Destinations[j].ViewProject = b.ViewProject
+			}
+		}
+	}
+}
+
+// Validate checks that the configuration is complete and consistent.
+func (c *Config) Validate() error {
+	errs := make([]error, 0)
+	if len(c.Buckets) == 0 {
+		errs = append(errs, errors.New("no buckets configured"))
+	}
+	seen := make(map[string]bool)
+	for i, b := range c.Buckets {
+		if b.Name == "" {
+			errs = append(errs, fmt.Errorf("bucket %d: name is required", i))
+			continue
+		}
+		if seen[b.Name] {
+			errs = append(errs, fmt.Errorf("bucket %s: duplicate bucket", b.Name))
+		}
+		seen[b.Name] = true
+		if len(b.Versions) == 0 {
+			errs = append(errs, fmt.Errorf("bucket %s: versions are required", b.Name))
+		}
+		for _, v := range b.Versions {
+			if !versions[v] {
+				errs = append(errs, fmt.Errorf("bucket %s: invalid version %q (want v1 or v2)", b.Name, v))
+			}
+		}
+		if !namings[b.Naming] {
+			errs = append(errs, fmt.Errorf("bucket %s: invalid naming %q (want mlab or thirdparty)", b.Name, b.Naming))
+		}
+		if b.BQProject == "" {
+			errs = append(errs, fmt.Errorf("bucket %s: bq_project is required", b.Name))
+		}
+		orgs := make(map[string]bool)
+		for j, d := range b.Destinations {
+			if d.Organization == "" || d.BQProject == "" {
+				errs = append(errs, fmt.Errorf("bucket %s: destination %d: organization and bq_project are required", b.Name, j))
+			}
+			if orgs[d.Organization] {
+				errs = append(errs, fmt.Errorf("bucket %s: duplicate destination for organization %q", b.Name, d.Organization))
+			}
+			orgs[d.Organization] = true
+		}
+		if b.VerifyOrganizations && len(c.RegisteredOrganizations) == 0 {
+			errs = append(errs, fmt.Errorf("bucket %s: verify_organizations requires registered_organizations", b.Name))
+		}
+		if !periods[b.Load.Period] {
+			errs = append(errs, fmt.Errorf("bucket %s: invalid load period %q", b.Name, b.Load.Period))
+		}
+		errs = append(errs, b.Load.validate(b.Name)...)
+		errs = append(errs, b.Verify.validate(b.Name)...)
+		if len(b.Verify.queries()) != 0 && !b.Load.Staging {
+			errs = append(errs, fmt.Errorf("bucket %s: verify queries require load staging", b.Name))
+		}
+	}
+	if err := c.Naming.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Bucket returns the configuration of the named bucket, or nil if it is not
+// configured.
+func (c *Config) Bucket(name string) *Bucket {
+	for i := range c.Buckets {
+		if c.Buckets[i].Name == name {
+			return &c.Buckets[i]
+		}
+	}
+	return nil
+}
+
+// Checks returns the row checks of a datatype in a bucket: the first matching
+// override, or the bucket's checks. It returns no checks if the bucket is not
+// configured.
+func (c *Config) Checks(bucket, experiment, datatype string) RowChecks {
+	b := c.Bucket(bucket)
+	if b == nil {
+		return RowChecks{}
+	}
+	for _, d := range b.Verify.Datatypes {
+		if d.Datatype == datatype && (d.Experiment == "" || d.Experiment == experiment) {
+			return d.RowChecks
+		}
+	}
+	return b.Verify.RowChecks
+}
+
+// Queries returns the query checks of a datatype in a bucket: those of the
+// first matching override, or the bucket's. It returns no checks if the bucket
+// is not configured.
+func (c *Config) Queries(bucket, experiment, datatype string) []QueryCheck {
+	b := c.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	for _, d := range b.Verify.Datatypes {
+		if d.Datatype == datatype && (d.Experiment == "" || d.Experiment == experiment) {
+			return d.Queries
+		}
+	}
+	return b.Verify.Queries
+}
+
+// Mode returns the load mode of a datatype in a bucket: the first matching
+// override, or the bucket's mode. It returns the default mode if the bucket is
+// not configured.
+func (c *Config) Mode(bucket, experiment, datatype string) LoadMode {
+	b := c.Bucket(bucket)
+	if b == nil {
+		return LoadMode{}
+	}
+	for _, d := range b.Load.Datatypes {
+		if d.Datatype == datatype && (d.Experiment == "" || d.Experiment == experiment) {
+			return d.LoadMode
+		}
+	}
+	return b.Load.LoadMode
+}
+
+func (l *LoadDefaults) validate(bucket string) []error {
+	errs := l.LoadMode.validate(bucket)
+	for i, d := range l.Datatypes {
+		if d.Datatype == "" {
+			errs = append(errs, fmt.Errorf("bucket %s: load datatype %d: datatype is required", bucket, i))
+		}
+		errs = append(errs, d.LoadMode.validate(bucket)...)
+	}
+	return errs
+}
+
+func (m LoadMode) validate(bucket string) []error {
+	errs := make([]error, 0)
+	if !modes[m.Mode] {
+		errs = append(errs, fmt.Errorf("bucket %s: unknown load mode %q", bucket, m.Mode))
+	}
+	if (m.Mode == "merge") != (len(m.Key) != 0) {
+		errs = append(errs, fmt.Errorf("bucket %s: load mode %q: a key is required by, and only allowed in, merge mode", bucket, m.Mode))
+	}
+	return errs
+}
+
+func (v *Verify) validate(bucket string) []error {
+	errs := v.RowChecks.validate(bucket)
+	for i, d := range v.Datatypes {
+		if d.Datatype == "" {
+			errs = append(errs, fmt.Errorf("bucket %s: verify datatype %d: datatype is required", bucket, i))
+		}
+		errs = append(errs, d.RowChecks.validate(bucket)...)
+	}
+	for _, q := range v.queries() {
+		if q.Name == "" || !strings.Contains(q.Query, "{table}") {
+			errs = append(errs, fmt.Errorf("bucket %s: invalid verify query %q (want a name and a query of {table})", bucket, q.Name))
+		}
+	}
+	return errs
+}
+
+// queries returns the query checks of the bucket and of every override.
+func (v *Verify) queries() []QueryCheck {
+	queries := append([]QueryCheck(nil), v.Queries...)
+	for _, d := range v.Datatypes {
+		queries = append(queries, d.Queries...)
+	}
+	return queries
+}
+
+func (r RowChecks) validate(bucket string) []error {
+	errs := make([]error, 0)
+	if r.MinRows < 0 {
+		errs = append(errs, fmt.Errorf("bucket %s: invalid min_rows %d", bucket, r.MinRows))
+	}
+	if r.MaxDrop < 0 || r.MaxDrop > 1 {
+		errs = append(errs, fmt.Errorf("bucket %s: invalid max_drop %v (want between 0 and 1)", bucket, r.MaxDrop))
+	}
+	return errs
+}
+
+// Projects returns the BigQuery projects for the raw tables and views of an
+// organization's datatypes in a bucket. It returns empty strings if the bucket
+// is not configured.
+func (c *Config) Projects(bucket, organization string) (project, viewProject string) {
+	b := c.Bucket(bucket)
+	if b == nil {
+		return "", ""
+	}
+	for _, d := range b.Destinations {
+		if d.Organization == organization {
+			return d.BQProject, d.ViewProject
+		}
+	}
+	return b.BQProject, b.ViewProject
+}
+
+// BucketNames returns the names of the buckets with the given autoload
+// version.
+func (c *Config) BucketNames(version string) []string {
+	names := make([]string, 0)
+	for _, b := range c.Buckets {
+		if b.HasVersion(version) {
+			names = append(names, b.Name)
+		}
+	}
+	return names
+}
+
+// HasVersion returns whether the bucket is loaded with the given autoload
+// version.
+func (b *Bucket) HasVersion(version string) bool {
+	for _, v := range b.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,447 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      *Config
+		wantRules int
+		wantErr   bool
+	}{
+		{
+			name: "yaml",
+			content: `
+buckets:
+- name: archive-mlab-oti
+  versions: [v1, v2]
+  naming: mlab
+  bq_project: mlab-oti
+  load:
+    period: daily
+- name: archive-mlab-partner
+  versions: [v2]
+  bq_project: mlab-partner
+  view_project: mlab-oti
+  organizations: [partner]
+`,
+			want: &Config{Buckets: []Bucket{
+				{
+					Name:        "archive-mlab-oti",
+					Versions:    []string{"v1", "v2"},
+					Naming:      NamingMlab,
+					BQProject:   "mlab-oti",
+					ViewProject: "mlab-oti",
+					Load:        LoadDefaults{Period: "daily"},
+				},
+				{
+					Name:          "archive-mlab-partner",
+					Versions:      []string{"v2"},
+					Naming:        NamingThirdParty,
+					BQProject:     "mlab-partner",
+					ViewProject:   "mlab-oti",
+					Organizations: []string{"partner"},
+				},
+			}},
+		},
+		{
+			name:    "json",
+			content: `{"buckets": [{"name": "b", "versions": ["v1"], "gcs_project": "mlab-p", "bq_project": "p"}]}`,
+			want: &Config{Buckets: []Bucket{
+				{Name: "b", Versions: []string{"v1"}, Naming: NamingThirdParty, GCSProject: "mlab-p", BQProject: "p", ViewProject: "p"},
+			}},
+		},
+		{
+			name: "naming-rules",
+			content: `
+buckets: [{name: b, versions: [v2], bq_project: p}]
+naming:
+- bucket: b
+  dataset: "{{.Organization}}_{{.Experiment}}"
+  table: "{{.Datatype}}"
+  view_dataset: "{{.Experiment}}"
+  view_table: "{{.Datatype}}"
+`,
+			wantRules: 1,
+		},
+		{
+			name:    "unknown-field",
+			content: `{"buckets": [{"name": "b", "versions": ["v1"], "bq_project": "p", "typo": 1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid-yaml",
+			content: `buckets: [`,
+			wantErr: true,
+		},
+		{
+			name:    "no-buckets",
+			content: `buckets: []`,
+			wantErr: true,
+		},
+		{
+			name: "invalid-bucket",
+			content: `
+buckets:
+- name: b
+  versions: [v3]
+  naming: other
+  load: {period: weekly}
+- name: b
+  versions: [v1]
+  bq_project: p
+`,
+			wantErr: true,
+		},
+		{
+			name: "organizations",
+			content: `
+registered_organizations: [partner]
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  organizations: [partner, other]
+  deny_organizations: [rogue]
+  verify_organizations: true
+`,
+			want: &Config{
+				RegisteredOrganizations: []string{"partner"},
+				Buckets: []Bucket{{
+					Name: "b", Versions: []string{"v2"}, Naming: NamingThirdParty, BQProject: "p", ViewProject: "p",
+					Organizations: []string{"partner", "other"}, DenyOrganizations: []string{"rogue"}, VerifyOrganizations: true,
+				}},
+			},
+		},
+		{
+			name:    "verify-without-registry",
+			content: `buckets: [{name: b, versions: [v2], bq_project: p, verify_organizations: true}]`,
+			wantErr: true,
+		},
+		{
+			name: "verify",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  verify:
+    min_rows: 1
+    max_drop: 0.5
+    datatypes:
+    - {experiment: exp, datatype: sparse, min_rows: 0, manifest: true}
+`,
+			want: &Config{Buckets: []Bucket{{
+				Name: "b", Versions: []string{"v2"}, Naming: NamingThirdParty, BQProject: "p", ViewProject: "p",
+				Verify: Verify{
+					RowChecks: RowChecks{MinRows: 1, MaxDrop: 0.5},
+					Datatypes: []DatatypeChecks{{Experiment: "exp", Datatype: "sparse", RowChecks: RowChecks{Manifest: true}}},
+				},
+			}}},
+		},
+		{
+			name: "invalid-verify",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  verify:
+    min_rows: -1
+    max_drop: 2
+    datatypes: [{min_rows: 1}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "staging",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  load: {staging: true}
+  verify:
+    queries: [{name: ids, query: "SELECT id FROM {table} WHERE id IS NULL"}]
+`,
+			want: &Config{Buckets: []Bucket{{
+				Name: "b", Versions: []string{"v2"}, Naming: NamingThirdParty, BQProject: "p", ViewProject: "p",
+				Load: LoadDefaults{Staging: true},
+				Verify: Verify{
+					Queries: []QueryCheck{{Name: "ids", Query: "SELECT id FROM {table} WHERE id IS NULL"}},
+				},
+			}}},
+		},
+		{
+			name: "queries-without-staging",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  verify:
+    datatypes: [{datatype: ndt, queries: [{name: ids, query: "SELECT id FROM {table}"}]}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid-query",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  load: {staging: true}
+  verify:
+    queries: [{name: ids, query: "SELECT 1"}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "modes",
+			content: `
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  load:
+    mode: append
+    datatypes:
+    - {experiment: exp, datatype: hosts, mode: merge, key: [hostname]}
+    - {datatype: sites, mode: replace}
+`,
+			want: &Config{Buckets: []Bucket{{
+				Name: "b", Versions: []string{"v2"}, Naming: NamingThirdParty, BQProject: "p", ViewProject: "p",
+				Load: LoadDefaults{
+					LoadMode: LoadMode{Mode: "append"},
+					Datatypes: []DatatypeLoad{
+						{Experiment: "exp", Datatype: "hosts", LoadMode: LoadMode{Mode: "merge", Key: []string{"hostname"}}},
+						{Datatype: "sites", LoadMode: LoadMode{Mode: "replace"}},
+					},
+				},
+			}}},
+		},
+		{
+			name:    "unknown-mode",
+			content: `buckets: [{name: b, versions: [v2], bq_project: p, load: {mode: upsert}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "merge-without-key",
+			content: `buckets: [{name: b, versions: [v2], bq_project: p, load: {datatypes: [{datatype: hosts, mode: merge}]}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "key-without-merge",
+			content: `buckets: [{name: b, versions: [v2], bq_project: p, load: {mode: append, key: [id]}}]`,
+			wantErr: true,
+		},
+		{
+			name: "invalid-naming-rule",
+			content: `
+buckets: [{name: b, versions: [v2], bq_project: p}]
+naming: [{dataset: x, table: x, view_dataset: x, view_table: x}]
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !cmp.Equal(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+			if got != nil && len(got.Naming) != tt.wantRules {
+				t.Errorf("Parse() = %d naming rules, want %d", len(got.Naming), tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte("buckets: [{name: b, versions: [v1], bq_project: p}]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(p)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.Bucket("b") == nil || c.Bucket("other") != nil {
+		t.Errorf("Load() = %v, want bucket b only", c)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Load() error = nil, want error for missing file")
+	}
+}
+
+func TestConfig_Projects(t *testing.T) {
+	c, err := Parse([]byte(`
+buckets:
+- name: archive-mlab-autojoin
+  versions: [v2]
+  bq_project: mlab-autojoin
+  destinations:
+  - organization: partner
+    bq_project: partner-raw
+  - organization: other
+    bq_project: other-raw
+    view_project: other-views
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tests := []struct {
+		bucket, org        string
+		wantMain, wantView string
+	}{
+		{"archive-mlab-autojoin", "mlab", "mlab-autojoin", "mlab-autojoin"},
+		{"archive-mlab-autojoin", "partner", "partner-raw", "mlab-autojoin"},
+		{"archive-mlab-autojoin", "other", "other-raw", "other-views"},
+		{"unknown", "mlab", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket+"/"+tt.org, func(t *testing.T) {
+			main, view := c.Projects(tt.bucket, tt.org)
+			if main != tt.wantMain || view != tt.wantView {
+				t.Errorf("Projects() = %s, %s, want %s, %s", main, view, tt.wantMain, tt.wantView)
+			}
+		})
+	}
+
+	_, err = Parse([]byte(`
+buckets:
+- name: b
+  versions: [v2]
+  bq_project: p
+  destinations: [{organization: x, bq_project: y}, {organization: x, bq_project: z}, {bq_project: z}]
+`))
+	if err == nil {
+		t.Errorf("Parse() error = nil, want error for invalid destinations")
+	}
+}
+
+func TestConfig_Checks(t *testing.T) {
+	c := &Config{Buckets: []Bucket{{
+		Name: "b",
+		Verify: Verify{
+			RowChecks: RowChecks{MinRows: 1},
+			Datatypes: []DatatypeChecks{
+				{Experiment: "exp", Datatype: "sparse", RowChecks: RowChecks{MaxDrop: 0.9}},
+				{Datatype: "any", RowChecks: RowChecks{Manifest: true}},
+			},
+		},
+	}}}
+	tests := []struct {
+		name       string
+		bucket     string
+		experiment string
+		datatype   string
+		want       RowChecks
+	}{
+		{name: "bucket", bucket: "b", experiment: "exp", datatype: "ndt", want: RowChecks{MinRows: 1}},
+		{name: "override", bucket: "b", experiment: "exp", datatype: "sparse", want: RowChecks{MaxDrop: 0.9}},
+		{name: "other-experiment", bucket: "b", experiment: "other", datatype: "sparse", want: RowChecks{MinRows: 1}},
+		{name: "any-experiment", bucket: "b", experiment: "other", datatype: "any", want: RowChecks{Manifest: true}},
+		{name: "unknown-bucket", bucket: "other", experiment: "exp", datatype: "ndt", want: RowChecks{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Checks(tt.bucket, tt.experiment, tt.datatype); got != tt.want {
+				t.Errorf("Config.Checks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Queries(t *testing.T) {
+	bucket := []QueryCheck{{Name: "ids", Query: "SELECT id FROM {table} WHERE id IS NULL"}}
+	override := []QueryCheck{{Name: "dates", Query: "SELECT date FROM {table} WHERE date IS NULL"}}
+	c := &Config{Buckets: []Bucket{{
+		Name: "b",
+		Verify: Verify{
+			Queries:   bucket,
+			Datatypes: []DatatypeChecks{{Experiment: "exp", Datatype: "sparse", Queries: override}},
+		},
+	}}}
+	tests := []struct {
+		name       string
+		bucket     string
+		experiment string
+		datatype   string
+		want       []QueryCheck
+	}{
+		{name: "bucket", bucket: "b", experiment: "exp", datatype: "ndt", want: bucket},
+		{name: "override", bucket: "b", experiment: "exp", datatype: "sparse", want: override},
+		{name: "other-experiment", bucket: "b", experiment: "other", datatype: "sparse", want: bucket},
+		{name: "unknown-bucket", bucket: "other", experiment: "exp", datatype: "ndt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(c.Queries(tt.bucket, tt.experiment, tt.datatype), tt.want); diff != "" {
+				t.Errorf("Config.Queries() mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfig_Mode(t *testing.T) {
+	c := &Config{Buckets: []Bucket{{
+		Name: "b",
+		Load: LoadDefaults{
+			LoadMode: LoadMode{Mode: "append"},
+			Datatypes: []DatatypeLoad{
+				{Experiment: "exp", Datatype: "hosts", LoadMode: LoadMode{Mode: "merge", Key: []string{"hostname"}}},
+			},
+		},
+	}}}
+	tests := []struct {
+		name       string
+		bucket     string
+		experiment string
+		datatype   string
+		want       LoadMode
+	}{
+		{name: "bucket", bucket: "b", experiment: "exp", datatype: "ndt", want: LoadMode{Mode: "append"}},
+		{name: "override", bucket: "b", experiment: "exp", datatype: "hosts", want: LoadMode{Mode: "merge", Key: []string{"hostname"}}},
+		{name: "other-experiment", bucket: "b", experiment: "other", datatype: "hosts", want: LoadMode{Mode: "append"}},
+		{name: "unknown-bucket", bucket: "other", experiment: "exp", datatype: "ndt", want: LoadMode{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(c.Mode(tt.bucket, tt.experiment, tt.datatype), tt.want); diff != "" {
+				t.Errorf("Config.Mode() mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	c := FromFlags([]string{"archive-mlab-oti", "archive-mlab-partner"}, "archive-mlab-oti", "mlab-oti", "bq", "view")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("FromFlags() invalid config: %v", err)
+	}
+	if got := c.Bucket("archive-mlab-oti").Naming; got != NamingMlab {
+		t.Errorf("FromFlags() mlab bucket naming = %q, want %q", got, NamingMlab)
+	}
+	if got := c.Bucket("archive-mlab-partner").Naming; got != NamingThirdParty {
+		t.Errorf("FromFlags() partner bucket naming = %q, want %q", got, NamingThirdParty)
+	}
+	want := []string{"archive-mlab-oti", "archive-mlab-partner"}
+	for _, v := range []string{"v1", "v2"} {
+		if got := c.BucketNames(v); !cmp.Equal(got, want) {
+			t.Errorf("BucketNames(%s) = %v, want %v", v, got, want)
+		}
+	}
+}
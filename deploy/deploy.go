@@ -0,0 +1,92 @@
+// Package deploy builds the load handlers of an autoloader deployment from
+// its configuration. It is shared by the server and the direct mode of
+// autoloaderctl, so both discover and name the datatypes alike.
+package deploy
+
+import (
+	"cloud.google.com/go/storage"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/config"
+	"github.com/m-lab/autoloader/gcs"
+	gcsv2 "github.com/m-lab/autoloader/gcs/v2"
+	"github.com/m-lab/autoloader/handler"
+)
+
+// Handlers returns the v1 and v2 handlers of the configuration. They read the
+// buckets with the storage client and load each datatype with the client of
+// its destination projects from the pool. Audit sinks and state stores are
+// left to the caller.
+func Handlers(sc *storage.Client, cfg *config.Config, pool *bq.Pool) (v1, v2 *handler.Client) {
+	projects := func(dt *api.Datatype) (string, string) {
+		return cfg.Projects(dt.BucketName, dt.Organization)
+	}
+	router := func(dt *api.Datatype) (handler.BQClient, error) {
+		return pool.Client(projects(dt))
+	}
+	checks := func(dt *api.Datatype) handler.RowChecks {
+		c := cfg.Checks(dt.BucketName, dt.Experiment, dt.Name)
+		return handler.RowChecks{MinRows: c.MinRows, MaxDrop: c.MaxDrop, Manifest: c.Manifest}
+	}
+	modes := func(dt *api.Datatype) handler.LoadMode {
+		m := cfg.Mode(dt.BucketName, dt.Experiment, dt.Name)
+		return handler.LoadMode{Mode: m.Mode, Key: m.Key}
+	}
+	unpartitioned := func(bucket, experiment, datatype string) bool {
+		return cfg.Mode(bucket, experiment, datatype).Mode == handler.ModeReplace
+	}
+	staging := func(dt *api.Datatype) *handler.Staging {
+		if b := cfg.Bucket(dt.BucketName); b == nil || !b.Load.Staging {
+			return nil
+		}
+		s := &handler.Staging{}
+		for _, q := range cfg.Queries(dt.BucketName, dt.Experiment, dt.Name) {
+			s.Checks = append(s.Checks, bq.QueryCheck(q.Name, q.Query))
+		}
+		return s
+	}
+	periods := make(map[string]string)
+	for _, b := range cfg.Buckets {
+		if b.Load.Period != "" {
+			periods[b.Name] = b.Load.Period
+		}
+	}
+
+	gcsV1 := gcs.NewClient(sc, cfg.BucketNames("v1"), "", "")
+	gcsV1.Unpartitioned = unpartitioned
+	gcsV1.Naming = make(map[string]gcs.BucketNaming)
+	for _, b := range cfg.Buckets {
+		gcsV1.Naming[b.Name] = gcs.BucketNaming{Mlab: b.Naming == config.NamingMlab, Project: b.GCSProject}
+	}
+
+	gcsV2 := gcsv2.NewClient(sc, cfg.BucketNames("v2"))
+	gcsV2.Naming = cfg.Naming
+	gcsV2.Unpartitioned = unpartitioned
+	gcsV2.Policies = make(map[string]gcsv2.OrgPolicy)
+	for _, b := range cfg.Buckets {
+		if len(b.Organizations) != 0 || len(b.DenyOrganizations) != 0 || b.VerifyOrganizations {
+			gcsV2.Policies[b.Name] = gcsv2.OrgPolicy{
+				Allow:  b.Organizations,
+				Deny:   b.DenyOrganizations,
+				Verify: b.VerifyOrganizations,
+			}
+		}
+	}
+	registry := gcsv2.Registry{}
+	for _, org := range cfg.RegisteredOrganizations {
+		registry[org] = true
+	}
+	gcsV2.Verifier = registry
+
+	v1 = handler.NewClient(gcsV1, nil)
+	v2 = handler.NewClient(gcsV2, nil)
+	for _, h := range []*handler.Client{v1, v2} {
+		h.Router = router
+		h.Projects = projects
+		h.Periods = periods
+		h.Checks = checks
+		h.Staging = staging
+		h.Modes = modes
+	}
+	return v1, v2
+}
@@ -0,0 +1,59 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/config"
+	"github.com/m-lab/autoloader/handler"
+	"github.com/m-lab/go/testingx"
+	"google.golang.org/api/option"
+)
+
+func TestHandlers(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+buckets:
+- name: archive
+  versions: [v2]
+  bq_project: raw
+  view_project: views
+  destinations:
+  - organization: partner
+    bq_project: partner-raw
+  load:
+    period: annually
+    datatypes:
+    - datatype: sites
+      mode: replace
+`))
+	testingx.Must(t, err, "failed to parse config")
+	ctx := context.Background()
+	sc, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	testingx.Must(t, err, "failed to create storage client")
+	defer sc.Close()
+	pool := bq.NewPool(ctx, option.WithoutAuthentication(), option.WithEndpoint("http://localhost:0"))
+	defer pool.Close()
+
+	v1, v2 := Handlers(sc, cfg, pool)
+	for _, h := range []*handler.Client{v1, v2} {
+		partner := &api.Datatype{DatatypeOpts: api.DatatypeOpts{BucketName: "archive", Organization: "partner", Name: "sites"}}
+		if main, view := h.Projects(partner); main != "partner-raw" || view != "views" {
+			t.Errorf("Handlers() Projects() = %s, %s, want partner-raw, views", main, view)
+		}
+		if got := h.Modes(partner).Mode; got != handler.ModeReplace {
+			t.Errorf("Handlers() Modes() = %q, want %q", got, handler.ModeReplace)
+		}
+		if diff := cmp.Diff(h.Periods, map[string]string{"archive": "annually"}); diff != "" {
+			t.Errorf("Handlers() Periods mismatch (-got +want):\n%s", diff)
+		}
+		client, err := h.Router(partner)
+		testingx.Must(t, err, "failed to route datatype")
+		if got := client.(*bq.Client).Dataset("d").ProjectID(); got != "partner-raw" {
+			t.Errorf("Handlers() Router() project = %q, want %q", got, "partner-raw")
+		}
+	}
+}
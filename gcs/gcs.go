@@ -2,19 +2,28 @@ package gcs
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/storage"
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/schema"
+	"github.com/m-lab/autoloader/tracing"
 	"github.com/m-lab/go/storagex"
 	"github.com/m-lab/go/timex"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
 )
 
@@ -22,22 +31,81 @@ var (
 	datePattern = `/\d{4}/[01]\d/[0123]\d`
 )
 
+// LinesMetadataKey is the object metadata key where uploaders may record the
+// number of lines (rows) of an object, as a manifest of its directory.
+const LinesMetadataKey = "lines"
+
 const (
-	prefix           = "autoload/v1/"
+	version          = "v1"
+	prefix           = "autoload/" + version + "/"
 	schemaFileSuffix = ".table.json"
 )
 
 // Client is used to interact with Google Cloud Storage.
 type Client struct {
-	Buckets    []*storagex.Bucket
-	mlabBucket string
-	project    string
+	Buckets []*storagex.Bucket
+	// Naming contains the naming conventions of individual buckets. Buckets
+	// not in the map use the M-Lab bucket and project given to NewClient.
+	Naming map[string]BucketNaming
+	// Unpartitioned reports whether the table of a datatype is not
+	// partitioned (e.g., it is replaced as a whole), so its schema does not
+	// require a partition field. If nil, every table is partitioned.
+	Unpartitioned func(bucket, experiment, datatype string) bool
+	mlabBucket    string
+	project       string
+}
+
+// BucketNaming describes the naming conventions of a bucket's datatypes.
+type BucketNaming struct {
+	Mlab    bool   // Whether the bucket uses M-Lab naming.
+	Project string // Project used by the third-party naming.
 }
 
 // Dir represents a GCS directory.
 type Dir struct {
-	Path string    // GCS path.
-	Date time.Time // Path date.
+	Path    string    // GCS path.
+	Date    time.Time // Path date.
+	Updated time.Time // Most recent update time of the objects in the directory.
+	// Fingerprint identifies the contents of the directory. It changes when
+	// objects are added, removed or overwritten.
+	Fingerprint string
+	// Lines is the total number of lines of the objects in the directory, as
+	// recorded in their LinesMetadataKey metadata. It is nil unless every
+	// object records it.
+	Lines *int64
+	// Files are the GCS URIs of the objects in the directory, in
+	// lexicographical order.
+	Files []string
+}
+
+// ObjectError describes a failure to read or interpret a GCS object (or, if
+// Path is a prefix, to list the objects under it).
+type ObjectError struct {
+	Bucket string // GCS bucket name.
+	Path   string // Object name or prefix.
+	// Version is the autoload version of the path ("v1" or "v2"), and
+	// Organization the v2 organization it belongs to, if known.
+	Version      string
+	Organization string
+	Err          error // Underlying error.
+}
+
+// Error implements the error interface.
+func (e *ObjectError) Error() string {
+	return fmt.Sprintf("gs://%s/%s: %v", e.Bucket, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidSchema is returned when a schema file is empty or unreadable.
+var ErrInvalidSchema = errors.New("invalid schema file")
+
+// BucketName returns the name of a bucket without making any requests.
+func BucketName(b *storagex.Bucket) string {
+	return b.Object("").BucketName()
 }
 
 // StorageReader is a Reader to a GCS object.
@@ -62,42 +130,82 @@ func NewClient(c *storage.Client, names []string, mlabBucket, project string) *C
 
 // GetDatatypes gets a list of datatypes for all the buckets
 // (e.g., all datatypes under `autoload/v1/tables`).
-func (c *Client) GetDatatypes(ctx context.Context) []*api.Datatype {
+// Schema files are validated against the autoloader rules (see schema.Validate).
+// Invalid schema files do not stop the discovery. Instead, an *ObjectError is
+// collected for each of them and returned, joined, along with the datatypes
+// that were found.
+func (c *Client) GetDatatypes(ctx context.Context) (datatypes []*api.Datatype, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gcs.GetDatatypes")
+	defer func() { tracing.End(span, err) }()
+
 	prefix := path.Join(prefix, "tables")
-	datatypes := make([]*api.Datatype, 0)
+	datatypes = make([]*api.Datatype, 0)
+	errs := make([]error, 0)
 
 	for _, bucket := range c.Buckets {
-		bucket.Walk(ctx, prefix, func(o *storagex.Object) error {
+		wctx, wspan := tracing.Tracer().Start(ctx, "gcs.Walk",
+			trace.WithAttributes(tracing.Bucket.String(BucketName(bucket)), tracing.Prefix.String(prefix)))
+		err := bucket.Walk(wctx, prefix, func(o *storagex.Object) error {
+			dir, filename := path.Split(o.Name)
+			name, experiment := strings.TrimSuffix(filename, schemaFileSuffix), path.Base(dir)
+
 			file, err := ReadFile(ctx, o.ObjectHandle)
-			if err != nil || len(file) == 0 {
-				return fmt.Errorf("invalid schema file under %s", o.Name)
+			if err == nil && len(file) == 0 {
+				err = ErrInvalidSchema
+			}
+			if err == nil {
+				_, err = c.parse(o.Bucket, experiment, name, file)
+			}
+			if err != nil {
+				errs = append(errs, &ObjectError{Bucket: o.Bucket, Path: o.Name, Version: version, Err: err})
+				return nil
 			}
 
 			attrs, err := bucket.Attrs(ctx)
 			if err != nil {
-				return err
+				errs = append(errs, &ObjectError{Bucket: o.Bucket, Path: o.Name, Version: version, Err: err})
+				return nil
 			}
 
-			dir, filename := path.Split(o.Name)
-
 			opts := api.DatatypeOpts{
-				Name:        strings.TrimSuffix(filename, schemaFileSuffix),
-				Experiment:  path.Base(dir),
+				Name:        name,
+				Experiment:  experiment,
+				Version:     version,
 				Location:    attrs.Location,
 				Schema:      file,
 				UpdatedTime: o.ObjectAttrs.Updated,
 				Bucket:      bucket,
+				BucketName:  attrs.Name,
 			}
 
 			datatypes = append(datatypes, c.getDatatype(attrs.Name, opts))
 			return nil
 		})
+		if err != nil {
+			errs = append(errs, &ObjectError{Bucket: BucketName(bucket), Path: prefix, Version: version, Err: err})
+		}
+		tracing.End(wspan, err)
 	}
 
-	return datatypes
+	return datatypes, errors.Join(errs...)
+}
+
+// parse parses and validates the schema file of a datatype (see schema.Parse
+// and schema.ParseUnpartitioned).
+func (c *Client) parse(bucket, experiment, datatype string, file []byte) (bigquery.Schema, error) {
+	if c.Unpartitioned != nil && c.Unpartitioned(bucket, experiment, datatype) {
+		return schema.ParseUnpartitioned(file)
+	}
+	return schema.Parse(file)
 }
 
 func (c *Client) getDatatype(bucketName string, opts api.DatatypeOpts) *api.Datatype {
+	if n, ok := c.Naming[bucketName]; ok {
+		if n.Mlab {
+			return api.NewMlabDatatype(opts)
+		}
+		return api.NewThirdPartyDatatype(opts, n.Project)
+	}
 	switch bucketName {
 	case c.mlabBucket:
 		return api.NewMlabDatatype(opts)
@@ -109,12 +217,29 @@ func (c *Client) getDatatype(bucketName string, opts api.DatatypeOpts) *api.Data
 // GetDirs returns all the directory paths for a datatype within a start (inclusive) and
 // end (exclusive) date.
 func (c *Client) GetDirs(ctx context.Context, dt *api.Datatype, start, end string) ([]Dir, error) {
-	return GetDirs(ctx, dt, path.Join(prefix, dt.Experiment, dt.Name), start, end)
+	return GetDirs(ctx, dt, DataPath(dt), start, end)
+}
+
+// DataPath returns the GCS path containing the data of a datatype
+// (i.e., "autoload/v1/<experiment>/<datatype>").
+func DataPath(dt *api.Datatype) string {
+	return path.Join(prefix, dt.Experiment, dt.Name)
+}
+
+// SchemaFile returns the GCS path of the schema file of a datatype
+// (i.e., "autoload/v1/tables/<experiment>/<datatype>.table.json").
+func SchemaFile(dt *api.Datatype) string {
+	return path.Join(prefix, "tables", dt.Experiment, dt.Name+schemaFileSuffix)
 }
 
 // GetDirs iterates over a set of directories and returns those whose path matches "<p>/YYYY/MM/DD"
 // within a start (inclusive) and end (exclusive) date.
-func GetDirs(ctx context.Context, dt *api.Datatype, p, start, end string) ([]Dir, error) {
+func GetDirs(ctx context.Context, dt *api.Datatype, p, start, end string) (dirs []Dir, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gcs.GetDirs",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...),
+		trace.WithAttributes(tracing.Prefix.String(p)))
+	defer func() { tracing.End(span, err) }()
+
 	it := dt.Bucket.Objects(ctx, &storage.Query{
 		Prefix:      p,
 		StartOffset: path.Join(p, start),
@@ -123,20 +248,25 @@ func GetDirs(ctx context.Context, dt *api.Datatype, p, start, end string) ([]Dir
 
 	dirMatch, err := regexp.Compile(p + datePattern)
 	if err != nil {
-		log.Println("failed to create regular expression:", err)
+		logging.FromContext(ctx).Error("failed to create regular expression", logging.ErrorKey, err)
 		return nil, err
 	}
 
 	dirNames := set.NewSet[string]()
-	var dirs []Dir
+	hashes := make([]hash.Hash, 0)
+	lines := make([]*int64, 0)
 	for {
 		attr, err := it.Next()
 		if err == iterator.Done {
+			for i := range dirs {
+				dirs[i].Fingerprint = hex.EncodeToString(hashes[i].Sum(nil))
+				dirs[i].Lines = lines[i]
+			}
 			return dirs, nil
 		}
 
 		if err != nil {
-			log.Println("failed to list bucket:", err)
+			logging.FromContext(ctx).Error("failed to list bucket", logging.PathKey, p, logging.ErrorKey, err)
 			return nil, err
 		}
 
@@ -146,8 +276,16 @@ func GetDirs(ctx context.Context, dt *api.Datatype, p, start, end string) ([]Dir
 			continue
 		}
 
-		// Check if directory has already been added.
+		// Check if directory has already been added. Objects are listed in
+		// lexicographical order, so it must be the last directory.
 		if dirNames.Contains(dirPath) {
+			last := &dirs[len(dirs)-1]
+			if attr.Updated.After(last.Updated) {
+				last.Updated = attr.Updated
+			}
+			fmt.Fprintf(hashes[len(hashes)-1], "%s %d %d\n", attr.Name, attr.Generation, attr.Size)
+			lines[len(lines)-1] = addLines(lines[len(lines)-1], attr)
+			last.Files = append(last.Files, "gs://"+path.Join(attr.Bucket, attr.Name))
 			continue
 		}
 		dirNames.Add(dirPath)
@@ -156,11 +294,32 @@ func GetDirs(ctx context.Context, dt *api.Datatype, p, start, end string) ([]Dir
 		date := strings.TrimPrefix(dirPath, p+"/")
 		format, _ := time.Parse(timex.YYYYMMDDWithSlash, date)
 		dir := Dir{
-			Path: "gs://" + path.Join(attr.Bucket, dirPath, "/*"),
-			Date: format,
+			Path:    "gs://" + path.Join(attr.Bucket, dirPath, "/*"),
+			Date:    format,
+			Updated: attr.Updated,
+			Files:   []string{"gs://" + path.Join(attr.Bucket, attr.Name)},
 		}
 		dirs = append(dirs, dir)
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %d %d\n", attr.Name, attr.Generation, attr.Size)
+		hashes = append(hashes, h)
+		var n int64
+		lines = append(lines, addLines(&n, attr))
+	}
+}
+
+// addLines adds the lines recorded in the object's metadata to the total, or
+// returns nil if either is unknown.
+func addLines(total *int64, attr *storage.ObjectAttrs) *int64 {
+	if total == nil {
+		return nil
+	}
+	n, err := strconv.ParseInt(attr.Metadata[LinesMetadataKey], 10, 64)
+	if err != nil {
+		return nil
 	}
+	*total += n
+	return total
 }
 
 // ReadFile reads a StorageReader object and returns its contents as an array of bytes.
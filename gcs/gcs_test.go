@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"path"
+	"strconv"
 	"testing"
 	"time"
 
@@ -30,7 +31,12 @@ func TestClient_GetDatatypes(t *testing.T) {
 		objs       []fakestorage.Object
 		names      []string
 		mlabBucket string
-		want       []*api.Datatype
+		naming     map[string]BucketNaming
+		// unpartitioned contains the datatypes whose tables are not
+		// partitioned, as "<bucket>/<experiment>/<datatype>".
+		unpartitioned map[string]bool
+		want          []*api.Datatype
+		wantErr       bool
 	}{
 		{
 			name: "success",
@@ -50,12 +56,14 @@ func TestClient_GetDatatypes(t *testing.T) {
 					api.DatatypeOpts{
 						Name:        "datatype1",
 						Experiment:  "experiment1",
+						Version:     "v1",
 						Location:    "US",
 						Schema:      testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
 						UpdatedTime: updated,
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: testBucket,
 					}, testProject),
 			},
 		},
@@ -86,26 +94,84 @@ func TestClient_GetDatatypes(t *testing.T) {
 					api.DatatypeOpts{
 						Name:        "datatype1",
 						Experiment:  "experiment1",
+						Version:     "v1",
 						Location:    "US",
 						Schema:      testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
 						UpdatedTime: updated,
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-mlab-sandbox",
 					}),
 				api.NewThirdPartyDatatype(
 					api.DatatypeOpts{
 						Name:        "datatype2",
 						Experiment:  "experiment2",
+						Version:     "v1",
 						Location:    "US",
 						Schema:      testingx.MustReadFile(t, "testdata/experiment2/datatype2.table.json"),
 						UpdatedTime: updated,
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-non-mlab",
 					}, testProject),
 			},
 		},
+		{
+			name: "success-with-bucket-naming",
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: "archive-mlab-sandbox",
+						Name:       path.Join(prefix, "tables/experiment1/datatype1"),
+						Updated:    updated,
+					},
+					Content: testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+				},
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: "archive-non-mlab",
+						Name:       path.Join(prefix, "tables/experiment2/datatype2"),
+						Updated:    updated,
+					},
+					Content: testingx.MustReadFile(t, "testdata/experiment2/datatype2.table.json"),
+				},
+			},
+			names: []string{"archive-mlab-sandbox", "archive-non-mlab"},
+			naming: map[string]BucketNaming{
+				"archive-mlab-sandbox": {Mlab: true},
+				"archive-non-mlab":     {Project: "mlab-partner"},
+			},
+			want: []*api.Datatype{
+				api.NewMlabDatatype(
+					api.DatatypeOpts{
+						Name:        "datatype1",
+						Experiment:  "experiment1",
+						Version:     "v1",
+						Location:    "US",
+						Schema:      testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+						UpdatedTime: updated,
+						Bucket: &storagex.Bucket{
+							BucketHandle: &storage.BucketHandle{},
+						},
+						BucketName: "archive-mlab-sandbox",
+					}),
+				api.NewThirdPartyDatatype(
+					api.DatatypeOpts{
+						Name:        "datatype2",
+						Experiment:  "experiment2",
+						Version:     "v1",
+						Location:    "US",
+						Schema:      testingx.MustReadFile(t, "testdata/experiment2/datatype2.table.json"),
+						UpdatedTime: updated,
+						Bucket: &storagex.Bucket{
+							BucketHandle: &storage.BucketHandle{},
+						},
+						BucketName: "archive-non-mlab",
+					}, "mlab-partner"),
+			},
+		},
 		{
 			name: "invalid-schema-file",
 			objs: []fakestorage.Object{
@@ -117,8 +183,113 @@ func TestClient_GetDatatypes(t *testing.T) {
 					Content: nil,
 				},
 			},
+			names:   []string{testBucket},
+			want:    []*api.Datatype{},
+			wantErr: true,
+		},
+		{
+			name: "invalid-schema-file-continues",
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: testBucket,
+						Name:       path.Join(prefix, "tables/experiment1/datatype0"),
+					},
+					Content: nil,
+				},
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: testBucket,
+						Name:       path.Join(prefix, "tables/experiment1/datatype1"),
+						Updated:    updated,
+					},
+					Content: testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+				},
+			},
 			names: []string{testBucket},
-			want:  []*api.Datatype{},
+			want: []*api.Datatype{
+				api.NewThirdPartyDatatype(
+					api.DatatypeOpts{
+						Name:        "datatype1",
+						Experiment:  "experiment1",
+						Version:     "v1",
+						Location:    "US",
+						Schema:      testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+						UpdatedTime: updated,
+						Bucket: &storagex.Bucket{
+							BucketHandle: &storage.BucketHandle{},
+						},
+						BucketName: testBucket,
+					}, testProject),
+			},
+			wantErr: true,
+		},
+		{
+			name: "schema-validation-error",
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: testBucket,
+						Name:       path.Join(prefix, "tables/experiment1/datatype1"),
+					},
+					Content: []byte(`[{"name": "id", "type": "STRING"}]`),
+				},
+			},
+			names:   []string{testBucket},
+			want:    []*api.Datatype{},
+			wantErr: true,
+		},
+		{
+			name: "unpartitioned-schema-without-date",
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: testBucket,
+						Name:       path.Join(prefix, "tables/experiment1/datatype1.table.json"),
+						Updated:    updated,
+					},
+					Content: []byte(`[{"name": "id", "type": "STRING"}]`),
+				},
+			},
+			names:         []string{testBucket},
+			unpartitioned: map[string]bool{testBucket + "/experiment1/datatype1": true},
+			want: []*api.Datatype{
+				api.NewThirdPartyDatatype(
+					api.DatatypeOpts{
+						Name:        "datatype1",
+						Experiment:  "experiment1",
+						Version:     "v1",
+						Location:    "US",
+						Schema:      []byte(`[{"name": "id", "type": "STRING"}]`),
+						UpdatedTime: updated,
+						Bucket: &storagex.Bucket{
+							BucketHandle: &storage.BucketHandle{},
+						},
+						BucketName: testBucket,
+					}, testProject),
+			},
+		},
+		{
+			name: "partitioned-schema-without-date",
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: testBucket,
+						Name:       path.Join(prefix, "tables/experiment1/datatype1.table.json"),
+					},
+					Content: []byte(`[{"name": "id", "type": "STRING"}]`),
+				},
+			},
+			names:         []string{testBucket},
+			unpartitioned: map[string]bool{testBucket + "/experiment2/datatype1": true},
+			want:          []*api.Datatype{},
+			wantErr:       true,
+		},
+		{
+			name:    "inexistent-bucket",
+			names:   []string{"inexistent"},
+			want:    []*api.Datatype{},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
@@ -130,8 +301,15 @@ func TestClient_GetDatatypes(t *testing.T) {
 			testingx.Must(t, err, "error initializing GCS server")
 			defer server.Stop()
 			c := NewClient(server.Client(), tt.names, tt.mlabBucket, testProject)
+			c.Naming = tt.naming
+			c.Unpartitioned = func(bucket, experiment, datatype string) bool {
+				return tt.unpartitioned[path.Join(bucket, experiment, datatype)]
+			}
 
-			got := c.GetDatatypes(context.Background())
+			got, err := c.GetDatatypes(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.GetDatatypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
 			if !cmp.Equal(got, tt.want, cmpopts.IgnoreUnexported(storagex.Bucket{}, storage.BucketHandle{})) {
 				t.Errorf("Client.GetDatatypes() = %v, want %v", got, tt.want)
 			}
@@ -140,6 +318,8 @@ func TestClient_GetDatatypes(t *testing.T) {
 }
 
 func TestGetDirs(t *testing.T) {
+	updated := time.Date(2023, 03, 06, 12, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name    string
 		objs    []fakestorage.Object
@@ -157,6 +337,7 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -166,8 +347,9 @@ func TestGetDirs(t *testing.T) {
 			end:   "2023/03/07",
 			want: []Dir{
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
-					Date: time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
+					Date:    time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Updated: updated,
 				},
 			},
 		},
@@ -178,6 +360,7 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -187,8 +370,9 @@ func TestGetDirs(t *testing.T) {
 			end:   "2023/03/07",
 			want: []Dir{
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
-					Date: time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
+					Date:    time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Updated: updated,
 				},
 			},
 		},
@@ -199,18 +383,21 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/",
+						Updated:    updated,
 					},
 				},
 				{
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated.Add(time.Hour),
 					},
 				},
 				{
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/filename2.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -220,8 +407,9 @@ func TestGetDirs(t *testing.T) {
 			end:   "2023/03/07",
 			want: []Dir{
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
-					Date: time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "experiment1/datatype1/2023/03/06/*"),
+					Date:    time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Updated: updated.Add(time.Hour),
 				},
 			},
 		},
@@ -232,6 +420,7 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/invalid-day/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -248,6 +437,7 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/03/06/2023/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -264,6 +454,7 @@ func TestGetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -310,13 +501,80 @@ func TestGetDirs(t *testing.T) {
 				return
 			}
 
-			if !cmp.Equal(got, tt.want, cmpopts.EquateEmpty()) {
+			if !cmp.Equal(got, tt.want, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(Dir{}, "Fingerprint", "Files")) {
 				t.Errorf("Client.GetDirs() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestGetDirs_Fingerprint(t *testing.T) {
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			{
+				ObjectAttrs: fakestorage.ObjectAttrs{
+					BucketName: testBucket,
+					Name:       prefix + "experiment1/datatype1/2023/03/06/a.jsonl.gz",
+				},
+				Content: []byte("a"),
+			},
+			{
+				ObjectAttrs: fakestorage.ObjectAttrs{
+					BucketName: testBucket,
+					Name:       prefix + "experiment1/datatype1/2023/03/07/b.jsonl.gz",
+				},
+				Content: []byte("b"),
+			},
+		},
+	})
+	testingx.Must(t, err, "error initializing GCS server")
+	defer server.Stop()
+	client := server.Client()
+
+	dt := &api.Datatype{
+		DatatypeOpts: api.DatatypeOpts{
+			Name:       "datatype1",
+			Experiment: "experiment1",
+			Bucket: &storagex.Bucket{
+				BucketHandle: client.Bucket(testBucket),
+			},
+		},
+	}
+	c := &Client{}
+	getDirs := func() []Dir {
+		dirs, err := c.GetDirs(context.Background(), dt, "2023/03/05", "2023/03/08")
+		testingx.Must(t, err, "failed to get dirs")
+		if len(dirs) != 2 {
+			t.Fatalf("Client.GetDirs() = %v, want 2 dirs", dirs)
+		}
+		return dirs
+	}
+
+	first := getDirs()
+	if first[0].Fingerprint == "" || first[0].Fingerprint == first[1].Fingerprint {
+		t.Errorf("Client.GetDirs() fingerprints = %q, %q, want distinct", first[0].Fingerprint, first[1].Fingerprint)
+	}
+	if again := getDirs(); again[0].Fingerprint != first[0].Fingerprint {
+		t.Errorf("Client.GetDirs() fingerprint = %q, want unchanged %q", again[0].Fingerprint, first[0].Fingerprint)
+	}
+
+	// Adding an object changes the fingerprint of its directory only.
+	server.CreateObject(fakestorage.Object{
+		ObjectAttrs: fakestorage.ObjectAttrs{
+			BucketName: testBucket,
+			Name:       prefix + "experiment1/datatype1/2023/03/06/c.jsonl.gz",
+		},
+		Content: []byte("c"),
+	})
+	changed := getDirs()
+	if changed[0].Fingerprint == first[0].Fingerprint {
+		t.Errorf("Client.GetDirs() fingerprint unchanged after adding an object")
+	}
+	if changed[1].Fingerprint != first[1].Fingerprint {
+		t.Errorf("Client.GetDirs() fingerprint of unmodified dir changed")
+	}
+}
+
 func TestGetDirs_InvalidRegex(t *testing.T) {
 	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
 		InitialObjects: []fakestorage.Object{
@@ -397,3 +655,100 @@ type fakeErrReader struct{}
 func (r *fakeErrReader) NewReader(context.Context) (*storage.Reader, error) {
 	return nil, errors.New("error")
 }
+
+func TestPaths(t *testing.T) {
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "datatype1", Experiment: "experiment1"})
+	if got := DataPath(dt); got != "autoload/v1/experiment1/datatype1" {
+		t.Errorf("DataPath() = %s, want autoload/v1/experiment1/datatype1", got)
+	}
+	if got := SchemaFile(dt); got != "autoload/v1/tables/experiment1/datatype1.table.json" {
+		t.Errorf("SchemaFile() = %s, want autoload/v1/tables/experiment1/datatype1.table.json", got)
+	}
+}
+
+func TestGetDirs_Lines(t *testing.T) {
+	object := func(name, lines string) fakestorage.Object {
+		o := fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: prefix + "experiment1/datatype1/" + name},
+			Content:     []byte(name),
+		}
+		if lines != "" {
+			o.Metadata = map[string]string{LinesMetadataKey: lines}
+		}
+		return o
+	}
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			object("2023/03/05/a.jsonl.gz", "10"),
+			object("2023/03/05/b.jsonl.gz", "5"),
+			object("2023/03/06/a.jsonl.gz", "10"),
+			object("2023/03/06/b.jsonl.gz", ""),
+			object("2023/03/07/a.jsonl.gz", "0"),
+		},
+	})
+	testingx.Must(t, err, "error initializing GCS server")
+	defer server.Stop()
+
+	dt := &api.Datatype{
+		DatatypeOpts: api.DatatypeOpts{
+			Name:       "datatype1",
+			Experiment: "experiment1",
+			Bucket:     &storagex.Bucket{BucketHandle: server.Client().Bucket(testBucket)},
+		},
+	}
+	dirs, err := (&Client{}).GetDirs(context.Background(), dt, "2023/03/05", "2023/03/08")
+	testingx.Must(t, err, "failed to get dirs")
+
+	got := make([]string, 0)
+	for _, dir := range dirs {
+		if dir.Lines == nil {
+			got = append(got, "unknown")
+			continue
+		}
+		got = append(got, strconv.FormatInt(*dir.Lines, 10))
+	}
+	if diff := cmp.Diff(got, []string{"15", "unknown", "0"}); diff != "" {
+		t.Errorf("Client.GetDirs() lines mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestGetDirs_Files(t *testing.T) {
+	object := func(name string) fakestorage.Object {
+		return fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: prefix + "experiment1/datatype1/" + name},
+			Content:     []byte(name),
+		}
+	}
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			object("2023/03/05/a.jsonl.gz"),
+			object("2023/03/05/b.jsonl.gz"),
+			object("2023/03/06/a.jsonl.gz"),
+		},
+	})
+	testingx.Must(t, err, "error initializing GCS server")
+	defer server.Stop()
+
+	dt := &api.Datatype{
+		DatatypeOpts: api.DatatypeOpts{
+			Name:       "datatype1",
+			Experiment: "experiment1",
+			Bucket:     &storagex.Bucket{BucketHandle: server.Client().Bucket(testBucket)},
+		},
+	}
+	dirs, err := (&Client{}).GetDirs(context.Background(), dt, "2023/03/05", "2023/03/07")
+	testingx.Must(t, err, "failed to get dirs")
+
+	got := make([][]string, 0)
+	for _, dir := range dirs {
+		got = append(got, dir.Files)
+	}
+	uri := "gs://" + testBucket + "/" + prefix + "experiment1/datatype1/"
+	want := [][]string{
+		{uri + "2023/03/05/a.jsonl.gz", uri + "2023/03/05/b.jsonl.gz"},
+		{uri + "2023/03/06/a.jsonl.gz"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Client.GetDirs() files mismatch (-got +want):\n%s", diff)
+	}
+}
@@ -2,8 +2,7 @@ package v2
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"path"
 	"regexp"
 	"strings"
@@ -12,7 +11,11 @@ import (
 	"github.com/m-lab/autoloader/api"
 	apiv2 "github.com/m-lab/autoloader/api/v2"
 	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/schema"
+	"github.com/m-lab/autoloader/tracing"
 	"github.com/m-lab/go/storagex"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
 )
 
@@ -28,8 +31,58 @@ const (
 // ClientV2 is the V2 client used to interact with Google Cloud Storage.
 type ClientV2 struct {
 	Buckets []*storagex.Bucket
+	// Naming contains the naming rules for the buckets or projects that do not
+	// use the default naming conventions.
+	Naming api.NamingRules
+	// Policies maps bucket names to the policy deciding which organizations
+	// are loaded from them. All organizations are loaded from buckets not in
+	// the map.
+	Policies map[string]OrgPolicy
+	// Verifier checks the organizations of buckets whose policy requires it.
+	Verifier OrgVerifier
+	// Unpartitioned reports whether the table of a datatype is not
+	// partitioned (e.g., it is replaced as a whole), so its schema does not
+	// require a partition field. If nil, every table is partitioned.
+	Unpartitioned func(bucket, experiment, datatype string) bool
 }
 
+// OrgPolicy decides which organizations are loaded from a bucket.
+type OrgPolicy struct {
+	Allow  []string // If not empty, only these organizations are loaded.
+	Deny   []string // Organizations that are never loaded.
+	Verify bool     // Whether organizations must pass the client's Verifier.
+}
+
+// OrgVerifier verifies that an organization uploading to a bucket matches a
+// registered identity.
+type OrgVerifier interface {
+	Verify(ctx context.Context, bucket, org string) error
+}
+
+// Registry is an OrgVerifier accepting a fixed set of organizations.
+type Registry map[string]bool
+
+// Verify returns ErrUnregisteredOrganization if the organization is not in the
+// registry.
+func (r Registry) Verify(ctx context.Context, bucket, org string) error {
+	if !r[org] {
+		return ErrUnregisteredOrganization
+	}
+	return nil
+}
+
+var (
+	// ErrUnknownOrganization is returned for organizations not allowed by
+	// the bucket's policy.
+	ErrUnknownOrganization = errors.New("organization not allowed in bucket")
+	// ErrUnregisteredOrganization is returned by Registry for organizations
+	// that are not registered.
+	ErrUnregisteredOrganization = errors.New("organization not registered")
+	// errDeniedOrganization is returned for organizations denied by the
+	// bucket's policy.
+	errDeniedOrganization = errors.New("organization denied in bucket")
+)
+
 // BucketV2 represents a V2 GCS bucket.
 type BucketV2 struct {
 	*storagex.Bucket          // Bucket performs storage.BucketHandle operations.
@@ -50,35 +103,73 @@ func NewClient(c *storage.Client, names []string) *ClientV2 {
 }
 
 // GetDatatypes gets a list of datatypes for the ClientV2's buckets.
-func (c *ClientV2) GetDatatypes(ctx context.Context) []*api.Datatype {
-	datatypes := make([]*api.Datatype, 0)
+// Schema files are validated against the autoloader rules (see schema.Validate).
+// Invalid schema files do not stop the discovery. Instead, a *gcs.ObjectError
+// is collected for each of them and returned, joined, along with the datatypes
+// that were found.
+func (c *ClientV2) GetDatatypes(ctx context.Context) (datatypes []*api.Datatype, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gcs.v2.GetDatatypes")
+	defer func() { tracing.End(span, err) }()
+
+	datatypes = make([]*api.Datatype, 0)
+	errs := make([]error, 0)
 
 	for _, bucket := range c.Buckets {
+		name := gcs.BucketName(bucket)
 		orgs, err := getBucketOrgs(ctx, bucket)
 		if err != nil {
-			log.Printf("failed to get organizations for bucket: %v", err)
+			logging.FromContext(ctx).Error("failed to get organizations for bucket",
+				logging.BucketKey, name, logging.ErrorKey, err)
+			errs = append(errs, &gcs.ObjectError{Bucket: name, Path: prefix, Version: "v2", Err: err})
 			continue
 		}
+		checker := c.newOrgChecker(name)
+		orgs = checker.filter(ctx, orgs)
 		b := &BucketV2{Bucket: bucket, Organizations: orgs}
 
-		b.Walk(ctx, path.Join(prefix, "tables"), func(schema *storagex.Object) error {
-			dts, err := getDatatypes(ctx, b, schema)
+		p := path.Join(prefix, "tables")
+		wctx, wspan := tracing.Tracer().Start(ctx, "gcs.v2.Walk",
+			trace.WithAttributes(tracing.Bucket.String(name), tracing.Prefix.String(p)))
+		err = b.Walk(wctx, p, func(obj *storagex.Object) error {
+			dts, err := c.getDatatypes(wctx, b, obj)
 			if err != nil {
-				log.Printf("failed to get datatypes for schema: %v", err)
-				return err
+				logging.FromContext(ctx).Error("failed to get datatypes for schema",
+					logging.BucketKey, name, logging.PathKey, obj.Name, logging.ErrorKey, err)
+				errs = append(errs, &gcs.ObjectError{
+					Bucket:       name,
+					Path:         obj.Name,
+					Version:      "v2",
+					Organization: schemaOrganization(obj.Name),
+					Err:          err,
+				})
+				return nil
 			}
 
-			datatypes = append(datatypes, dts...)
+			// In-band schemas name their organization in the path.
+			for _, dt := range dts {
+				if checker.check(wctx, dt.Organization) {
+					datatypes = append(datatypes, dt)
+				}
+			}
 			return nil
 		})
+		if err != nil {
+			errs = append(errs, &gcs.ObjectError{Bucket: name, Path: p, Version: "v2", Err: err})
+		}
+		tracing.End(wspan, err)
+		errs = append(errs, checker.errs...)
 	}
 
-	return datatypes
+	return datatypes, errors.Join(errs...)
 }
 
 // getBucketOrgs gets the list of organizations uploading data to a bucket.
-func getBucketOrgs(ctx context.Context, b *storagex.Bucket) ([]string, error) {
-	orgs := make([]string, 0)
+func getBucketOrgs(ctx context.Context, b *storagex.Bucket) (orgs []string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gcs.v2.getBucketOrgs",
+		trace.WithAttributes(tracing.Prefix.String(prefix)))
+	defer func() { tracing.End(span, err) }()
+
+	orgs = make([]string, 0)
 
 	it := b.Objects(ctx, &storage.Query{
 		Prefix:    prefix,
@@ -103,19 +194,118 @@ func getBucketOrgs(ctx context.Context, b *storagex.Bucket) ([]string, error) {
 	}
 }
 
+// orgChecker applies a bucket's OrgPolicy, checking each organization once.
+type orgChecker struct {
+	bucket   string
+	policy   OrgPolicy
+	verifier OrgVerifier
+	checked  map[string]bool
+	errs     []error // Rejected organizations, except for denied ones.
+}
+
+func (c *ClientV2) newOrgChecker(bucket string) *orgChecker {
+	policy, ok := c.Policies[bucket]
+	if !ok {
+		return &orgChecker{bucket: bucket}
+	}
+	return &orgChecker{
+		bucket:   bucket,
+		policy:   policy,
+		verifier: c.Verifier,
+		checked:  make(map[string]bool),
+	}
+}
+
+// filter returns the organizations that may be loaded.
+func (oc *orgChecker) filter(ctx context.Context, orgs []string) []string {
+	result := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		if oc.check(ctx, org) {
+			result = append(result, org)
+		}
+	}
+	return result
+}
+
+// check returns whether the organization may be loaded. Organizations not
+// allowed or not verified are reported in errs; denied organizations are only
+// logged.
+func (oc *orgChecker) check(ctx context.Context, org string) bool {
+	if oc.checked == nil {
+		return true
+	}
+	if ok, found := oc.checked[org]; found {
+		return ok
+	}
+
+	err := oc.policy.check(ctx, oc.verifier, oc.bucket, org)
+	oc.checked[org] = err == nil
+	switch {
+	case err == nil:
+	case errors.Is(err, errDeniedOrganization):
+		logging.FromContext(ctx).Debug("skipping denied organization",
+			logging.BucketKey, oc.bucket, logging.OrganizationKey, org)
+	default:
+		oc.errs = append(oc.errs, &gcs.ObjectError{
+			Bucket:       oc.bucket,
+			Path:         path.Join(prefix, org) + "/",
+			Version:      "v2",
+			Organization: org,
+			Err:          err,
+		})
+	}
+	return err == nil
+}
+
+// check returns nil if the policy accepts the organization.
+func (p OrgPolicy) check(ctx context.Context, v OrgVerifier, bucket, org string) error {
+	if contains(p.Deny, org) {
+		return errDeniedOrganization
+	}
+	if len(p.Allow) != 0 && !contains(p.Allow, org) {
+		return ErrUnknownOrganization
+	}
+	if !p.Verify {
+		return nil
+	}
+	if v == nil {
+		return ErrUnregisteredOrganization
+	}
+	return v.Verify(ctx, bucket, org)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // getDatatypes gets the list of datatypes for a schema.
-func getDatatypes(ctx context.Context, b *BucketV2, schema *storagex.Object) ([]*api.Datatype, error) {
-	file, err := gcs.ReadFile(ctx, schema.ObjectHandle)
-	if err != nil || len(file) == 0 {
-		return nil, fmt.Errorf("invalid schema file under %s", schema.Name)
+func (c *ClientV2) getDatatypes(ctx context.Context, b *BucketV2, obj *storagex.Object) ([]*api.Datatype, error) {
+	file, err := gcs.ReadFile(ctx, obj.ObjectHandle)
+	if err != nil {
+		return nil, err
+	}
+	if len(file) == 0 {
+		return nil, gcs.ErrInvalidSchema
 	}
 
-	attrs, err := b.Attrs(ctx)
+	path, err := NewSchemaPath(ctx, b, obj.Name)
 	if err != nil {
 		return nil, err
 	}
+	parse := schema.Parse
+	if c.Unpartitioned != nil && c.Unpartitioned(obj.Bucket, path.Experiment, path.Datatype) {
+		parse = schema.ParseUnpartitioned
+	}
+	if _, err := parse(file); err != nil {
+		return nil, err
+	}
 
-	path, err := NewSchemaPath(ctx, b, schema.Name)
+	attrs, err := b.Attrs(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -129,17 +319,34 @@ func getDatatypes(ctx context.Context, b *BucketV2, schema *storagex.Object) ([]
 			Version:      "v2",
 			Location:     attrs.Location,
 			Schema:       file,
-			UpdatedTime:  schema.ObjectAttrs.Updated,
+			UpdatedTime:  obj.ObjectAttrs.Updated,
 			Bucket:       b.Bucket,
+			BucketName:   attrs.Name,
 		}
-		dts = append(dts, getDatatype(schema.Bucket, opts))
+		dt, err := NewDatatypeFromRules(c.Naming, obj.Bucket, opts)
+		if err != nil {
+			return nil, err
+		}
+		dts = append(dts, dt)
 	}
 
 	return dts, nil
 }
 
-// getDatatype creates a single datatype based on its project.
-func getDatatype(bucketName string, opts api.DatatypeOpts) *api.Datatype {
+// NewDatatypeFromRules creates a single datatype with the naming rule matching
+// its bucket or project. If no rule matches, it uses the default naming
+// conventions (see NewDatatype).
+func NewDatatypeFromRules(naming api.NamingRules, bucketName string, opts api.DatatypeOpts) (*api.Datatype, error) {
+	dt, err := naming.NewDatatype(opts, project.FindString(bucketName))
+	if dt != nil || err != nil {
+		return dt, err
+	}
+	return NewDatatype(bucketName, opts), nil
+}
+
+// NewDatatype creates a single datatype with the default naming conventions
+// of the project its bucket belongs to.
+func NewDatatype(bucketName string, opts api.DatatypeOpts) *api.Datatype {
 	proj := project.FindString(bucketName)
 	switch proj {
 	case "mlab-autojoin":
@@ -154,6 +361,24 @@ func getDatatype(bucketName string, opts api.DatatypeOpts) *api.Datatype {
 // GetDirs returns all the directory paths for a datatype within a start (inclusive) and
 // end (exclusive) date.
 func (c *ClientV2) GetDirs(ctx context.Context, dt *api.Datatype, start, end string) ([]gcs.Dir, error) {
-	p := path.Join(prefix, dt.Organization, dt.Experiment, dt.Name)
-	return gcs.GetDirs(ctx, dt, p, start, end)
+	return gcs.GetDirs(ctx, dt, DataPath(dt), start, end)
+}
+
+// DataPath returns the GCS path containing the data of a datatype
+// (i.e., "autoload/v2/<organization>/<experiment>/<datatype>").
+func DataPath(dt *api.Datatype) string {
+	return path.Join(prefix, dt.Organization, dt.Experiment, dt.Name)
+}
+
+// SchemaFile returns the GCS path of the in-band schema file of a datatype
+// (i.e., "autoload/v2/tables/<organization>/<experiment>/<datatype>.table.json").
+func SchemaFile(dt *api.Datatype) string {
+	return path.Join(prefix, "tables", dt.Organization, dt.Experiment, dt.Name+schemaFileSuffix)
+}
+
+// SharedSchemaFile returns the GCS path of the out-of-band schema file of a
+// datatype, which is shared by all the organizations uploading it
+// (i.e., "autoload/v2/tables/<experiment>/<datatype>.table.json").
+func SharedSchemaFile(dt *api.Datatype) string {
+	return path.Join(prefix, "tables", dt.Experiment, dt.Name+schemaFileSuffix)
 }
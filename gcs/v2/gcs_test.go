@@ -2,6 +2,7 @@ package v2
 
 import (
 	"context"
+	"errors"
 	"path"
 	"sort"
 	"testing"
@@ -21,76 +22,126 @@ import (
 func TestClient_GetDatatypes(t *testing.T) {
 	updated := time.Date(02, 02, 2023, 3, 15, 0, 0, time.UTC)
 
-	tests := []struct {
-		name  string
-		buckets []string
-		objs  []fakestorage.Object
-		want  []*api.Datatype
-	}{
+	sandboxObjs := []fakestorage.Object{
+		// Out-of-band schema.
 		{
-			name: "mlab",
-			objs: []fakestorage.Object{
-				// Out-of-band schema.
-				{
-					ObjectAttrs: fakestorage.ObjectAttrs{
-						BucketName: "archive-mlab-sandbox",
-						Name:       path.Join(prefix, "tables/experiment1/datatype1"),
-						Updated:    updated,
-					},
-					Content: testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
-				},
-				// In-band schema.
-				{
-					ObjectAttrs: fakestorage.ObjectAttrs{
-						BucketName: "archive-mlab-sandbox",
-						Name:       path.Join(prefix, "tables/mlab/experiment2/datatype2"),
-						Updated:    updated,
-					},
-					Content: testingx.MustReadFile(t, "testdata/mlab/experiment2/datatype2.table.json"),
-				},
-				// Data.
-				{
-					ObjectAttrs: fakestorage.ObjectAttrs{
-						BucketName: "archive-mlab-sandbox",
-						Name:       path.Join(prefix, "mlab/experiment1/datatype1/2023/03/06/filename.jsonl.gz"),
-					},
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: "archive-mlab-sandbox",
+				Name:       path.Join(prefix, "tables/experiment1/datatype1"),
+				Updated:    updated,
+			},
+			Content: testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+		},
+		// In-band schema.
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: "archive-mlab-sandbox",
+				Name:       path.Join(prefix, "tables/mlab/experiment2/datatype2"),
+				Updated:    updated,
+			},
+			Content: testingx.MustReadFile(t, "testdata/mlab/experiment2/datatype2.table.json"),
+		},
+		// Data.
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: "archive-mlab-sandbox",
+				Name:       path.Join(prefix, "mlab/experiment1/datatype1/2023/03/06/filename.jsonl.gz"),
+			},
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: "archive-mlab-sandbox",
+				Name:       path.Join(prefix, "mlab/experiment2/datatype2/2023/03/06/filename.jsonl.gz"),
+			},
+		},
+	}
+	sandboxWant := []*api.Datatype{
+		apiv2.NewMlabDatatype(
+			api.DatatypeOpts{
+				Name:         "datatype1",
+				Experiment:   "experiment1",
+				Organization: "mlab",
+				Version:      "v2",
+				Location:     "US",
+				Schema:       testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
+				UpdatedTime:  updated,
+				Bucket: &storagex.Bucket{
+					BucketHandle: &storage.BucketHandle{},
 				},
-				{
-					ObjectAttrs: fakestorage.ObjectAttrs{
-						BucketName: "archive-mlab-sandbox",
-						Name:       path.Join(prefix, "mlab/experiment2/datatype2/2023/03/06/filename.jsonl.gz"),
-					},
+				BucketName: "archive-mlab-sandbox",
+			}),
+		apiv2.NewMlabDatatype(
+			api.DatatypeOpts{
+				Name:         "datatype2",
+				Experiment:   "experiment2",
+				Organization: "mlab",
+				Version:      "v2",
+				Location:     "US",
+				Schema:       testingx.MustReadFile(t, "testdata/mlab/experiment2/datatype2.table.json"),
+				UpdatedTime:  updated,
+				Bucket: &storagex.Bucket{
+					BucketHandle: &storage.BucketHandle{},
 				},
-			},
+				BucketName: "archive-mlab-sandbox",
+			}),
+	}
+
+	tests := []struct {
+		name     string
+		buckets  []string
+		policy   *OrgPolicy
+		verifier OrgVerifier
+		objs     []fakestorage.Object
+		// unpartitioned contains the datatypes whose tables are not
+		// partitioned, as "<bucket>/<experiment>/<datatype>".
+		unpartitioned map[string]bool
+		want          []*api.Datatype
+		wantErr       bool
+	}{
+		{
+			name:    "mlab",
+			objs:    sandboxObjs,
 			buckets: []string{"archive-mlab-sandbox"},
-			want: []*api.Datatype{
-				apiv2.NewMlabDatatype(
-					api.DatatypeOpts{
-						Name:         "datatype1",
-						Experiment:   "experiment1",
-						Organization: "mlab",
-						Version:      "v2",
-						Location:     "US",
-						Schema:       testingx.MustReadFile(t, "testdata/experiment1/datatype1.table.json"),
-						UpdatedTime:  updated,
-						Bucket: &storagex.Bucket{
-							BucketHandle: &storage.BucketHandle{},
-						},
-					}),
-				apiv2.NewMlabDatatype(
-					api.DatatypeOpts{
-						Name:         "datatype2",
-						Experiment:   "experiment2",
-						Organization: "mlab",
-						Version:      "v2",
-						Location:     "US",
-						Schema:       testingx.MustReadFile(t, "testdata/mlab/experiment2/datatype2.table.json"),
-						UpdatedTime:  updated,
-						Bucket: &storagex.Bucket{
-							BucketHandle: &storage.BucketHandle{},
-						},
-					}),
-			},
+			want:    sandboxWant,
+		},
+		{
+			name:    "organization-allowed",
+			objs:    sandboxObjs,
+			buckets: []string{"archive-mlab-sandbox"},
+			policy:  &OrgPolicy{Allow: []string{"mlab"}},
+			want:    sandboxWant,
+		},
+		{
+			name:    "organization-not-allowed",
+			objs:    sandboxObjs,
+			buckets: []string{"archive-mlab-sandbox"},
+			policy:  &OrgPolicy{Allow: []string{"other-org"}},
+			want:    []*api.Datatype{},
+			wantErr: true,
+		},
+		{
+			name:    "organization-denied",
+			objs:    sandboxObjs,
+			buckets: []string{"archive-mlab-sandbox"},
+			policy:  &OrgPolicy{Deny: []string{"mlab"}},
+			want:    []*api.Datatype{},
+		},
+		{
+			name:     "organization-verified",
+			objs:     sandboxObjs,
+			buckets:  []string{"archive-mlab-sandbox"},
+			policy:   &OrgPolicy{Verify: true},
+			verifier: Registry{"mlab": true},
+			want:     sandboxWant,
+		},
+		{
+			name:     "organization-not-registered",
+			objs:     sandboxObjs,
+			buckets:  []string{"archive-mlab-sandbox"},
+			policy:   &OrgPolicy{Verify: true},
+			verifier: Registry{"other-org": true},
+			want:     []*api.Datatype{},
+			wantErr:  true,
 		},
 		{
 			name: "autojoin",
@@ -141,6 +192,7 @@ func TestClient_GetDatatypes(t *testing.T) {
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-mlab-autojoin",
 					}, "mlab-autojoin",
 				),
 				apiv2.NewBYODatatype(
@@ -155,6 +207,7 @@ func TestClient_GetDatatypes(t *testing.T) {
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-mlab-autojoin",
 					}, "mlab-autojoin",
 				),
 			},
@@ -208,6 +261,7 @@ func TestClient_GetDatatypes(t *testing.T) {
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-mlab-thirdparty",
 					}, "mlab-thirdparty",
 				),
 				apiv2.NewBYODatatype(
@@ -222,18 +276,67 @@ func TestClient_GetDatatypes(t *testing.T) {
 						Bucket: &storagex.Bucket{
 							BucketHandle: &storage.BucketHandle{},
 						},
+						BucketName: "archive-mlab-thirdparty",
 					}, "mlab-thirdparty",
 				),
 			},
 		},
 		{
-			name:  "inexistent-bucket",
+			name:    "inexistent-bucket",
 			buckets: []string{"archive-not-existent"},
-			objs:  []fakestorage.Object{},
-			want:  []*api.Datatype{},
+			objs:    []fakestorage.Object{},
+			want:    []*api.Datatype{},
+			wantErr: true,
+		},
+		{
+			name:    "unpartitioned-schema-without-date",
+			buckets: []string{"archive-mlab-sandbox"},
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: "archive-mlab-sandbox",
+						Name:       path.Join(prefix, "tables/mlab/experiment2/datatype2.table.json"),
+						Updated:    updated,
+					},
+					Content: []byte(`[{"name": "id", "type": "STRING"}]`),
+				},
+			},
+			unpartitioned: map[string]bool{"archive-mlab-sandbox/experiment2/datatype2": true},
+			want: []*api.Datatype{
+				apiv2.NewMlabDatatype(
+					api.DatatypeOpts{
+						Name:         "datatype2",
+						Experiment:   "experiment2",
+						Organization: "mlab",
+						Version:      "v2",
+						Location:     "US",
+						Schema:       []byte(`[{"name": "id", "type": "STRING"}]`),
+						UpdatedTime:  updated,
+						Bucket: &storagex.Bucket{
+							BucketHandle: &storage.BucketHandle{},
+						},
+						BucketName: "archive-mlab-sandbox",
+					}),
+			},
 		},
 		{
-			name:  "invalid-schema-file",
+			name:    "partitioned-schema-without-date",
+			buckets: []string{"archive-mlab-sandbox"},
+			objs: []fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{
+						BucketName: "archive-mlab-sandbox",
+						Name:       path.Join(prefix, "tables/mlab/experiment2/datatype2.table.json"),
+						Updated:    updated,
+					},
+					Content: []byte(`[{"name": "id", "type": "STRING"}]`),
+				},
+			},
+			want:    []*api.Datatype{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid-schema-file",
 			buckets: []string{"archive-mlab-sandbox"},
 			objs: []fakestorage.Object{
 				{
@@ -245,7 +348,8 @@ func TestClient_GetDatatypes(t *testing.T) {
 					Content: nil, // nil file.
 				},
 			},
-			want: []*api.Datatype{},
+			want:    []*api.Datatype{},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
@@ -257,8 +361,18 @@ func TestClient_GetDatatypes(t *testing.T) {
 			testingx.Must(t, err, "error initializing GCS server")
 			defer server.Stop()
 			c := NewClient(server.Client(), tt.buckets)
+			if tt.policy != nil {
+				c.Policies = map[string]OrgPolicy{tt.buckets[0]: *tt.policy}
+			}
+			c.Verifier = tt.verifier
+			c.Unpartitioned = func(bucket, experiment, datatype string) bool {
+				return tt.unpartitioned[path.Join(bucket, experiment, datatype)]
+			}
 
-			got := c.GetDatatypes(context.Background())
+			got, err := c.GetDatatypes(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.GetDatatypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
 			sortDatatypes(got)
 			if !cmp.Equal(got, tt.want, cmpopts.IgnoreUnexported(storagex.Bucket{}, storage.BucketHandle{})) {
 				t.Errorf("Client.GetDatatypes() = %v, want %v", got, tt.want)
@@ -274,6 +388,8 @@ func sortDatatypes(dts []*api.Datatype) {
 }
 
 func TestClientV2_GetDirs(t *testing.T) {
+	updated := time.Date(2023, 03, 06, 12, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name    string
 		objs    []fakestorage.Object
@@ -290,6 +406,7 @@ func TestClientV2_GetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "organization1/experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -304,8 +421,9 @@ func TestClientV2_GetDirs(t *testing.T) {
 			end:   "2023/03/07",
 			want: []gcs.Dir{
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/06/*"),
-					Date: time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/06/*"),
+					Date:    time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Updated: updated,
 				},
 			},
 		},
@@ -316,18 +434,21 @@ func TestClientV2_GetDirs(t *testing.T) {
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "organization1/experiment1/datatype1/2023/03/05/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 				{
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "organization1/experiment1/datatype1/2023/03/06/filename.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 				{
 					ObjectAttrs: fakestorage.ObjectAttrs{
 						BucketName: testBucket,
 						Name:       prefix + "other-organization/experiment1/datatype1/2023/03/06/filename2.jsonl.gz",
+						Updated:    updated,
 					},
 				},
 			},
@@ -342,12 +463,14 @@ func TestClientV2_GetDirs(t *testing.T) {
 			end:   "2023/03/07",
 			want: []gcs.Dir{
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/05/*"),
-					Date: time.Date(2023, 03, 05, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/05/*"),
+					Date:    time.Date(2023, 03, 05, 0, 0, 0, 0, time.UTC),
+					Updated: updated,
 				},
 				{
-					Path: "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/06/*"),
-					Date: time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Path:    "gs://" + path.Join(testBucket, prefix, "organization1/experiment1/datatype1/2023/03/06/*"),
+					Date:    time.Date(2023, 03, 06, 0, 0, 0, 0, time.UTC),
+					Updated: updated,
 				},
 			},
 		},
@@ -387,9 +510,138 @@ func TestClientV2_GetDirs(t *testing.T) {
 				return
 			}
 
-			if !cmp.Equal(got, tt.want, cmpopts.EquateEmpty()) {
+			if !cmp.Equal(got, tt.want, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(gcs.Dir{}, "Fingerprint", "Files")) {
 				t.Errorf("ClientV2.GetDirs() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestPaths(t *testing.T) {
+	dt := NewDatatype("archive-mlab-autojoin", api.DatatypeOpts{
+		Name:         "datatype1",
+		Experiment:   "experiment1",
+		Organization: "org1",
+		Version:      "v2",
+	})
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "data", got: DataPath(dt), want: "autoload/v2/org1/experiment1/datatype1"},
+		{name: "schema", got: SchemaFile(dt), want: "autoload/v2/tables/org1/experiment1/datatype1.table.json"},
+		{name: "shared-schema", got: SharedSchemaFile(dt), want: "autoload/v2/tables/experiment1/datatype1.table.json"},
+		{name: "view-dataset", got: dt.ViewDataset(), want: "autojoin_v2_experiment1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDatatypeFromRules(t *testing.T) {
+	naming := api.NamingRules{
+		{
+			Project:    "mlab-newsub",
+			UpdateView: true,
+			NamingTemplates: api.NamingTemplates{
+				Dataset:     "autoload_{{.Version}}_{{.Organization}}_{{.Experiment}}",
+				Table:       "{{.Datatype}}_raw",
+				ViewDataset: "{{.SubProject}}_{{.Version}}_{{.Experiment}}",
+				ViewTable:   "{{.Datatype}}_raw",
+			},
+		},
+	}
+	opts := api.DatatypeOpts{Name: "datatype1", Experiment: "experiment1", Organization: "org1", Version: "v2"}
+
+	tests := []struct {
+		name     string
+		bucket   string
+		wantView string
+	}{
+		{
+			name:     "rule",
+			bucket:   "archive-mlab-newsub",
+			wantView: "newsub_v2_experiment1",
+		},
+		{
+			name:     "default",
+			bucket:   "archive-mlab-autojoin",
+			wantView: "autojoin_v2_experiment1",
+		},
+		{
+			name:     "default-mlab",
+			bucket:   "archive-mlab-sandbox",
+			wantView: "mlab_v2_experiment1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := opts
+			o.BucketName = tt.bucket
+			dt, err := NewDatatypeFromRules(naming, tt.bucket, o)
+			testingx.Must(t, err, "failed to create datatype")
+			if dt.Dataset() != "autoload_v2_org1_experiment1" || dt.ViewDataset() != tt.wantView {
+				t.Errorf("NewDatatypeFromRules() = %s, %s, want autoload_v2_org1_experiment1, %s",
+					dt.Dataset(), dt.ViewDataset(), tt.wantView)
+			}
+		})
+	}
+}
+
+func TestOrgPolicy_check(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OrgPolicy
+		verifier OrgVerifier
+		org      string
+		want     error
+	}{
+		{
+			name: "no-policy",
+			org:  "org",
+		},
+		{
+			name:   "denied",
+			policy: OrgPolicy{Allow: []string{"org"}, Deny: []string{"org"}},
+			org:    "org",
+			want:   errDeniedOrganization,
+		},
+		{
+			name:   "unknown",
+			policy: OrgPolicy{Allow: []string{"other"}},
+			org:    "org",
+			want:   ErrUnknownOrganization,
+		},
+		{
+			name:     "registered",
+			policy:   OrgPolicy{Verify: true},
+			verifier: Registry{"org": true},
+			org:      "org",
+		},
+		{
+			name:     "unregistered",
+			policy:   OrgPolicy{Verify: true},
+			verifier: Registry{},
+			org:      "org",
+			want:     ErrUnregisteredOrganization,
+		},
+		{
+			name:   "no-verifier",
+			policy: OrgPolicy{Verify: true},
+			org:    "org",
+			want:   ErrUnregisteredOrganization,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.check(context.Background(), tt.verifier, "bucket", tt.org); !errors.Is(got, tt.want) {
+				t.Errorf("OrgPolicy.check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
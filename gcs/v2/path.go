@@ -41,6 +41,16 @@ func NewSchemaPath(ctx context.Context, b *BucketV2, schemaPath string) (*Schema
 	}
 }
 
+// schemaOrganization returns the organization named by an in-band schema
+// path, or "" for out-of-band schemas and invalid paths.
+func schemaOrganization(schemaPath string) string {
+	parts := strings.Split(schemaPath, "/")
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[3]
+}
+
 func datatypeOrgs(ctx context.Context, b *BucketV2, exp, dt string) []string {
 	orgs := make([]string, 0)
 
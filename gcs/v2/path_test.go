@@ -108,3 +108,19 @@ func TestNewPath(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaOrganization(t *testing.T) {
+	tests := []struct {
+		schemaPath string
+		want       string
+	}{
+		{path.Join(prefix, "tables/organization1/experiment1/datatype1.table.json"), "organization1"},
+		{path.Join(prefix, "tables/experiment1/datatype1.table.json"), ""},
+		{path.Join(prefix), ""},
+	}
+	for _, tt := range tests {
+		if got := schemaOrganization(tt.schemaPath); got != tt.want {
+			t.Errorf("schemaOrganization(%q) = %q, want %q", tt.schemaPath, got, tt.want)
+		}
+	}
+}
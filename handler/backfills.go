@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/go/timex"
+)
+
+const (
+	// periodEverything loads the complete history of a datatype. These loads
+	// are backfills, which are checkpointed and resumed if interrupted.
+	periodEverything = "everything"
+
+	// maxBackfillAttempts is the number of times a backfill interrupted by a
+	// restart is resumed by periodic loads before it is marked failed.
+	maxBackfillAttempts = 3
+)
+
+var errBackfillRunning = errors.New("backfill already in progress")
+
+// backfill is an in-progress load of the complete history of a datatype.
+type backfill struct {
+	cp      state.Backfill // Protected by backfillLog.mu.
+	failed  bool           // Whether a partition failed, so cp.Next no longer advances.
+	discard bool           // Whether to delete the checkpoint when the backfill ends.
+	cancel  context.CancelFunc
+}
+
+// backfillLog keeps the in-progress backfills.
+type backfillLog struct {
+	mu      sync.Mutex
+	running map[string]*backfill // Keyed by datatype ID.
+}
+
+func newBackfillLog() *backfillLog {
+	return &backfillLog{running: make(map[string]*backfill)}
+}
+
+// checkpoints returns the state store if it keeps backfill checkpoints. If not,
+// backfills are only tracked while in progress.
+func (c *Client) checkpoints() state.BackfillStore {
+	bs, _ := c.State.(state.BackfillStore)
+	return bs
+}
+
+// startBackfill registers a backfill of the datatype. If a previous backfill
+// did not complete, it resumes from its checkpoint. It returns the backfill,
+// a context canceled when the backfill is, and the options selecting the
+// partitions left to load.
+func (c *Client) startBackfill(ctx context.Context, dt *api.Datatype, opts *LoadOptions) (*backfill, context.Context, *LoadOptions, error) {
+	logger := logging.FromContext(ctx)
+	now := time.Now().UTC()
+	ctx, cancel := context.WithCancel(ctx)
+	bf := &backfill{
+		cp: state.Backfill{
+			Datatype:     dt.ID(),
+			Experiment:   dt.Experiment,
+			Name:         dt.Name,
+			Organization: dt.Organization,
+			RunID:        audit.TriggerFromContext(ctx).RunID,
+			Start:        opts.start,
+			Next:         opts.start,
+			Status:       state.BackfillRunning,
+			Attempts:     1,
+			Started:      now,
+			Updated:      now,
+		},
+		cancel: cancel,
+	}
+
+	c.backfills.mu.Lock()
+	if _, ok := c.backfills.running[bf.cp.Datatype]; ok {
+		c.backfills.mu.Unlock()
+		cancel()
+		return nil, nil, nil, errBackfillRunning
+	}
+	c.backfills.running[bf.cp.Datatype] = bf
+
+	if store := c.checkpoints(); store != nil {
+		prev, err := store.GetBackfill(ctx, bf.cp.Datatype)
+		switch {
+		case err == nil:
+			bf.cp.Start, bf.cp.Next, bf.cp.Loaded, bf.cp.Started = prev.Start, prev.Next, prev.Loaded, prev.Started
+			bf.cp.Attempts = prev.Attempts + 1
+			opts = &LoadOptions{start: prev.Next, end: opts.end, period: opts.period}
+			logger.Info("resuming backfill", "next", prev.Next, "loaded", prev.Loaded, "attempt", bf.cp.Attempts)
+		case !errors.Is(err, state.ErrNotFound):
+			logger.Warn("failed to get backfill checkpoint, starting over", logging.ErrorKey, err)
+		}
+	}
+	cp := bf.cp
+	c.backfills.mu.Unlock()
+
+	c.saveBackfill(ctx, &cp)
+	return bf, ctx, opts, nil
+}
+
+// pendingBackfill reports whether the datatype has a checkpoint of a backfill
+// which was interrupted by a restart, i.e., is still running but not in
+// progress. Failed and cancelled backfills are only resumed by a request for
+// the complete history, so that a partition failing permanently does not turn
+// every periodic load into a backfill. A backfill interrupted
+// maxBackfillAttempts times is marked failed instead.
+func (c *Client) pendingBackfill(ctx context.Context, dt *api.Datatype) bool {
+	store := c.checkpoints()
+	if store == nil {
+		return false
+	}
+	c.backfills.mu.Lock()
+	_, running := c.backfills.running[dt.ID()]
+	c.backfills.mu.Unlock()
+	if running {
+		return false
+	}
+	logger := logging.FromContext(ctx)
+	cp, err := store.GetBackfill(ctx, dt.ID())
+	if err != nil {
+		if !errors.Is(err, state.ErrNotFound) {
+			logger.Warn("failed to get backfill checkpoint", logging.ErrorKey, err)
+		}
+		return false
+	}
+	if cp.Status != state.BackfillRunning {
+		return false
+	}
+	if cp.Attempts >= maxBackfillAttempts {
+		logger.Warn("giving up on interrupted backfill", "next", cp.Next, "attempts", cp.Attempts)
+		cp.Status = state.BackfillFailed
+		cp.Error = fmt.Sprintf("interrupted after %d attempts", cp.Attempts)
+		cp.Updated = time.Now().UTC()
+		c.saveBackfill(ctx, cp)
+		return false
+	}
+	return true
+}
+
+// progressBackfill records the outcome of loading a partition. The checkpoint
+// advances past the partition unless it, or a previous one, failed.
+func (c *Client) progressBackfill(ctx context.Context, bf *backfill, dir gcs.Dir, err error) {
+	c.backfills.mu.Lock()
+	bf.cp.Updated = time.Now().UTC()
+	switch {
+	case err != nil && !bf.failed:
+		bf.failed = true
+		bf.cp.Next = dir.Date.Format(timex.YYYYMMDDWithSlash)
+	case err == nil:
+		bf.cp.Loaded++
+		if !bf.failed {
+			bf.cp.Next = dir.Date.AddDate(0, 0, 1).Format(timex.YYYYMMDDWithSlash)
+		}
+	}
+	cp := bf.cp
+	c.backfills.mu.Unlock()
+	c.saveBackfill(ctx, &cp)
+}
+
+// finishBackfill unregisters a backfill. Its checkpoint is deleted if it
+// completed or was discarded, and kept for the next backfill otherwise.
+func (c *Client) finishBackfill(ctx context.Context, bf *backfill, err error) {
+	c.backfills.mu.Lock()
+	delete(c.backfills.running, bf.cp.Datatype)
+	bf.cp.Updated = time.Now().UTC()
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		bf.cp.Status = state.BackfillCancelled
+	default:
+		bf.cp.Status, bf.cp.Error = state.BackfillFailed, err.Error()
+	}
+	cp, discard := bf.cp, bf.discard
+	c.backfills.mu.Unlock()
+	bf.cancel()
+
+	ctx = detach(ctx)
+	logger := logging.FromContext(ctx)
+	if err == nil || discard {
+		logger.Info("finished backfill", "loaded", cp.Loaded, "status", cp.Status, "discarded", discard)
+		c.discardBackfill(ctx, cp.Datatype)
+		return
+	}
+	logger.Warn("interrupted backfill", "next", cp.Next, "loaded", cp.Loaded, "status", cp.Status)
+	c.saveBackfill(ctx, &cp)
+}
+
+// saveBackfill stores a backfill checkpoint. Failures are logged, but do not
+// fail the backfill.
+func (c *Client) saveBackfill(ctx context.Context, cp *state.Backfill) {
+	store := c.checkpoints()
+	if store == nil {
+		return
+	}
+	if err := store.PutBackfill(detach(ctx), cp); err != nil {
+		logging.FromContext(ctx).Error("failed to save backfill checkpoint", logging.ErrorKey, err)
+	}
+}
+
+// discardBackfill deletes the checkpoint of a datatype, so its next backfill
+// starts from the beginning.
+func (c *Client) discardBackfill(ctx context.Context, id string) {
+	store := c.checkpoints()
+	if store == nil {
+		return
+	}
+	if err := store.DeleteBackfill(ctx, id); err != nil {
+		logging.FromContext(ctx).Error("failed to delete backfill checkpoint", logging.ErrorKey, err)
+	}
+}
+
+// Backfills writes the in-progress backfills and the checkpoints of the
+// interrupted ones selected by the `experiment`, `datatype` and `organization`
+// query parameters as JSON. DELETE requests cancel the selected in-progress
+// backfills and write them. With `discard=true`, their checkpoints are also
+// deleted, so the next backfill starts from the beginning.
+func (c *Client) Backfills(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		backfills, err := c.listBackfills(r.Context(), getFilter(r.URL.Query()))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		writeJSON(w, backfills)
+	case http.MethodDelete:
+		f := getFilter(r.URL.Query())
+		discard := r.URL.Query().Get("discard") == "true"
+		writeJSON(w, c.cancelBackfills(r.Context(), f, discard))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// listBackfills returns the in-progress backfills and the stored checkpoints
+// matching the filter, sorted by datatype.
+func (c *Client) listBackfills(ctx context.Context, f Filter) ([]state.Backfill, error) {
+	byID := make(map[string]state.Backfill)
+	if store := c.checkpoints(); store != nil {
+		stored, err := store.Backfills(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range stored {
+			byID[b.Datatype] = *b
+		}
+	}
+	c.backfills.mu.Lock()
+	for id, bf := range c.backfills.running {
+		byID[id] = bf.cp
+	}
+	c.backfills.mu.Unlock()
+
+	backfills := make([]state.Backfill, 0, len(byID))
+	for _, b := range byID {
+		if f.matchBackfill(&b) {
+			backfills = append(backfills, b)
+		}
+	}
+	sort.Slice(backfills, func(i, j int) bool { return backfills[i].Datatype < backfills[j].Datatype })
+	return backfills, nil
+}
+
+// cancelBackfills cancels the in-progress backfills matching the filter and
+// returns them. If discard is true, the checkpoints of the matching backfills
+// are deleted, including those of the interrupted ones.
+func (c *Client) cancelBackfills(ctx context.Context, f Filter, discard bool) []state.Backfill {
+	logger := logging.FromContext(ctx)
+	cancelled := make([]state.Backfill, 0)
+	c.backfills.mu.Lock()
+	for _, bf := range c.backfills.running {
+		if !f.matchBackfill(&bf.cp) {
+			continue
+		}
+		bf.discard = bf.discard || discard
+		bf.cancel()
+		cancelled = append(cancelled, bf.cp)
+		logger.Info("cancelled backfill", "audit", true, logging.DatatypeKey, bf.cp.Datatype, "discard", discard)
+	}
+	c.backfills.mu.Unlock()
+
+	if store := c.checkpoints(); discard && store != nil {
+		stored, err := store.Backfills(ctx)
+		if err != nil {
+			logger.Error("failed to list backfill checkpoints", logging.ErrorKey, err)
+		}
+		for _, b := range stored {
+			if f.matchBackfill(b) {
+				c.discardBackfill(ctx, b.Datatype)
+			}
+		}
+	}
+	sort.Slice(cancelled, func(i, j int) bool { return cancelled[i].Datatype < cancelled[j].Datatype })
+	return cancelled
+}
+
+// detach returns a context with the logger of ctx which is not canceled with
+// it, so checkpoints are saved after a backfill is cancelled.
+func detach(ctx context.Context) context.Context {
+	return logging.NewContext(context.Background(), logging.FromContext(ctx))
+}
+
+// matchBackfill reports whether the backfill's datatype is selected by the
+// filter.
+func (f Filter) matchBackfill(b *state.Backfill) bool {
+	return (f.Experiment == "" || f.Experiment == b.Experiment) &&
+		(f.Datatype == "" || f.Datatype == b.Name) &&
+		(f.Organization == "" || f.Organization == b.Organization)
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/go/cloudtest/bqfake"
+	"github.com/m-lab/go/testingx"
+)
+
+// startStorage records the start dates of the GetDirs calls.
+type startStorage struct {
+	*fakeStorage
+	start  string // Of the last call.
+	starts []string
+}
+
+func (s *startStorage) GetDirs(ctx context.Context, dt *api.Datatype, start, end string) ([]gcs.Dir, error) {
+	s.start = start
+	s.starts = append(s.starts, start)
+	return s.fakeStorage.GetDirs(ctx, dt, start, end)
+}
+
+// partitionBQ fails the loads of the partitions in fail.
+type partitionBQ struct {
+	*fakeBQ
+	fail map[string]bool
+}
+
+func (b *partitionBQ) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (*bq.LoadStatistics, error) {
+	if b.fail[name] {
+		return nil, errors.New("failed to load")
+	}
+	return b.fakeBQ.Load(ctx, ds, name, uri...)
+}
+
+func openBackfillStore(t *testing.T) *state.BoltStore {
+	store, err := state.OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	testingx.Must(t, err, "failed to open state store")
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestClient_loadBackfill(t *testing.T) {
+	store := openBackfillStore(t)
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+	storage := &startStorage{fakeStorage: &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"backfill": {
+				{Path: "gs://bucket/exp/backfill/2023/06/01/*", Date: day(1)},
+				{Path: "gs://bucket/exp/backfill/2023/06/02/*", Date: day(2)},
+				{Path: "gs://bucket/exp/backfill/2023/06/03/*", Date: day(3)},
+			},
+		},
+	}}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "backfill", Experiment: "exp", BucketName: "bucket"})
+	fbq := &partitionBQ{fakeBQ: &fakeBQ{}, fail: map[string]bool{"backfill$20230602": true}}
+	c := NewClient(storage, fbq)
+	c.State = store
+	ctx := context.Background()
+
+	if err := c.load(ctx, nil, dt, periodOpts(periodEverything)); err == nil {
+		t.Fatalf("Client.load() error = nil, want error")
+	}
+	cp, err := store.GetBackfill(ctx, dt.ID())
+	testingx.Must(t, err, "failed to get checkpoint")
+	if cp.Next != "2023/06/02" || cp.Loaded != 2 || cp.Status != state.BackfillFailed || cp.Start != start || cp.Attempts != 1 {
+		t.Errorf("Client.load() checkpoint = %+v", cp)
+	}
+
+	// The next backfill resumes from the failed partition and, once complete,
+	// deletes the checkpoint.
+	fbq.fail = nil
+	testingx.Must(t, c.load(ctx, nil, dt, periodOpts(periodEverything)), "failed to resume")
+	if storage.start != "2023/06/02" {
+		t.Errorf("Client.load() resumed from %q, want %q", storage.start, "2023/06/02")
+	}
+	if _, err := store.GetBackfill(ctx, dt.ID()); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("Client.load() checkpoint error = %v, want %v", err, state.ErrNotFound)
+	}
+
+	// Loads of other periods are not backfills.
+	fbq.fail = map[string]bool{"backfill$20230601": true}
+	if err := c.load(ctx, nil, dt, periodOpts("daily")); err == nil {
+		t.Fatalf("Client.load() error = nil, want error")
+	}
+	if _, err := store.GetBackfill(ctx, dt.ID()); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("Client.load() checkpoint error = %v, want %v", err, state.ErrNotFound)
+	}
+}
+
+func TestClient_loadBackfillRunning(t *testing.T) {
+	storage := &fakeStorage{dirs: map[string][]gcs.Dir{"running": {{Path: "fake-dir-path"}}}}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "running", Experiment: "exp"})
+	fbq := &fakeBQ{}
+	c := NewClient(storage, fbq)
+
+	bf, _, _, err := c.startBackfill(context.Background(), dt, periodOpts(periodEverything))
+	testingx.Must(t, err, "failed to start backfill")
+	if err := c.load(context.Background(), nil, dt, periodOpts(periodEverything)); !errors.Is(err, errBackfillRunning) {
+		t.Errorf("Client.load() error = %v, want %v", err, errBackfillRunning)
+	}
+	if fbq.loadCount != 0 {
+		t.Errorf("Client.load() loaded %d partitions, want 0", fbq.loadCount)
+	}
+	c.finishBackfill(context.Background(), bf, nil)
+	testingx.Must(t, c.load(context.Background(), nil, dt, periodOpts(periodEverything)), "failed to load")
+}
+
+func TestClient_Backfills(t *testing.T) {
+	store := openBackfillStore(t)
+	c := NewClient(&fakeStorage{}, &fakeBQ{})
+	c.State = store
+	ctx := context.Background()
+
+	running := api.NewMlabDatatype(api.DatatypeOpts{Name: "running", Experiment: "exp"})
+	bf, bctx, _, err := c.startBackfill(ctx, running, periodOpts(periodEverything))
+	testingx.Must(t, err, "failed to start backfill")
+	interrupted := &state.Backfill{
+		Datatype:   "mlab/exp/interrupted",
+		Experiment: "exp",
+		Name:       "interrupted",
+		Next:       "2023/06/02",
+		Status:     state.BackfillFailed,
+	}
+	testingx.Must(t, store.PutBackfill(ctx, interrupted), "failed to put backfill")
+
+	rec := httptest.NewRecorder()
+	c.Backfills(rec, httptest.NewRequest(http.MethodGet, "/v2/backfills", nil))
+	var got []state.Backfill
+	testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &got), "failed to decode backfills")
+	var ids []string
+	for _, b := range got {
+		ids = append(ids, b.Datatype+":"+b.Status)
+	}
+	want := []string{running.ID() + ":running", "mlab/exp/interrupted:failed"}
+	if diff := cmp.Diff(ids, want); diff != "" {
+		t.Errorf("Client.Backfills() GET mismatch (-got +want):\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	c.Backfills(rec, httptest.NewRequest(http.MethodDelete, "/v2/backfills?experiment=exp&discard=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Client.Backfills() DELETE status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	got = nil
+	testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &got), "failed to decode backfills")
+	if len(got) != 1 || got[0].Datatype != running.ID() {
+		t.Errorf("Client.Backfills() DELETE = %+v, want %s", got, running.ID())
+	}
+	if bctx.Err() == nil {
+		t.Errorf("Client.Backfills() DELETE did not cancel the backfill")
+	}
+	c.finishBackfill(bctx, bf, bctx.Err())
+
+	// Both the discarded running backfill and the interrupted one are gone.
+	backfills, err := c.listBackfills(ctx, Filter{})
+	testingx.Must(t, err, "failed to list backfills")
+	if len(backfills) != 0 {
+		t.Errorf("Client.listBackfills() = %+v, want none", backfills)
+	}
+
+	rec = httptest.NewRecorder()
+	c.Backfills(rec, httptest.NewRequest(http.MethodPost, "/v2/backfills", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Client.Backfills() POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestClient_cancelBackfillsKeepsCheckpoint(t *testing.T) {
+	store := openBackfillStore(t)
+	c := NewClient(&fakeStorage{}, &fakeBQ{})
+	c.State = store
+	ctx := context.Background()
+
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "cancelled", Experiment: "exp"})
+	bf, bctx, _, err := c.startBackfill(ctx, dt, periodOpts(periodEverything))
+	testingx.Must(t, err, "failed to start backfill")
+	if got := c.cancelBackfills(ctx, Filter{Datatype: "other"}, false); len(got) != 0 {
+		t.Errorf("Client.cancelBackfills() = %+v, want none", got)
+	}
+	if got := c.cancelBackfills(ctx, Filter{Datatype: "cancelled"}, false); len(got) != 1 {
+		t.Errorf("Client.cancelBackfills() = %+v, want 1 backfill", got)
+	}
+	c.finishBackfill(bctx, bf, bctx.Err())
+
+	cp, err := store.GetBackfill(ctx, dt.ID())
+	testingx.Must(t, err, "failed to get checkpoint")
+	if cp.Status != state.BackfillCancelled {
+		t.Errorf("Client.cancelBackfills() checkpoint status = %q, want %q", cp.Status, state.BackfillCancelled)
+	}
+}
+
+func TestClient_processDatatypeResumesBackfill(t *testing.T) {
+	store := openBackfillStore(t)
+	storage := &startStorage{fakeStorage: &fakeStorage{
+		dirs: map[string][]gcs.Dir{"resumed": {{Path: "fake-dir-path"}}},
+	}}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "resumed", Experiment: "exp", BucketName: "bucket"})
+	fbq := &fakeBQ{
+		datasets: map[string]*bqfake.Dataset{dt.Dataset(): {}},
+		tables:   map[string]*bigquery.TableMetadata{dt.Table(): {}},
+	}
+	c := NewClient(storage, fbq)
+	c.State = store
+	ctx := context.Background()
+
+	daily := periodOpts("daily").start
+	tests := []struct {
+		name       string
+		status     string
+		attempts   int
+		want       []string
+		wantStatus string // Of the checkpoint, if kept.
+	}{
+		{name: "running", status: state.BackfillRunning, attempts: 1, want: []string{daily, "2023/06/02"}},
+		{name: "failed", status: state.BackfillFailed, attempts: 1, want: []string{daily}, wantStatus: state.BackfillFailed},
+		{name: "cancelled", status: state.BackfillCancelled, attempts: 1, want: []string{daily}, wantStatus: state.BackfillCancelled},
+		{name: "exhausted", status: state.BackfillRunning, attempts: maxBackfillAttempts, want: []string{daily},
+			wantStatus: state.BackfillFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage.starts = nil
+			cp := &state.Backfill{Datatype: dt.ID(), Start: start, Next: "2023/06/02", Status: tt.status, Attempts: tt.attempts}
+			testingx.Must(t, store.PutBackfill(ctx, cp), "failed to put backfill")
+			testingx.Must(t, c.processDatatype(ctx, dt, periodOpts("daily")), "failed to process datatype")
+			if diff := cmp.Diff(storage.starts, tt.want); diff != "" {
+				t.Errorf("Client.processDatatype() loaded from (-got +want):\n%s", diff)
+			}
+			got, err := store.GetBackfill(ctx, dt.ID())
+			if tt.wantStatus == "" {
+				if !errors.Is(err, state.ErrNotFound) {
+					t.Errorf("Client.processDatatype() checkpoint error = %v, want %v", err, state.ErrNotFound)
+				}
+				return
+			}
+			testingx.Must(t, err, "failed to get checkpoint")
+			if got.Status != tt.wantStatus {
+				t.Errorf("Client.processDatatype() checkpoint status = %q, want %q", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/m-lab/autoloader/api"
+)
+
+// DatatypeInfo describes a discovered datatype and the BigQuery names derived
+// from its naming conventions.
+type DatatypeInfo struct {
+	Name          string    `json:"name"`
+	Experiment    string    `json:"experiment"`
+	Organization  string    `json:"organization,omitempty"`
+	Version       string    `json:"version"`
+	Bucket        string    `json:"bucket"`
+	Location      string    `json:"location"`
+	SchemaUpdated time.Time `json:"schema_updated"`
+	Dataset       string    `json:"dataset"`
+	Table         string    `json:"table"`
+	ViewDataset   string    `json:"view_dataset"`
+	ViewTable     string    `json:"view_table"`
+}
+
+// DatatypesResponse is the response of the Datatypes handler.
+type DatatypesResponse struct {
+	Datatypes []DatatypeInfo `json:"datatypes"`
+	Errors    []string       `json:"errors,omitempty"`
+}
+
+// NewDatatypeInfo returns the description of a datatype.
+func NewDatatypeInfo(dt *api.Datatype) DatatypeInfo {
+	return DatatypeInfo{
+		Name:          dt.Name,
+		Experiment:    dt.Experiment,
+		Organization:  dt.Organization,
+		Version:       dt.Version,
+		Bucket:        dt.BucketName,
+		Location:      dt.Location,
+		SchemaUpdated: dt.UpdatedTime,
+		Dataset:       dt.Dataset(),
+		Table:         dt.Table(),
+		ViewDataset:   dt.ViewDataset(),
+		ViewTable:     dt.ViewTable(),
+	}
+}
+
+// Datatypes writes the datatypes discovered in storage as JSON, along with
+// any discovery errors. Datatypes with colliding BigQuery names are reported
+// as errors instead. The `experiment`, `datatype` and `organization`
+// query parameters filter the datatypes.
+func (c *Client) Datatypes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	datatypes, err := c.GetDatatypes(ctx)
+
+	resp := DatatypesResponse{
+		Datatypes: make([]DatatypeInfo, 0),
+		Errors:    discoveryErrors(ctx, err),
+	}
+	datatypes, err = api.CheckCollisions(datatypes, c.Projects)
+	resp.Errors = append(resp.Errors, collisionErrors(ctx, err)...)
+	for _, dt := range filterDatatypes(datatypes, getFilter(r.URL.Query())) {
+		resp.Datatypes = append(resp.Datatypes, NewDatatypeInfo(dt))
+	}
+	writeJSON(w, resp)
+}
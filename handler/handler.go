@@ -2,8 +2,8 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -11,20 +11,63 @@ import (
 	"cloud.google.com/go/bigquery"
 	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
 	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/auth"
+	"github.com/m-lab/autoloader/bq"
 	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/logging"
 	"github.com/m-lab/autoloader/metrics"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/autoloader/tracing"
 	"github.com/m-lab/go/timex"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RunIDHeader is the HTTP header carrying the identifier of a load run. If
+	// the request does not set it, a new identifier is generated.
+	RunIDHeader = "X-Run-Id"
 )
 
 // Client contains the state needed to handle  load requests.
 type Client struct {
 	StorageClient
 	BQClient
+	// Router returns the BigQuery client for a datatype (e.g., depending on
+	// the destination projects of its bucket or organization). If nil,
+	// BQClient is used for all datatypes.
+	Router func(*api.Datatype) (BQClient, error)
+	// Projects returns the BigQuery projects the Router sends a datatype to,
+	// so that datatypes only collide within a project (see
+	// api.CheckCollisions). If nil, all datatypes share the same projects.
+	Projects api.Projects
+	// Periods maps bucket names to the period loaded when a request specifies
+	// neither a period nor a date range.
+	Periods map[string]string
+	// Audit records the mutations made to BigQuery. If nil, they are only
+	// logged.
+	Audit audit.Sink
+	// State records the load history of each partition. If nil, the history
+	// is not kept.
+	State state.Store
+	// Checks returns the row checks of a datatype's partition loads. If nil,
+	// loads are not verified.
+	Checks func(*api.Datatype) RowChecks
+	// Staging returns the staging options of a datatype. If nil, or if it
+	// returns nil, partitions are loaded directly to the destination table;
+	// otherwise, they are loaded to a staging table, checked and copied.
+	Staging func(*api.Datatype) *Staging
+	// Modes returns the load mode of a datatype. If nil, every datatype is
+	// loaded in ModeTruncate.
+	Modes     func(*api.Datatype) LoadMode
+	runs      *runLog
+	backfills *backfillLog
 }
 
 // StorageClient is an interface for types that support storage operations.
 type StorageClient interface {
-	GetDatatypes(context.Context) []*api.Datatype
+	GetDatatypes(context.Context) ([]*api.Datatype, error)
 	GetDirs(context.Context, *api.Datatype, string, string) ([]gcs.Dir, error)
 }
 
@@ -35,7 +78,7 @@ type BQClient interface {
 	GetTableMetadata(context.Context, bqiface.Dataset, string) (*bigquery.TableMetadata, error)
 	CreateTable(context.Context, bqiface.Dataset, *api.Datatype) (*bigquery.TableMetadata, error)
 	UpdateSchema(context.Context, bqiface.Dataset, *api.Datatype) error
-	Load(context.Context, bqiface.Dataset, string, ...string) error
+	Load(context.Context, bqiface.Dataset, string, ...string) (*bq.LoadStatistics, error)
 }
 
 // NewClient creates a new instance of Client.
@@ -43,118 +86,527 @@ func NewClient(storage StorageClient, bq BQClient) *Client {
 	return &Client{
 		StorageClient: storage,
 		BQClient:      bq,
+		runs:          newRunLog(),
+		backfills:     newBackfillLog(),
 	}
 }
 
 // Load fetches the datatype information from storage and loads the archived
-// data to BigQuery.
+// data to BigQuery. The `experiment`, `datatype` and `organization` query
+// parameters restrict the load to a subset of the datatypes. If the request
+// has no period or date range, each datatype is loaded with the default
+// period of its bucket (see Client.Periods).
 func (c *Client) Load(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Tracer().Start(r.Context(), "handler.Load")
+	defer span.End()
+
 	opts, err := getOpts(r.URL.Query())
+	if err == errPeriod && r.URL.Query().Get("period") == "" && len(c.Periods) != 0 {
+		opts, err = &LoadOptions{period: periodDefault}, nil
+	}
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
+	span.SetAttributes(tracing.Period.String(opts.period))
+	filter := getFilter(r.URL.Query())
 
-	ctx := r.Context()
-	datatypes := c.GetDatatypes(ctx)
-	errs := []string{}
+	ctx, runID := withRun(ctx, r)
+	w.Header().Set(RunIDHeader, runID)
+	span.SetAttributes(tracing.RunID.String(runID))
+	ctx = logging.With(ctx, "period", opts.period)
+	ctx, violations := withViolations(ctx)
+	logger := logging.FromContext(ctx)
+	logger.Info("started autoload", "start", opts.start, "end", opts.end)
+	run := &Run{
+		ID:      runID,
+		Period:  opts.period,
+		Start:   opts.start,
+		End:     opts.end,
+		Filter:  filter,
+		Started: time.Now().UTC(),
+	}
+	c.runs.start(run)
+
+	datatypes, err := c.GetDatatypes(ctx)
+	errs := discoveryErrors(ctx, err)
+	// Collisions are checked before filtering, since loading any of the
+	// colliding datatypes would overwrite the others.
+	datatypes, err = api.CheckCollisions(datatypes, c.Projects)
+	errs = append(errs, collisionErrors(ctx, err)...)
+	datatypes = filterDatatypes(datatypes, filter)
 	for _, dt := range datatypes {
+		opts := opts
+		if opts.period == periodDefault {
+			if opts = periodOpts(c.Periods[dt.BucketName]); opts == nil {
+				errs = append(errs, fmt.Sprintf("failed to autoload %s.%s: no default period for bucket %s", dt.Experiment, dt.Name, dt.BucketName))
+				continue
+			}
+		}
 		t := time.Now()
 		err := c.processDatatype(ctx, dt, opts)
 		if err != nil {
-			metrics.AutoloadDuration.WithLabelValues(dt.Experiment, dt.Name, opts.period, "error").Observe(time.Since(t).Seconds())
+			metrics.AutoloadDuration.WithLabelValues(labels(dt, opts.period, "error")...).Observe(time.Since(t).Seconds())
 			errs = append(errs, fmt.Sprintf("failed to autoload %s.%s: %s", dt.Experiment, dt.Name, err.Error()))
 			continue
 		}
-		metrics.AutoloadDuration.WithLabelValues(dt.Experiment, dt.Name, opts.period, "OK").Observe(time.Since(t).Seconds())
+		metrics.AutoloadDuration.WithLabelValues(labels(dt, opts.period, "OK")...).Observe(time.Since(t).Seconds())
 	}
 
+	flagged := violations.strings()
+	logger.Info("finished autoload", "datatypes", len(datatypes), "errors", len(errs), "violations", len(flagged))
+	c.runs.finish(run, len(datatypes), errs, flagged)
+	// Row check violations do not fail the load, but are reported after the
+	// errors, if any.
+	body := strings.Join(append(errs, flagged...), "\n")
 	if len(errs) != 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("failed to autoload %d datatypes", len(errs)))
 		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(strings.Join(errs, "\n")))
+		w.Write([]byte(body))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
+}
+
+// withRun returns the run ID of the request, generated if the request has
+// none, and a context carrying it in its logger and audit trigger.
+func withRun(ctx context.Context, r *http.Request) (context.Context, string) {
+	runID := r.Header.Get(RunIDHeader)
+	if runID == "" {
+		runID = logging.NewRunID()
+	}
+	ctx = logging.WithRunID(ctx, runID)
+	trigger := audit.Trigger{RunID: runID, Request: r.Method + " " + r.URL.RequestURI()}
+	if caller := auth.FromContext(ctx); caller != nil {
+		trigger.Caller = caller.ID
+	}
+	return audit.WithTrigger(ctx, trigger), runID
+}
+
+// discoveryErrors logs and counts the errors found while discovering the
+// datatypes, and returns their messages.
+func discoveryErrors(ctx context.Context, err error) []string {
+	msgs := []string{}
+	if err == nil {
+		return msgs
+	}
+
+	// GetDatatypes joins the errors found for each object.
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	for _, err := range errs {
+		objErr := &gcs.ObjectError{}
+		errors.As(err, &objErr)
+		logging.FromContext(ctx).Error("failed to discover datatype", logging.BucketKey, objErr.Bucket,
+			logging.OrganizationKey, objErr.Organization, logging.ErrorKey, err)
+		metrics.DiscoveryErrorsTotal.WithLabelValues(objErr.Organization, objErr.Version, objErr.Bucket).Inc()
+		msgs = append(msgs, fmt.Sprintf("failed to discover datatype: %s", err.Error()))
+	}
+	return msgs
+}
+
+// collisionErrors logs and counts the datatypes refused because of colliding
+// BigQuery names, and returns the collision messages.
+func collisionErrors(ctx context.Context, err error) []string {
+	msgs := []string{}
+	if err == nil {
+		return msgs
+	}
+
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var collision *api.CollisionError
+		if !errors.As(err, &collision) {
+			continue
+		}
+		for _, dt := range collision.Datatypes {
+			logging.FromContext(ctx).Error("refused datatype with colliding BigQuery names",
+				append(logging.Datatype(dt), logging.ErrorKey, err)...)
+			metrics.NamingCollisionsTotal.WithLabelValues(labels(dt, collision.Kind)...).Inc()
+		}
+		msgs = append(msgs, fmt.Sprintf("refused colliding datatypes: %s", err.Error()))
+	}
+	return msgs
 }
 
-func (c *Client) processDatatype(ctx context.Context, dt *api.Datatype, opts *LoadOptions) error {
+func (c *Client) processDatatype(ctx context.Context, dt *api.Datatype, opts *LoadOptions) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "handler.processDatatype",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...),
+		trace.WithAttributes(tracing.Period.String(opts.period)))
+	defer func() { tracing.End(span, err) }()
+	ctx = logging.With(ctx, logging.Datatype(dt)...)
+	logger := logging.FromContext(ctx)
+
+	if c.Router != nil {
+		routed := *c
+		routed.BQClient, err = c.Router(dt)
+		if err != nil {
+			logger.Error("failed to get BigQuery client", logging.ErrorKey, err)
+			return err
+		}
+		c = &routed
+	}
+
 	// Get or create dataset.
 	ds, err := c.BQClient.GetDataset(ctx, dt.Dataset())
 	if err != nil {
 		ds, err = c.BQClient.CreateDataset(ctx, dt)
+		c.audit(ctx, dt, &audit.Record{Action: audit.ActionCreateDataset}, err)
 		if err != nil {
-			log.Printf("failed to create BigQuery dataset %s: %v", dt.Dataset(), err)
-			metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "create-dataset", "error").Inc()
+			logger.Error("failed to create BigQuery dataset", logging.ErrorKey, err)
+			metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "create-dataset", "error")...).Inc()
 			return err
 		}
-		metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "create-dataset", "OK").Inc()
+		metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "create-dataset", "OK")...).Inc()
 	}
 
 	// Get or create table.
+	resume := false
 	md, err := c.BQClient.GetTableMetadata(ctx, ds, dt.Table())
 	if err != nil {
 		md, err = c.BQClient.CreateTable(ctx, ds, dt)
+		c.audit(ctx, dt, &audit.Record{
+			Action:    audit.ActionCreateTable,
+			Table:     dt.Table(),
+			NewSchema: string(dt.Schema),
+		}, err)
 		if err != nil {
-			log.Printf("failed to create BigQuery table %s.%s: %v", dt.Dataset(), dt.Table(), err)
-			metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "create-table", "error").Inc()
+			logger.Error("failed to create BigQuery table", logging.ErrorKey, err)
+			metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "create-table", "error")...).Inc()
 			return err
 		}
-		metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "create-table", "OK").Inc()
+		metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "create-table", "OK")...).Inc()
 		// Since a new table was created, override the given optionss and default to options
-		// of complete history.
-		opts = periodOpts("everything")
+		// of complete history. Checkpoints of backfills to a previous table
+		// no longer apply.
+		opts = periodOpts(periodEverything)
+		c.discardBackfill(ctx, dt.ID())
+	} else if periodic(opts.period) {
+		// Once the period is loaded, resume the backfill interrupted by a
+		// restart, e.g. the full load of a new table, rather than leaving
+		// earlier partitions unloaded. Loads of specific dates are left as
+		// requested.
+		resume = c.pendingBackfill(ctx, dt)
 	}
 
 	// Update table (if necessary).
 	if dt.UpdatedTime.After(md.LastModifiedTime) {
 		err = c.BQClient.UpdateSchema(ctx, ds, dt)
+		rec := &audit.Record{
+			Action:    audit.ActionUpdateSchema,
+			Table:     dt.Table(),
+			OldSchema: schemaJSON(md.Schema),
+			NewSchema: string(dt.Schema),
+		}
+		if dt.UpdateView {
+			rec.View = dt.ViewDataset() + "." + dt.ViewTable()
+		}
+		c.audit(ctx, dt, rec, err)
 		if err != nil {
-			log.Printf("failed to update BigQuery table %s.%s: %v", dt.Dataset(), dt.Table(), err)
-			metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "update-schema", "error").Inc()
+			logger.Error("failed to update BigQuery table schema", logging.ErrorKey, err)
+			metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "update-schema", "error")...).Inc()
 			return err
 		}
-		metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "update-schema", "OK").Inc()
+		metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "update-schema", "OK")...).Inc()
 	}
 
 	// Load data.
 	err = c.load(ctx, ds, dt, opts)
 	if err != nil {
-		metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "load", "error").Inc()
+		metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "load", "error")...).Inc()
 		return err
 	}
 
-	metrics.BigQueryOperationsTotal.WithLabelValues(dt.Experiment, dt.Name, "load", "OK").Inc()
+	metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "load", "OK")...).Inc()
+
+	// A failed resumption is kept in the backfill's checkpoint, and does not
+	// fail the load of the period.
+	if resume {
+		logger.Info("resuming interrupted backfill", "period", opts.period)
+		if err := c.load(ctx, ds, dt, periodOpts(periodEverything)); err != nil {
+			logger.Warn("failed to resume interrupted backfill", logging.ErrorKey, err)
+			metrics.BigQueryOperationsTotal.WithLabelValues(labels(dt, "load", "error")...).Inc()
+		}
+	}
 	return nil
 }
 
 // load loads the contents of a set of storage directories to a date-partitioned table.
-func (c *Client) load(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype, opts *LoadOptions) error {
+// Loads of the complete history are backfills, which resume from the first
+// partition that was not loaded by a previous, interrupted backfill.
+func (c *Client) load(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype, opts *LoadOptions) (err error) {
+	var bf *backfill
+	if opts.period == periodEverything {
+		var (
+			bctx  context.Context
+			bopts *LoadOptions
+		)
+		if bf, bctx, bopts, err = c.startBackfill(ctx, dt, opts); err != nil {
+			logging.FromContext(ctx).Error("failed to start backfill", logging.ErrorKey, err)
+			return err
+		}
+		ctx, opts = bctx, bopts
+		defer func() { c.finishBackfill(ctx, bf, err) }()
+	}
+
+	logger := logging.FromContext(ctx)
+	mode, staging := c.mode(dt), c.staging(dt)
+	if err = c.checkMode(mode, staging); err != nil {
+		logger.Error("failed to load in mode", "mode", mode.Mode, logging.ErrorKey, err)
+		return err
+	}
 	dirs, err := c.StorageClient.GetDirs(ctx, dt, opts.start, opts.end)
 	if err != nil {
-		log.Printf("failed to get directories for %s.%s: %v: ", dt.Experiment, dt.Name, err)
+		logger.Error("failed to get directories", logging.ErrorKey, err)
 		return err
 	}
+	if mode.Mode == ModeReplace && len(dirs) > 1 {
+		// Each directory is a complete snapshot of the table.
+		dirs = dirs[len(dirs)-1:]
+	}
+
+	recordSourceUpdated(dt, opts, dirs)
+	newest := newestDate(dirs)
 
 	t := time.Now()
-	log.Printf("started loading data to BigQuery table %s.%s for dates %s to %s",
-		dt.Dataset(), dt.Table(), opts.start, opts.end)
+	logger.Info("started loading data to BigQuery table",
+		"start", opts.start, "end", opts.end, "dirs", len(dirs))
 
+	var prev *dayRows
 	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			logger.Warn("stopped loading data to BigQuery table", logging.ErrorKey, err)
+			break
+		}
 		table := dt.Table() + "$" + dir.Date.Format(timex.YYYYMMDD)
-		e := c.BQClient.Load(ctx, ds, table, dir.Path)
+		if mode.Mode == ModeReplace {
+			table = dt.Table()
+		}
+		pt := time.Now()
+		var checks []bq.StagingCheck
+		if staging != nil || mode.Mode == ModeMerge {
+			checks = c.stagingChecks(dt, staging, dir, prev)
+		}
+		stats, e := c.loadPartition(ctx, ds, dt, table, dir, mode, checks)
+		if bf != nil {
+			c.progressBackfill(ctx, bf, dir, e)
+		}
 		if e != nil {
 			err = e
-			log.Printf("failed to load %s to BigQuery table %s: %v", dir.Path, table, e)
-			metrics.LoadedDates.WithLabelValues(dt.Experiment, dt.Name, opts.period, "error").Set(float64(dir.Date.Unix()))
+			logger.Error("failed to load partition", logging.PathKey, dir.Path,
+				logging.PartitionKey, dir.Date.Format(timex.YYYYMMDD), logging.ErrorKey, e)
+			metrics.PartitionLoadDuration.WithLabelValues(labels(dt, opts.period, "error")...).Observe(time.Since(pt).Seconds())
+			metrics.LoadedDates.WithLabelValues(labels(dt, opts.period, "error")...).Set(float64(dir.Date.Unix()))
 			continue
 		}
-		metrics.LoadedDates.WithLabelValues(dt.Experiment, dt.Name, opts.period, "OK").Set(float64(dir.Date.Unix()))
+		metrics.PartitionLoadDuration.WithLabelValues(labels(dt, opts.period, "OK")...).Observe(time.Since(pt).Seconds())
+		metrics.LoadedDates.WithLabelValues(labels(dt, opts.period, "OK")...).Set(float64(dir.Date.Unix()))
+		recordLoadStats(dt, opts, stats)
+		if dir.Date.Equal(newest) {
+			recordFreshness(dt, opts, dir, time.Now())
+		}
+		// Staged data are verified before they are written, and appended
+		// rows are not those of the whole partition.
+		if checks == nil && mode.Mode != ModeAppend {
+			c.verifyRows(ctx, dt, dir, stats, prev)
+		}
+		if stats != nil {
+			prev = &dayRows{date: dir.Date, rows: stats.OutputRows}
+		}
 	}
 
-	log.Printf("finished loading data to BigQuery table %s.%s for dates %s to %s, duration: %s",
-		dt.Dataset(), dt.Table(), opts.start, opts.end, time.Since(t))
+	logger.Info("finished loading data to BigQuery table",
+		"start", opts.start, "end", opts.end, "duration", time.Since(t).String())
 
 	return err
 }
+
+// loadPartition loads the contents of a single storage directory to a table
+// partition (or, in ModeReplace, to the whole table) in the load mode. If
+// checks is not nil, the data are written through a staging table once they
+// pass them (see StagedLoader and Merger). In ModeAppend, it returns no
+// statistics if the directory has no new files.
+func (c *Client) loadPartition(ctx context.Context, ds bqiface.Dataset, dt *api.Datatype, table string, dir gcs.Dir,
+	mode LoadMode, checks []bq.StagingCheck) (*bq.LoadStatistics, error) {
+	partition := dir.Date.Format(timex.YYYYMMDD)
+	ctx, span := tracing.Tracer().Start(ctx, "handler.loadPartition",
+		trace.WithAttributes(tracing.DatatypeAttributes(dt)...),
+		trace.WithAttributes(tracing.Partition.String(partition)))
+	ctx = logging.With(ctx, logging.PartitionKey, partition)
+	started := time.Now().UTC()
+	rec := &audit.Record{
+		Action:     audit.ActionLoad,
+		Table:      dt.Table(),
+		Partition:  partition,
+		SourceURIs: []string{dir.Path},
+	}
+	files := dir.Files
+	var (
+		stats *bq.LoadStatistics
+		err   error
+	)
+	switch {
+	case mode.Mode == ModeAppend:
+		rec.Action = audit.ActionAppend
+		if files, err = c.newFiles(ctx, dt, partition, dir); err != nil {
+			break
+		}
+		if len(files) == 0 {
+			logging.FromContext(ctx).Info("no new files to append", logging.PathKey, dir.Path)
+			tracing.End(span, nil)
+			return nil, nil
+		}
+		rec.SourceURIs = files
+		stats, err = c.BQClient.(Appender).Append(ctx, ds, table, files...)
+	case mode.Mode == ModeMerge:
+		rec.Action = audit.ActionMerge
+		stats, err = c.BQClient.(Merger).Merge(ctx, ds, table, mode.Key, checks, dir.Path)
+	case checks != nil:
+		stats, err = c.BQClient.(StagedLoader).LoadStaged(ctx, ds, table, checks, dir.Path)
+	default:
+		stats, err = c.BQClient.Load(ctx, ds, table, dir.Path)
+	}
+	tracing.End(span, err)
+	if mode.Mode == ModeReplace {
+		rec.Action, rec.Partition = audit.ActionReplace, ""
+	}
+
+	var jobErr *bq.JobError
+	switch {
+	case stats != nil && stats.StagedJobID != "":
+		// The copy or merge job wrote the staged data.
+		rec.JobID = stats.StagedJobID
+	case stats != nil:
+		rec.JobID = stats.JobID
+	case errors.As(err, &jobErr):
+		rec.JobID = jobErr.JobID
+	}
+	c.audit(ctx, dt, rec, err)
+	c.recordState(ctx, dt, partition, dir, files, started, rec.JobID, stats, err)
+	return stats, err
+}
+
+// recordState records a partition load attempt of the files in the directory
+// in the state store. Failures to record it are logged, but do not fail the
+// load.
+func (c *Client) recordState(ctx context.Context, dt *api.Datatype, partition string, dir gcs.Dir, files []string,
+	started time.Time, jobID string, stats *bq.LoadStatistics, err error) {
+	if c.State == nil {
+		return
+	}
+	l := &state.Load{
+		Datatype:    dt.ID(),
+		Dataset:     dt.Dataset(),
+		Table:       dt.Table(),
+		Partition:   partition,
+		Source:      dir.Path,
+		Fingerprint: dir.Fingerprint,
+		Files:       files,
+		RunID:       audit.TriggerFromContext(ctx).RunID,
+		JobID:       jobID,
+		Status:      state.StatusOK,
+		Started:     started,
+		Finished:    time.Now().UTC(),
+	}
+	if err != nil {
+		l.Status, l.Error = state.StatusError, err.Error()
+	}
+	if stats != nil {
+		l.Rows = stats.OutputRows
+		l.BadRecords = stats.BadRecords
+		l.InputFiles = stats.InputFiles
+		l.InputBytes = stats.InputFileBytes
+	}
+	if err := c.State.Put(ctx, l); err != nil {
+		logging.FromContext(ctx).Error("failed to record load state", logging.ErrorKey, err)
+	}
+}
+
+// audit records a mutation made to the BigQuery dataset of a datatype.
+func (c *Client) audit(ctx context.Context, dt *api.Datatype, rec *audit.Record, err error) {
+	rec.Experiment = dt.Experiment
+	rec.Datatype = dt.Name
+	rec.Organization = dt.Organization
+	rec.Bucket = dt.BucketName
+	rec.Dataset = dt.Dataset()
+	logging.FromContext(ctx).Info("mutated BigQuery resource", "audit", true, "action", rec.Action,
+		logging.JobIDKey, rec.JobID, "ok", err == nil)
+	audit.Write(ctx, c.Audit, rec, err)
+}
+
+// schemaJSON returns the JSON representation of a table schema.
+func schemaJSON(s bigquery.Schema) string {
+	if s == nil {
+		return ""
+	}
+	b, err := s.ToJSONFields()
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// recordLoadStats exports the statistics of a completed load job as metrics.
+func recordLoadStats(dt *api.Datatype, opts *LoadOptions, stats *bq.LoadStatistics) {
+	if stats == nil {
+		return
+	}
+	l := labels(dt, opts.period)
+	metrics.LoadInputFilesTotal.WithLabelValues(l...).Add(float64(stats.InputFiles))
+	metrics.LoadInputBytesTotal.WithLabelValues(l...).Add(float64(stats.InputFileBytes))
+	metrics.LoadOutputRowsTotal.WithLabelValues(l...).Add(float64(stats.OutputRows))
+	metrics.LoadBadRecordsTotal.WithLabelValues(l...).Add(float64(stats.BadRecords))
+	metrics.LoadOutputRows.WithLabelValues(l...).Set(float64(stats.OutputRows))
+}
+
+// recordSourceUpdated exports the update time of the newest source object
+// across all directories.
+func recordSourceUpdated(dt *api.Datatype, opts *LoadOptions, dirs []gcs.Dir) {
+	var newest time.Time
+	for _, dir := range dirs {
+		if dir.Updated.After(newest) {
+			newest = dir.Updated
+		}
+	}
+	if newest.IsZero() {
+		return
+	}
+	metrics.SourceUpdatedTime.WithLabelValues(labels(dt, opts.period)...).Set(float64(newest.Unix()))
+}
+
+// newestDate returns the date of the newest directory.
+func newestDate(dirs []gcs.Dir) time.Time {
+	var newest time.Time
+	for _, dir := range dirs {
+		if dir.Date.After(newest) {
+			newest = dir.Date
+		}
+	}
+	return newest
+}
+
+// recordFreshness exports the time of a successful partition load and its
+// lag with respect to the partition's newest source object. It is only called
+// for the newest partition of a run, so loads of older partitions (e.g., by
+// backfills) do not make a datatype look fresher or staler than it is.
+func recordFreshness(dt *api.Datatype, opts *LoadOptions, dir gcs.Dir, loaded time.Time) {
+	l := labels(dt, opts.period)
+	metrics.LastLoadTime.WithLabelValues(l...).Set(float64(loaded.Unix()))
+	if dir.Updated.IsZero() {
+		return
+	}
+	metrics.LoadLag.WithLabelValues(l...).Set(loaded.Sub(dir.Updated).Seconds())
+}
+
+// labels returns the metric labels identifying a datatype, followed by the
+// given values.
+func labels(dt *api.Datatype, values ...string) []string {
+	return append([]string{dt.Experiment, dt.Name, dt.Organization, dt.Version, dt.BucketName}, values...)
+}
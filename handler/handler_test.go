@@ -1,28 +1,46 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
 	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/auth"
+	"github.com/m-lab/autoloader/bq"
 	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/metrics"
+	"github.com/m-lab/autoloader/state"
 	"github.com/m-lab/go/cloudtest/bqfake"
 	"github.com/m-lab/go/testingx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type fakeStorage struct {
-	datatypes []*api.Datatype
-	dirs      map[string][]gcs.Dir
+	datatypes    []*api.Datatype
+	discoveryErr error
+	dirs         map[string][]gcs.Dir
 }
 
-func (s *fakeStorage) GetDatatypes(ctx context.Context) []*api.Datatype {
-	return s.datatypes
+func (s *fakeStorage) GetDatatypes(ctx context.Context) ([]*api.Datatype, error) {
+	return s.datatypes, s.discoveryErr
 }
 
 func (s *fakeStorage) GetDirs(ctx context.Context, dt *api.Datatype, start, end string) ([]gcs.Dir, error) {
@@ -40,6 +58,7 @@ type fakeBQ struct {
 	createTblErr error
 	updateErr    error
 	loadErr      error
+	loadStats    *bq.LoadStatistics
 	createCount  int
 	updateCount  int
 	loadCount    int
@@ -85,12 +104,12 @@ func (bq *fakeBQ) UpdateSchema(ctx context.Context, ds bqiface.Dataset, dt *api.
 	return nil
 }
 
-func (bq *fakeBQ) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) error {
+func (bq *fakeBQ) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (*bq.LoadStatistics, error) {
 	if bq.loadErr != nil {
-		return bq.loadErr
+		return nil, bq.loadErr
 	}
 	bq.loadCount++
-	return nil
+	return bq.loadStats, nil
 }
 
 func TestClient_Load(t *testing.T) {
@@ -148,6 +167,15 @@ func TestClient_Load(t *testing.T) {
 			opts: "period=daily",
 			want: http.StatusInternalServerError,
 		},
+		{
+			name: "discovery-error",
+			storage: &fakeStorage{
+				discoveryErr: &gcs.ObjectError{Bucket: "bucket", Path: "path", Err: gcs.ErrInvalidSchema},
+			},
+			bq:   &fakeBQ{},
+			opts: "period=daily",
+			want: http.StatusInternalServerError,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -400,3 +428,534 @@ func TestClient_load(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_loadStats(t *testing.T) {
+	storage := &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"stats-datatype": {
+				{Path: "fake-dir-path1"},
+				{Path: "fake-dir-path2"},
+			},
+		},
+	}
+	fake := &fakeBQ{
+		loadStats: &bq.LoadStatistics{
+			LoadStatistics: bigquery.LoadStatistics{
+				InputFiles:     2,
+				InputFileBytes: 1024,
+				OutputRows:     100,
+			},
+			BadRecords: 1,
+		},
+	}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{
+		Name:         "stats-datatype",
+		Experiment:   "stats-experiment",
+		Organization: "stats-org",
+	})
+	opts := periodOpts("annually")
+
+	c := NewClient(storage, fake)
+	err := c.load(context.Background(), nil, dt, opts)
+	testingx.Must(t, err, "failed to load")
+
+	l := labels(dt, opts.period)
+	tests := []struct {
+		name string
+		c    prometheus.Collector
+		want float64
+	}{
+		{name: "input-files", c: metrics.LoadInputFilesTotal.WithLabelValues(l...), want: 4},
+		{name: "input-bytes", c: metrics.LoadInputBytesTotal.WithLabelValues(l...), want: 2048},
+		{name: "output-rows-total", c: metrics.LoadOutputRowsTotal.WithLabelValues(l...), want: 200},
+		{name: "bad-records", c: metrics.LoadBadRecordsTotal.WithLabelValues(l...), want: 2},
+		{name: "output-rows", c: metrics.LoadOutputRows.WithLabelValues(l...), want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.c); got != tt.want {
+				t.Errorf("Client.load() %s = %v, want = %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_LoadDiscoveryErrors(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewThirdPartyDatatype(
+				api.DatatypeOpts{
+					Name: "datatype",
+				}, "",
+			),
+		},
+		discoveryErr: errors.Join(
+			&gcs.ObjectError{Bucket: "discovery-bucket", Path: "path1", Version: "v2", Organization: "org", Err: gcs.ErrInvalidSchema},
+			&gcs.ObjectError{Bucket: "discovery-bucket", Path: "path2", Version: "v2", Organization: "org", Err: gcs.ErrInvalidSchema},
+		),
+		dirs: map[string][]gcs.Dir{
+			"datatype": {{
+				Path: "fake-dir-path",
+			}},
+		},
+	}
+	fake := &fakeBQ{}
+	c := NewClient(storage, fake)
+
+	rec := httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Handler.Load() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "gs://discovery-bucket/path2") {
+		t.Errorf("Handler.Load() body = %q, want discovery errors", rec.Body.String())
+	}
+	if fake.loadCount != 1 {
+		t.Errorf("Handler.Load() loadCount = %d, want 1", fake.loadCount)
+	}
+	got := testutil.ToFloat64(metrics.DiscoveryErrorsTotal.WithLabelValues("org", "v2", "discovery-bucket"))
+	if got != 2 {
+		t.Errorf("Handler.Load() discovery errors = %v, want 2", got)
+	}
+}
+
+func TestClient_LoadCollisions(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "collision", Experiment: "my-exp", BucketName: "collision-bucket"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "collision", Experiment: "my_exp", BucketName: "collision-bucket"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "datatype", Experiment: "my-exp", BucketName: "collision-bucket"}),
+		},
+		dirs: map[string][]gcs.Dir{
+			"collision": {{Path: "fake-dir-path"}},
+			"datatype":  {{Path: "fake-dir-path"}},
+		},
+	}
+	fake := &fakeBQ{}
+	c := NewClient(storage, fake)
+
+	rec := httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily&datatype=collision", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Handler.Load() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "table raw_my_exp.collision") {
+		t.Errorf("Handler.Load() body = %q, want collision error", rec.Body.String())
+	}
+	if fake.loadCount != 0 {
+		t.Errorf("Handler.Load() loadCount = %d, want 0", fake.loadCount)
+	}
+	got := testutil.ToFloat64(metrics.NamingCollisionsTotal.WithLabelValues("my-exp", "collision", "", "", "collision-bucket", "table"))
+	if got != 1 {
+		t.Errorf("Handler.Load() collisions = %v, want 1", got)
+	}
+
+	rec = httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily&datatype=datatype", nil))
+	if fake.loadCount != 1 {
+		t.Errorf("Handler.Load() loadCount = %d, want 1", fake.loadCount)
+	}
+}
+
+func TestClient_LoadRouting(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "routed-a", Experiment: "exp", BucketName: "bucket-a"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "routed-b", Experiment: "exp", BucketName: "bucket-b"}),
+		},
+		dirs: map[string][]gcs.Dir{
+			"routed-a": {{Path: "fake-dir-path"}},
+			"routed-b": {{Path: "fake-dir-path"}},
+		},
+	}
+	fakes := map[string]*fakeBQ{"bucket-a": {}, "bucket-b": {}}
+	c := NewClient(storage, nil)
+	c.Router = func(dt *api.Datatype) (BQClient, error) {
+		if dt.Name == "unroutable" {
+			return nil, errors.New("no destination")
+		}
+		return fakes[dt.BucketName], nil
+	}
+	c.Periods = map[string]string{"bucket-a": "daily"}
+
+	// Without a period, only the bucket with a default period is loaded.
+	rec := httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Handler.Load() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "no default period for bucket bucket-b") {
+		t.Errorf("Handler.Load() body = %q, want missing default period", rec.Body.String())
+	}
+	if fakes["bucket-a"].loadCount != 1 || fakes["bucket-b"].loadCount != 0 {
+		t.Errorf("Handler.Load() loadCount = %d, %d, want 1, 0", fakes["bucket-a"].loadCount, fakes["bucket-b"].loadCount)
+	}
+
+	// An explicit period applies to all buckets.
+	rec = httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Handler.Load() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if fakes["bucket-a"].loadCount != 2 || fakes["bucket-b"].loadCount != 1 {
+		t.Errorf("Handler.Load() loadCount = %d, %d, want 2, 1", fakes["bucket-a"].loadCount, fakes["bucket-b"].loadCount)
+	}
+
+	// Routing errors only fail the affected datatype.
+	storage.datatypes = append(storage.datatypes,
+		api.NewMlabDatatype(api.DatatypeOpts{Name: "unroutable", Experiment: "exp", BucketName: "bucket-a"}))
+	rec = httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "no destination") {
+		t.Errorf("Handler.Load() = %d %q, want routing error", rec.Code, rec.Body.String())
+	}
+	if fakes["bucket-a"].loadCount != 3 || fakes["bucket-b"].loadCount != 2 {
+		t.Errorf("Handler.Load() loadCount = %d, %d, want 3, 2", fakes["bucket-a"].loadCount, fakes["bucket-b"].loadCount)
+	}
+}
+
+type memAudit struct {
+	records []*audit.Record
+}
+
+func (s *memAudit) Write(ctx context.Context, r *audit.Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func TestClient_LoadAudit(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewMlabDatatype(api.DatatypeOpts{
+				Name:        "audited",
+				Experiment:  "exp",
+				BucketName:  "bucket",
+				Schema:      []byte(`[{"name":"date","type":"DATE"}]`),
+				UpdatedTime: time.Now(),
+			}),
+		},
+		dirs: map[string][]gcs.Dir{
+			"audited": {{Path: "gs://bucket/exp/audited/2023/06/01/*", Date: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+	}
+	fbq := &fakeBQ{loadStats: &bq.LoadStatistics{JobID: "job-1"}}
+	sink := &memAudit{}
+	c := NewClient(storage, fbq)
+	c.Audit = sink
+
+	req := httptest.NewRequest(http.MethodPost, "/v2/load?period=daily", nil)
+	req = req.WithContext(auth.WithCaller(req.Context(), &auth.Caller{ID: "scheduler"}))
+	req.Header.Set(RunIDHeader, "run-1")
+	c.Load(httptest.NewRecorder(), req)
+
+	wantActions := []string{audit.ActionCreateDataset, audit.ActionCreateTable, audit.ActionUpdateSchema, audit.ActionLoad}
+	if len(sink.records) != len(wantActions) {
+		t.Fatalf("Client.Load() audit records = %d, want %d", len(sink.records), len(wantActions))
+	}
+	for i, r := range sink.records {
+		if r.Action != wantActions[i] || r.Status != "OK" {
+			t.Errorf("Client.Load() record %d = %s %s, want %s OK", i, r.Action, r.Status, wantActions[i])
+		}
+		if r.RunID != "run-1" || r.Caller != "scheduler" || r.Request != "POST /v2/load?period=daily" {
+			t.Errorf("Client.Load() record %d trigger = %q %q %q", i, r.RunID, r.Caller, r.Request)
+		}
+		if r.Datatype != "audited" || r.Dataset != "raw_exp" {
+			t.Errorf("Client.Load() record %d datatype = %q, dataset = %q", i, r.Datatype, r.Dataset)
+		}
+	}
+	load := sink.records[3]
+	if load.Partition != "20230601" || load.JobID != "job-1" ||
+		len(load.SourceURIs) != 1 || load.SourceURIs[0] != "gs://bucket/exp/audited/2023/06/01/*" {
+		t.Errorf("Client.Load() load record = %+v", load)
+	}
+	if sink.records[2].NewSchema != `[{"name":"date","type":"DATE"}]` {
+		t.Errorf("Client.Load() update-schema record = %+v", sink.records[2])
+	}
+
+	// Failed jobs are recorded with their job ID.
+	sink.records = nil
+	fbq.loadErr = &bq.JobError{JobID: "job-2", Err: errors.New("failed")}
+	fbq.datasets = map[string]*bqfake.Dataset{"raw_exp": {}}
+	fbq.tables = map[string]*bigquery.TableMetadata{"audited": {LastModifiedTime: time.Now().Add(time.Hour)}}
+	c.Load(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v2/load?period=daily", nil))
+	if len(sink.records) != 1 {
+		t.Fatalf("Client.Load() audit records = %d, want 1", len(sink.records))
+	}
+	if r := sink.records[0]; r.Action != audit.ActionLoad || r.Status != "error" || r.JobID != "job-2" || r.Caller != "" {
+		t.Errorf("Client.Load() failed load record = %+v", r)
+	}
+}
+
+func TestClient_loadState(t *testing.T) {
+	store, err := state.OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	testingx.Must(t, err, "failed to open state store")
+	defer store.Close()
+
+	date := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	storage := &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"stateful": {{Path: "gs://bucket/exp/stateful/2023/06/01/*", Date: date, Fingerprint: "fp"}},
+		},
+	}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "stateful", Experiment: "exp", BucketName: "bucket"})
+	fbq := &fakeBQ{loadStats: &bq.LoadStatistics{
+		LoadStatistics: bigquery.LoadStatistics{OutputRows: 10, InputFiles: 2},
+		JobID:          "job-1",
+	}}
+	c := NewClient(storage, fbq)
+	c.State = store
+	ctx := audit.WithTrigger(context.Background(), audit.Trigger{RunID: "run-1"})
+
+	testingx.Must(t, c.load(ctx, nil, dt, periodOpts("daily")), "failed to load")
+	fbq.loadErr = &bq.JobError{JobID: "job-2", Err: errors.New("failed")}
+	if err := c.load(ctx, nil, dt, periodOpts("daily")); err == nil {
+		t.Fatalf("Client.load() error = nil, want error")
+	}
+
+	history, err := store.History(ctx, dt.ID(), "20230601")
+	testingx.Must(t, err, "failed to get history")
+	if len(history) != 2 {
+		t.Fatalf("Client.load() recorded %d loads, want 2", len(history))
+	}
+	ok, failed := history[0], history[1]
+	if ok.Status != state.StatusOK || ok.Rows != 10 || ok.InputFiles != 2 || ok.JobID != "job-1" ||
+		ok.Fingerprint != "fp" || ok.RunID != "run-1" || ok.Table != "stateful" || ok.Finished.IsZero() {
+		t.Errorf("Client.load() recorded %+v", ok)
+	}
+	if failed.Status != state.StatusError || failed.JobID != "job-2" || failed.Error == "" {
+		t.Errorf("Client.load() recorded %+v", failed)
+	}
+}
+
+func TestClient_loadFreshness(t *testing.T) {
+	updated := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	storage := &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"freshness-datatype": {
+				// Only the newest partition sets the lag, not the older one
+				// loaded last.
+				{Path: "fake-dir-path2", Date: time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC), Updated: updated.Add(-time.Hour)},
+				{Path: "fake-dir-path1", Date: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), Updated: updated},
+			},
+		},
+	}
+	dt := api.NewMlabDatatype(api.DatatypeOpts{
+		Name:         "freshness-datatype",
+		Experiment:   "freshness-experiment",
+		Organization: "freshness-org",
+	})
+	opts := periodOpts("daily")
+
+	c := NewClient(storage, &fakeBQ{})
+	start := time.Now()
+	err := c.load(context.Background(), nil, dt, opts)
+	testingx.Must(t, err, "failed to load")
+
+	l := labels(dt, opts.period)
+	if got := testutil.ToFloat64(metrics.SourceUpdatedTime.WithLabelValues(l...)); got != float64(updated.Unix()) {
+		t.Errorf("Client.load() source updated time = %v, want = %v", got, updated.Unix())
+	}
+	if got := testutil.ToFloat64(metrics.LastLoadTime.WithLabelValues(l...)); got < float64(start.Unix()) {
+		t.Errorf("Client.load() last load time = %v, want >= %v", got, start.Unix())
+	}
+	if got := testutil.ToFloat64(metrics.LoadLag.WithLabelValues(l...)); got < (3 * time.Hour).Seconds() {
+		t.Errorf("Client.load() lag = %v, want >= %v", got, (3 * time.Hour).Seconds())
+	}
+}
+
+func TestClient_LoadSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewThirdPartyDatatype(api.DatatypeOpts{Name: "datatype"}, ""),
+		},
+		dirs: map[string][]gcs.Dir{
+			"datatype": {{Path: "fake-dir-path"}},
+		},
+	}
+	c := NewClient(storage, &fakeBQ{})
+	req := httptest.NewRequest(http.MethodGet, "/v2/load?period=daily", nil)
+	c.Load(httptest.NewRecorder(), req)
+
+	want := map[string]bool{
+		"handler.Load":            true,
+		"handler.processDatatype": true,
+		"handler.loadPartition":   true,
+	}
+	for _, span := range sr.Ended() {
+		delete(want, span.Name())
+	}
+	if len(want) != 0 {
+		t.Errorf("Client.Load() missing spans: %v", want)
+	}
+}
+
+func TestClient_LoadRunID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewThirdPartyDatatype(api.DatatypeOpts{Name: "datatype"}, ""),
+		},
+		dirs: map[string][]gcs.Dir{},
+	}
+	c := NewClient(storage, &fakeBQ{})
+	req := httptest.NewRequest(http.MethodGet, "/v2/load?period=daily", nil)
+	req.Header.Set(RunIDHeader, "fake-run-id")
+	rec := httptest.NewRecorder()
+	c.Load(rec, req)
+
+	if got := rec.Header().Get(RunIDHeader); got != "fake-run-id" {
+		t.Errorf("Client.Load() run ID header = %q, want %q", got, "fake-run-id")
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) == 0 {
+		t.Fatal("Client.Load() did not log")
+	}
+	for _, line := range lines {
+		entry := map[string]any{}
+		testingx.Must(t, json.Unmarshal(line, &entry), "failed to parse log line")
+		if entry[logging.RunIDKey] != "fake-run-id" {
+			t.Errorf("Client.Load() log line %s missing run ID", line)
+		}
+	}
+}
+
+func TestClient_Datatypes(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "ndt7", Experiment: "ndt", BucketName: "bucket"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "hopannotation2", Experiment: "ndt"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "nodeinfo1", Experiment: "host"}),
+		},
+		discoveryErr: &gcs.ObjectError{Bucket: "bucket", Path: "path", Err: gcs.ErrInvalidSchema},
+	}
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+	}{
+		{
+			name:      "all",
+			wantNames: []string{"ndt7", "hopannotation2", "nodeinfo1"},
+		},
+		{
+			name:      "filtered",
+			query:     "experiment=ndt&datatype=ndt7",
+			wantNames: []string{"ndt7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(storage, &fakeBQ{})
+			rec := httptest.NewRecorder()
+			c.Datatypes(rec, httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+
+			var resp DatatypesResponse
+			testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &resp), "failed to unmarshal response")
+			got := []string{}
+			for _, info := range resp.Datatypes {
+				got = append(got, info.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("Handler.Datatypes() = %v, want %v", got, tt.wantNames)
+			}
+			if len(resp.Errors) != 1 {
+				t.Errorf("Handler.Datatypes() errors = %v, want 1 error", resp.Errors)
+			}
+			if tt.name == "filtered" && resp.Datatypes[0].Table != "ndt7" {
+				t.Errorf("Handler.Datatypes() table = %s, want ndt7", resp.Datatypes[0].Table)
+			}
+		})
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "ndt7", Experiment: "ndt"}),
+			api.NewMlabDatatype(api.DatatypeOpts{Name: "nodeinfo1", Experiment: "host"}),
+		},
+		dirs: map[string][]gcs.Dir{
+			"ndt7": {{Path: "fake-dir-path"}},
+		},
+	}
+	fake := &fakeBQ{}
+	c := NewClient(storage, fake)
+
+	for _, id := range []string{"run1", "run2"} {
+		req := httptest.NewRequest(http.MethodGet, "/?period=daily&experiment=ndt", nil)
+		req.Header.Set(RunIDHeader, id)
+		c.Load(httptest.NewRecorder(), req)
+	}
+	if fake.loadCount != 2 {
+		t.Errorf("Handler.Load() loadCount = %d, want 2", fake.loadCount)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name: "all",
+			want: []string{"run2", "run1"},
+		},
+		{
+			name:  "single",
+			query: "run=run1",
+			want:  []string{"run1"},
+		},
+		{
+			name:  "unknown",
+			query: "run=unknown",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c.Status(rec, httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+
+			var runs []Run
+			testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &runs), "failed to unmarshal response")
+			got := []string{}
+			for _, r := range runs {
+				got = append(got, r.ID)
+				if r.Status != RunOK || r.Datatypes != 1 || r.Finished == nil {
+					t.Errorf("Handler.Status() run = %+v, want 1 datatype loaded OK", r)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Handler.Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ShareRuns(t *testing.T) {
+	prev := NewClient(&fakeStorage{}, &fakeBQ{})
+	req := httptest.NewRequest(http.MethodGet, "/?period=daily", nil)
+	req.Header.Set(RunIDHeader, "before-reload")
+	prev.Load(httptest.NewRecorder(), req)
+
+	c := NewClient(&fakeStorage{}, &fakeBQ{})
+	c.ShareRuns(prev)
+
+	rec := httptest.NewRecorder()
+	c.Status(rec, httptest.NewRequest(http.MethodGet, "/?run=before-reload", nil))
+	var runs []Run
+	testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &runs), "failed to unmarshal response")
+	if len(runs) != 1 {
+		t.Errorf("Handler.Status() = %v, want the run recorded before ShareRuns", runs)
+	}
+}
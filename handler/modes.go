@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+)
+
+// Load modes.
+const (
+	// ModeTruncate replaces each partition with the contents of its
+	// directory.
+	ModeTruncate = "truncate"
+	// ModeAppend appends the files of each directory that no previous load
+	// of its partition loaded (see state.Store.LoadedFiles). It requires a state
+	// store.
+	ModeAppend = "append"
+	// ModeMerge upserts the rows of each directory into its partition on the
+	// datatype's key, through a staging table (see bq.Client.Merge).
+	ModeMerge = "merge"
+	// ModeReplace replaces the whole table, which is not partitioned, with the
+	// contents of the most recent directory.
+	ModeReplace = "replace"
+)
+
+var (
+	errNoState  = errors.New("append mode requires a state store")
+	errNoAppend = errors.New("BigQuery client does not append")
+	errNoMerge  = errors.New("BigQuery client does not merge")
+)
+
+// LoadMode is how the directories of a datatype are written to its table.
+type LoadMode struct {
+	// Mode is one of the load modes. If empty, it is ModeTruncate.
+	Mode string
+	// Key lists the fields identifying a row, for ModeMerge.
+	Key []string
+}
+
+// Appender is implemented by BQClients which append to partitions (see
+// bq.Client.Append). ModeAppend requires it.
+type Appender interface {
+	Append(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (*bq.LoadStatistics, error)
+}
+
+// Merger is implemented by BQClients which merge into partitions (see
+// bq.Client.Merge). ModeMerge requires it.
+type Merger interface {
+	Merge(ctx context.Context, ds bqiface.Dataset, name string, key []string, checks []bq.StagingCheck, uri ...string) (*bq.LoadStatistics, error)
+}
+
+// mode returns the load mode of a datatype.
+func (c *Client) mode(dt *api.Datatype) LoadMode {
+	var m LoadMode
+	if c.Modes != nil {
+		m = c.Modes(dt)
+	}
+	if m.Mode == "" {
+		m.Mode = ModeTruncate
+	}
+	return m
+}
+
+// checkMode returns an error if the client cannot load in the mode, with the
+// staging options, if any.
+func (c *Client) checkMode(m LoadMode, staging *Staging) error {
+	switch m.Mode {
+	case ModeAppend:
+		if c.State == nil {
+			return errNoState
+		}
+		if _, ok := c.BQClient.(Appender); !ok {
+			return errNoAppend
+		}
+	case ModeMerge:
+		if _, ok := c.BQClient.(Merger); !ok {
+			return errNoMerge
+		}
+	default:
+		if _, ok := c.BQClient.(StagedLoader); staging != nil && !ok {
+			return errNoStaging
+		}
+	}
+	return nil
+}
+
+// newFiles returns the files of a directory which no successful load of the
+// partition loaded.
+func (c *Client) newFiles(ctx context.Context, dt *api.Datatype, partition string, dir gcs.Dir) ([]string, error) {
+	loaded, err := c.State.LoadedFiles(ctx, dt.ID(), partition)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(loaded))
+	for _, f := range loaded {
+		seen[f] = true
+	}
+	files := make([]string, 0)
+	for _, f := range dir.Files {
+		if !seen[f] {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
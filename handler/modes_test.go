@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/audit"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/go/testingx"
+)
+
+// modeBQ records the loads of every mode, as "<operation> <table> <uris>".
+type modeBQ struct {
+	*fakeBQ
+	ops  []string
+	keys []string
+}
+
+func (b *modeBQ) record(op, name string, uri []string) *bq.LoadStatistics {
+	b.ops = append(b.ops, op+" "+name+" "+strings.Join(uri, ","))
+	return &bq.LoadStatistics{LoadStatistics: bigquery.LoadStatistics{OutputRows: 10}, JobID: op + "-job"}
+}
+
+func (b *modeBQ) Load(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (*bq.LoadStatistics, error) {
+	return b.record("load", name, uri), nil
+}
+
+func (b *modeBQ) Append(ctx context.Context, ds bqiface.Dataset, name string, uri ...string) (*bq.LoadStatistics, error) {
+	return b.record("append", name, uri), nil
+}
+
+func (b *modeBQ) Merge(ctx context.Context, ds bqiface.Dataset, name string, key []string, checks []bq.StagingCheck, uri ...string) (*bq.LoadStatistics, error) {
+	stats := b.record("merge", name, uri)
+	b.keys = key
+	for _, check := range checks {
+		if err := check.Check(ctx, nil, nil, stats); err != nil {
+			return stats, &bq.CheckError{Check: check.Name, Err: err}
+		}
+	}
+	stats.StagedJobID = "merge-query-job"
+	return stats, nil
+}
+
+func TestClient_loadModes(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "moded", Experiment: "exp", BucketName: "bucket"})
+	storage := &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"moded": {
+				{Path: "gs://b/1/*", Date: day(1), Files: []string{"gs://b/1/a"}},
+				{Path: "gs://b/2/*", Date: day(2), Files: []string{"gs://b/2/a"}},
+			},
+		},
+	}
+	opts := &LoadOptions{start: "2023/06/01", end: "2023/06/03", period: "custom"}
+
+	tests := []struct {
+		name        string
+		mode        LoadMode
+		checks      RowChecks
+		bq          BQClient
+		want        []string
+		wantActions []string
+		wantErr     error
+	}{
+		{
+			name:        "default",
+			bq:          &modeBQ{fakeBQ: &fakeBQ{}},
+			want:        []string{"load moded$20230601 gs://b/1/*", "load moded$20230602 gs://b/2/*"},
+			wantActions: []string{audit.ActionLoad, audit.ActionLoad},
+		},
+		{
+			name:        "replace",
+			mode:        LoadMode{Mode: ModeReplace},
+			bq:          &modeBQ{fakeBQ: &fakeBQ{}},
+			want:        []string{"load moded gs://b/2/*"},
+			wantActions: []string{audit.ActionReplace},
+		},
+		{
+			name:        "merge",
+			mode:        LoadMode{Mode: ModeMerge, Key: []string{"id"}},
+			bq:          &modeBQ{fakeBQ: &fakeBQ{}},
+			want:        []string{"merge moded$20230601 gs://b/1/*", "merge moded$20230602 gs://b/2/*"},
+			wantActions: []string{audit.ActionMerge, audit.ActionMerge},
+		},
+		{
+			name:        "merge-row-check",
+			mode:        LoadMode{Mode: ModeMerge, Key: []string{"id"}},
+			checks:      RowChecks{MinRows: 11},
+			bq:          &modeBQ{fakeBQ: &fakeBQ{}},
+			want:        []string{"merge moded$20230601 gs://b/1/*", "merge moded$20230602 gs://b/2/*"},
+			wantActions: []string{audit.ActionMerge, audit.ActionMerge},
+			wantErr:     &bq.CheckError{},
+		},
+		{
+			name:    "append-without-state",
+			mode:    LoadMode{Mode: ModeAppend},
+			bq:      &modeBQ{fakeBQ: &fakeBQ{}},
+			wantErr: errNoState,
+		},
+		{
+			name:    "merge-unsupported",
+			mode:    LoadMode{Mode: ModeMerge, Key: []string{"id"}},
+			bq:      &fakeBQ{},
+			wantErr: errNoMerge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memAudit{}
+			c := NewClient(storage, tt.bq)
+			c.Audit = sink
+			c.Modes = func(*api.Datatype) LoadMode { return tt.mode }
+			c.Checks = func(*api.Datatype) RowChecks { return tt.checks }
+
+			err := c.load(context.Background(), nil, dt, opts)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Client.load() error = %v, want %v", err, tt.wantErr)
+			}
+			if b, ok := tt.bq.(*modeBQ); ok {
+				if diff := cmp.Diff(b.ops, tt.want); diff != "" {
+					t.Errorf("Client.load() operations mismatch (-got +want):\n%s", diff)
+				}
+				if tt.mode.Mode == ModeMerge && !cmp.Equal(b.keys, tt.mode.Key) {
+					t.Errorf("Client.load() merged on %v, want %v", b.keys, tt.mode.Key)
+				}
+			}
+			var actions []string
+			for _, r := range sink.records {
+				actions = append(actions, r.Action)
+			}
+			if diff := cmp.Diff(actions, tt.wantActions); diff != "" {
+				t.Errorf("Client.load() audit actions mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_loadAppend(t *testing.T) {
+	day := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "appended", Experiment: "exp", BucketName: "bucket"})
+	storage := &fakeStorage{}
+	fbq := &modeBQ{fakeBQ: &fakeBQ{}}
+	c := NewClient(storage, fbq)
+	c.State = openBackfillStore(t)
+	c.Modes = func(*api.Datatype) LoadMode { return LoadMode{Mode: ModeAppend} }
+	ctx := context.Background()
+	opts := &LoadOptions{start: "2023/06/01", end: "2023/06/02", period: "custom"}
+
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{
+			name:  "first",
+			files: []string{"gs://b/1/a", "gs://b/1/b"},
+			want:  []string{"append appended$20230601 gs://b/1/a,gs://b/1/b"},
+		},
+		{
+			name:  "late-file",
+			files: []string{"gs://b/1/a", "gs://b/1/b", "gs://b/1/c"},
+			want:  []string{"append appended$20230601 gs://b/1/c"},
+		},
+		{
+			name:  "no-new-files",
+			files: []string{"gs://b/1/a", "gs://b/1/b", "gs://b/1/c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fbq.ops = nil
+			storage.dirs = map[string][]gcs.Dir{
+				"appended": {{Path: "gs://b/1/*", Date: day, Files: tt.files}},
+			}
+			testingx.Must(t, c.load(ctx, nil, dt, opts), "failed to load")
+			if diff := cmp.Diff(fbq.ops, tt.want); diff != "" {
+				t.Errorf("Client.load() operations mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
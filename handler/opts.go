@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/m-lab/autoloader/api"
 	"github.com/m-lab/go/timex"
 )
 
@@ -19,6 +20,8 @@ type LoadOptions struct {
 
 const (
 	start = "0000/00/00"
+	// periodDefault marks a load using the default period of each bucket.
+	periodDefault = "default"
 )
 
 var (
@@ -49,6 +52,19 @@ func getOpts(values url.Values) (*LoadOptions, error) {
 	return nil, errPeriod
 }
 
+// RequestPeriod returns the period a load request asks for: "custom" for a
+// date range, the "period" parameter if present, or "default" otherwise. It
+// does not validate the request (see getOpts).
+func RequestPeriod(values url.Values) string {
+	if values.Get("start") != "" && values.Get("end") != "" {
+		return "custom"
+	}
+	if p := values.Get("period"); p != "" {
+		return p
+	}
+	return periodDefault
+}
+
 func periodOpts(p string) *LoadOptions {
 	now := time.Now().UTC()
 	tomorrow := now.AddDate(0, 0, 1).Format(timex.YYYYMMDDWithSlash)
@@ -63,9 +79,65 @@ func periodOpts(p string) *LoadOptions {
 		return &LoadOptions{month, yesterday, p}
 	case "annually":
 		return &LoadOptions{year, month, p}
-	case "everything":
+	case periodEverything:
 		return &LoadOptions{start, tomorrow, p}
 	}
 
 	return nil
 }
+
+// periodic reports whether the period is one of the rolling periods of
+// scheduled loads, rather than a date range or the complete history.
+func periodic(p string) bool {
+	return p == "daily" || p == "monthly" || p == "annually"
+}
+
+// Filter selects the datatypes a request applies to. Empty fields match all
+// the datatypes.
+type Filter struct {
+	Experiment   string `json:"experiment,omitempty"`
+	Datatype     string `json:"datatype,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// getFilter returns the datatype filter specified in the query parameters.
+func getFilter(values url.Values) Filter {
+	return Filter{
+		Experiment:   values.Get("experiment"),
+		Datatype:     values.Get("datatype"),
+		Organization: values.Get("organization"),
+	}
+}
+
+// Match reports whether the datatype is selected by the filter.
+func (f Filter) Match(dt *api.Datatype) bool {
+	return (f.Experiment == "" || f.Experiment == dt.Experiment) &&
+		(f.Datatype == "" || f.Datatype == dt.Name) &&
+		(f.Organization == "" || f.Organization == dt.Organization)
+}
+
+// Values returns the filter as query parameters.
+func (f Filter) Values() url.Values {
+	values := url.Values{}
+	if f.Experiment != "" {
+		values.Set("experiment", f.Experiment)
+	}
+	if f.Datatype != "" {
+		values.Set("datatype", f.Datatype)
+	}
+	if f.Organization != "" {
+		values.Set("organization", f.Organization)
+	}
+	return values
+}
+
+// filterDatatypes returns the datatypes selected by the filter.
+func filterDatatypes(datatypes []*api.Datatype, f Filter) []*api.Datatype {
+	filtered := make([]*api.Datatype, 0, len(datatypes))
+	for _, dt := range datatypes {
+		if f.Match(dt) {
+			filtered = append(filtered, dt)
+		}
+	}
+	return filtered
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/m-lab/autoloader/api"
 	"github.com/m-lab/go/timex"
 )
 
@@ -64,6 +65,26 @@ func Test_getOpts(t *testing.T) {
 	}
 }
 
+func TestRequestPeriod(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		want   string
+	}{
+		{name: "period", values: url.Values{"period": {"daily"}}, want: "daily"},
+		{name: "range", values: url.Values{"start": {"2023/01/01"}, "end": {"2023/02/01"}, "period": {"daily"}}, want: "custom"},
+		{name: "partial-range", values: url.Values{"start": {"2023/01/01"}}, want: "default"},
+		{name: "none", values: url.Values{}, want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestPeriod(tt.values); got != tt.want {
+				t.Errorf("RequestPeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_periodOpts(t *testing.T) {
 	now := time.Now().UTC()
 	tests := []struct {
@@ -121,3 +142,50 @@ func Test_periodOpts(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_Match(t *testing.T) {
+	dt := &api.Datatype{
+		DatatypeOpts: api.DatatypeOpts{
+			Name:         "ndt7",
+			Experiment:   "ndt",
+			Organization: "mlab",
+		},
+	}
+	tests := []struct {
+		name   string
+		values url.Values
+		want   bool
+	}{
+		{
+			name:   "empty",
+			values: url.Values{},
+			want:   true,
+		},
+		{
+			name:   "all-fields",
+			values: url.Values{"experiment": {"ndt"}, "datatype": {"ndt7"}, "organization": {"mlab"}},
+			want:   true,
+		},
+		{
+			name:   "other-experiment",
+			values: url.Values{"experiment": {"host"}},
+			want:   false,
+		},
+		{
+			name:   "other-organization",
+			values: url.Values{"datatype": {"ndt7"}, "organization": {"other"}},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := getFilter(tt.values)
+			if got := f.Match(dt); got != tt.want {
+				t.Errorf("Filter.Match() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(f.Values(), tt.values) {
+				t.Errorf("Filter.Values() = %v, want %v", f.Values(), tt.values)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/go/timex"
+)
+
+const (
+	// periodReconcile marks the loads of the gaps found by Reconcile.
+	periodReconcile = "reconcile"
+)
+
+// Gap kinds.
+const (
+	// GapMissing is a day with source data, but no or an empty partition.
+	GapMissing = "missing"
+	// GapExtra is a non-empty partition with no source data.
+	GapExtra = "extra"
+	// GapStale is a partition last modified before its source data.
+	GapStale = "stale"
+)
+
+var errNoPartitions = errors.New("BigQuery client does not list partitions")
+
+// PartitionLister is implemented by BQClients which list the partitions of a
+// table (see bq.Client.PartitionInfo). Reconcile requires it.
+type PartitionLister interface {
+	PartitionInfo(ctx context.Context, dataset, table string) (map[string]*bq.Partition, error)
+}
+
+// Gap is a difference between the source data of a day and its partition.
+type Gap struct {
+	Partition string `json:"partition"` // YYYYMMDD.
+	Kind      string `json:"kind"`
+	Path      string `json:"path,omitempty"`
+	// SourceUpdated is the most recent update of the source data, and
+	// PartitionModified the last modification of the partition, if they exist.
+	SourceUpdated     time.Time `json:"source_updated"`
+	PartitionModified time.Time `json:"partition_modified"`
+	Rows              int64     `json:"rows"`
+	// Loaded and Error report the outcome of loading the gap, if requested.
+	Loaded bool   `json:"loaded,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Reconciliation lists the gaps between the source data and the partitions of
+// a datatype.
+type Reconciliation struct {
+	Datatype   DatatypeInfo `json:"datatype"`
+	Dirs       int          `json:"dirs"`
+	Partitions int          `json:"partitions"`
+	Gaps       []Gap        `json:"gaps"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// ReconcileResponse is the response of the Reconcile handler.
+type ReconcileResponse struct {
+	RunID     string           `json:"run_id,omitempty"`
+	Start     string           `json:"start"` // inclusive.
+	End       string           `json:"end"`   // exclusive.
+	Datatypes []Reconciliation `json:"datatypes"`
+	Errors    []string         `json:"errors,omitempty"`
+	// Violations lists the loaded gaps failing a row check.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Reconcile compares the storage directories of each datatype with the
+// partitions of its table, for the period or date range of the request, and
+// writes the gaps as JSON: days missing (or empty) in BigQuery, partitions
+// with no source data and partitions older than their source data. The
+// `experiment`, `datatype` and `organization` query parameters filter the
+// datatypes. With `load=true`, the missing and stale partitions are loaded.
+func (c *Client) Reconcile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	opts, err := getOpts(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	filter := getFilter(r.URL.Query())
+	load := r.URL.Query().Get("load") == "true"
+
+	resp := ReconcileResponse{Start: opts.start, End: opts.end, Datatypes: make([]Reconciliation, 0)}
+	var run *Run
+	ctx, violations := withViolations(ctx)
+	if load {
+		ctx, resp.RunID = withRun(ctx, r)
+		w.Header().Set(RunIDHeader, resp.RunID)
+		ctx = logging.With(ctx, "period", periodReconcile)
+		run = &Run{
+			ID:      resp.RunID,
+			Period:  periodReconcile,
+			Start:   opts.start,
+			End:     opts.end,
+			Filter:  filter,
+			Started: time.Now().UTC(),
+		}
+		c.runs.start(run)
+	}
+
+	datatypes, err := c.GetDatatypes(ctx)
+	resp.Errors = discoveryErrors(ctx, err)
+	datatypes, err = api.CheckCollisions(datatypes, c.Projects)
+	resp.Errors = append(resp.Errors, collisionErrors(ctx, err)...)
+	datatypes = filterDatatypes(datatypes, filter)
+	for _, dt := range datatypes {
+		rec := c.reconcile(ctx, dt, opts)
+		if rec.Error == "" && load {
+			c.loadGaps(ctx, dt, rec.Gaps)
+		}
+		for _, g := range rec.Gaps {
+			if g.Error != "" {
+				resp.Errors = append(resp.Errors, fmt.Sprintf("failed to load %s.%s partition %s: %s", dt.Experiment, dt.Name, g.Partition, g.Error))
+			}
+		}
+		if rec.Error != "" {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("failed to reconcile %s.%s: %s", dt.Experiment, dt.Name, rec.Error))
+		}
+		resp.Datatypes = append(resp.Datatypes, rec)
+	}
+
+	if flagged := violations.strings(); len(flagged) != 0 {
+		resp.Violations = flagged
+	}
+	if run != nil {
+		c.runs.finish(run, len(datatypes), resp.Errors, resp.Violations)
+	}
+	writeJSON(w, resp)
+}
+
+// reconcile returns the gaps between the datatype's directories and the
+// partitions of its table. If the dataset or table does not exist, every day
+// with source data is missing. Tables loaded in ModeReplace have no gaps.
+func (c *Client) reconcile(ctx context.Context, dt *api.Datatype, opts *LoadOptions) Reconciliation {
+	ctx = logging.With(ctx, logging.Datatype(dt)...)
+	logger := logging.FromContext(ctx)
+	rec := Reconciliation{Datatype: NewDatatypeInfo(dt), Gaps: make([]Gap, 0)}
+	if c.mode(dt).Mode == ModeReplace {
+		// The table is not partitioned, and only the most recent directory
+		// is loaded.
+		return rec
+	}
+
+	dirs, err := c.StorageClient.GetDirs(ctx, dt, opts.start, opts.end)
+	if err != nil {
+		logger.Error("failed to get directories", logging.ErrorKey, err)
+		rec.Error = err.Error()
+		return rec
+	}
+	parts, err := c.partitions(ctx, dt)
+	if err != nil {
+		logger.Error("failed to list partitions", logging.ErrorKey, err)
+		rec.Error = err.Error()
+		return rec
+	}
+	rec.Dirs = len(dirs)
+
+	// Partition IDs (YYYYMMDD) sort like the dates of the range.
+	first := strings.ReplaceAll(opts.start, "/", "")
+	last := strings.ReplaceAll(opts.end, "/", "")
+	sourced := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		id := dir.Date.Format(timex.YYYYMMDD)
+		sourced[id] = true
+		gap := Gap{Partition: id, Path: dir.Path, SourceUpdated: dir.Updated}
+		p, ok := parts[id]
+		if ok {
+			gap.PartitionModified, gap.Rows = p.LastModified, p.Rows
+		}
+		switch {
+		case !ok || p.Rows == 0:
+			gap.Kind = GapMissing
+		case p.LastModified.Before(dir.Updated):
+			gap.Kind = GapStale
+		default:
+			continue
+		}
+		rec.Gaps = append(rec.Gaps, gap)
+	}
+	for id, p := range parts {
+		if id < first || id >= last {
+			continue
+		}
+		rec.Partitions++
+		if !sourced[id] && p.Rows > 0 {
+			rec.Gaps = append(rec.Gaps, Gap{Partition: id, Kind: GapExtra, PartitionModified: p.LastModified, Rows: p.Rows})
+		}
+	}
+	sort.Slice(rec.Gaps, func(i, j int) bool { return rec.Gaps[i].Partition < rec.Gaps[j].Partition })
+
+	logger.Info("reconciled BigQuery table", "start", opts.start, "end", opts.end,
+		"dirs", rec.Dirs, "partitions", rec.Partitions, "gaps", len(rec.Gaps))
+	return rec
+}
+
+// partitions returns the partitions of the datatype's table, or none if its
+// dataset or table does not exist.
+func (c *Client) partitions(ctx context.Context, dt *api.Datatype) (map[string]*bq.Partition, error) {
+	client := c.BQClient
+	if c.Router != nil {
+		var err error
+		if client, err = c.Router(dt); err != nil {
+			return nil, err
+		}
+	}
+	lister, ok := client.(PartitionLister)
+	if !ok {
+		return nil, errNoPartitions
+	}
+	ds, err := client.GetDataset(ctx, dt.Dataset())
+	if err != nil {
+		return map[string]*bq.Partition{}, nil
+	}
+	if _, err := client.GetTableMetadata(ctx, ds, dt.Table()); err != nil {
+		return map[string]*bq.Partition{}, nil
+	}
+	return lister.PartitionInfo(ctx, dt.Dataset(), dt.Table())
+}
+
+// loadGaps loads the missing and stale partitions, a range of consecutive
+// days at a time, and records the outcome in the gaps.
+func (c *Client) loadGaps(ctx context.Context, dt *api.Datatype, gaps []Gap) {
+	var batch []*Gap
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		first, _ := time.Parse(timex.YYYYMMDD, batch[0].Partition)
+		last, _ := time.Parse(timex.YYYYMMDD, batch[len(batch)-1].Partition)
+		opts := &LoadOptions{
+			start:  first.Format(timex.YYYYMMDDWithSlash),
+			end:    last.AddDate(0, 0, 1).Format(timex.YYYYMMDDWithSlash),
+			period: periodReconcile,
+		}
+		err := c.processDatatype(ctx, dt, opts)
+		for _, g := range batch {
+			g.Loaded = err == nil
+			if err != nil {
+				g.Error = err.Error()
+			}
+		}
+		batch = nil
+	}
+
+	var prev time.Time
+	for i := range gaps {
+		g := &gaps[i]
+		if g.Kind == GapExtra {
+			continue
+		}
+		date, err := time.Parse(timex.YYYYMMDD, g.Partition)
+		if err != nil {
+			g.Error = err.Error()
+			continue
+		}
+		if len(batch) != 0 && !date.Equal(prev.AddDate(0, 0, 1)) {
+			flush()
+		}
+		batch = append(batch, g)
+		prev = date
+	}
+	flush()
+}
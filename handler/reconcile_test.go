@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/go/cloudtest/bqfake"
+	"github.com/m-lab/go/testingx"
+	"github.com/m-lab/go/timex"
+)
+
+// rangeStorage returns the directories within the requested date range.
+type rangeStorage struct {
+	*fakeStorage
+}
+
+func (s *rangeStorage) GetDirs(ctx context.Context, dt *api.Datatype, start, end string) ([]gcs.Dir, error) {
+	dirs, err := s.fakeStorage.GetDirs(ctx, dt, start, end)
+	if err != nil {
+		return nil, err
+	}
+	inRange := make([]gcs.Dir, 0)
+	for _, dir := range dirs {
+		d := dir.Date.Format(timex.YYYYMMDDWithSlash)
+		if d >= start && d < end {
+			inRange = append(inRange, dir)
+		}
+	}
+	return inRange, nil
+}
+
+// partitionsBQ lists the partitions of every table.
+type partitionsBQ struct {
+	*fakeBQ
+	parts map[string]*bq.Partition
+}
+
+func (b *partitionsBQ) PartitionInfo(ctx context.Context, dataset, table string) (map[string]*bq.Partition, error) {
+	return b.parts, nil
+}
+
+func TestClient_reconcile(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+	updated := day(10)
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "reconciled", Experiment: "exp", BucketName: "bucket"})
+	storage := &rangeStorage{&fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"reconciled": {
+				{Path: "path1", Date: day(1), Updated: updated},
+				{Path: "path2", Date: day(2), Updated: updated},
+				{Path: "path3", Date: day(3), Updated: updated},
+				{Path: "path4", Date: day(4), Updated: updated},
+			},
+		},
+	}}
+	parts := map[string]*bq.Partition{
+		"20230102": {ID: "20230102", Rows: 1, LastModified: updated},
+		"20230602": {ID: "20230602", Rows: 10, LastModified: updated.Add(time.Hour)},
+		"20230603": {ID: "20230603", Rows: 10, LastModified: updated.Add(-time.Hour)},
+		"20230604": {ID: "20230604", Rows: 0, LastModified: updated},
+		"20230605": {ID: "20230605", Rows: 5, LastModified: updated},
+	}
+	existing := &fakeBQ{
+		datasets: map[string]*bqfake.Dataset{dt.Dataset(): {}},
+		tables:   map[string]*bigquery.TableMetadata{dt.Table(): {}},
+	}
+	opts := &LoadOptions{start: "2023/06/01", end: "2023/06/06", period: "custom"}
+
+	tests := []struct {
+		name       string
+		bq         BQClient
+		mode       string
+		want       []Gap
+		partitions int
+		wantErr    bool
+	}{
+		{
+			name: "gaps",
+			bq:   &partitionsBQ{fakeBQ: existing, parts: parts},
+			want: []Gap{
+				{Partition: "20230601", Kind: GapMissing, Path: "path1", SourceUpdated: updated},
+				{Partition: "20230603", Kind: GapStale, Path: "path3", SourceUpdated: updated,
+					PartitionModified: updated.Add(-time.Hour), Rows: 10},
+				{Partition: "20230604", Kind: GapMissing, Path: "path4", SourceUpdated: updated, PartitionModified: updated},
+				{Partition: "20230605", Kind: GapExtra, PartitionModified: updated, Rows: 5},
+			},
+			partitions: 4,
+		},
+		{
+			name: "no-table",
+			bq:   &partitionsBQ{fakeBQ: &fakeBQ{}, parts: parts},
+			want: []Gap{
+				{Partition: "20230601", Kind: GapMissing, Path: "path1", SourceUpdated: updated},
+				{Partition: "20230602", Kind: GapMissing, Path: "path2", SourceUpdated: updated},
+				{Partition: "20230603", Kind: GapMissing, Path: "path3", SourceUpdated: updated},
+				{Partition: "20230604", Kind: GapMissing, Path: "path4", SourceUpdated: updated},
+			},
+		},
+		{
+			name: "replace",
+			bq:   &partitionsBQ{fakeBQ: existing, parts: parts},
+			mode: ModeReplace,
+			want: []Gap{},
+		},
+		{
+			name:    "no-lister",
+			bq:      existing,
+			want:    []Gap{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(storage, tt.bq)
+			c.Modes = func(*api.Datatype) LoadMode { return LoadMode{Mode: tt.mode} }
+			rec := c.reconcile(context.Background(), dt, opts)
+			if (rec.Error != "") != tt.wantErr {
+				t.Fatalf("Client.reconcile() error = %q, wantErr = %v", rec.Error, tt.wantErr)
+			}
+			if diff := cmp.Diff(rec.Gaps, tt.want); diff != "" {
+				t.Errorf("Client.reconcile() gaps mismatch (-got +want):\n%s", diff)
+			}
+			if rec.Partitions != tt.partitions {
+				t.Errorf("Client.reconcile() partitions = %d, want %d", rec.Partitions, tt.partitions)
+			}
+		})
+	}
+}
+
+func TestClient_Reconcile(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+	updated := day(10)
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "reconciled", Experiment: "exp", BucketName: "bucket"})
+	storage := &rangeStorage{&fakeStorage{
+		datatypes: []*api.Datatype{dt},
+		dirs: map[string][]gcs.Dir{
+			"reconciled": {
+				{Path: "path1", Date: day(1), Updated: updated},
+				{Path: "path2", Date: day(2), Updated: updated},
+				{Path: "path3", Date: day(3), Updated: updated},
+				{Path: "path4", Date: day(4), Updated: updated},
+			},
+		},
+	}}
+	fbq := &partitionsBQ{
+		fakeBQ: &fakeBQ{
+			datasets: map[string]*bqfake.Dataset{dt.Dataset(): {}},
+			tables:   map[string]*bigquery.TableMetadata{dt.Table(): {}},
+		},
+		parts: map[string]*bq.Partition{
+			"20230602": {ID: "20230602", Rows: 10, LastModified: updated},
+			"20230603": {ID: "20230603", Rows: 10, LastModified: updated.Add(-time.Hour)},
+		},
+	}
+	c := NewClient(storage, fbq)
+
+	tests := []struct {
+		name      string
+		target    string
+		wantCode  int
+		wantLoads int
+		want      map[string]bool // Loaded, by partition.
+	}{
+		{
+			name:     "report",
+			target:   "/v2/reconcile?start=2023/06/01&end=2023/06/05",
+			wantCode: http.StatusOK,
+			want:     map[string]bool{"20230601": false, "20230603": false, "20230604": false},
+		},
+		{
+			name:      "load",
+			target:    "/v2/reconcile?start=2023/06/01&end=2023/06/05&load=true",
+			wantCode:  http.StatusOK,
+			wantLoads: 3,
+			want:      map[string]bool{"20230601": true, "20230603": true, "20230604": true},
+		},
+		{
+			name:     "filtered",
+			target:   "/v2/reconcile?start=2023/06/01&end=2023/06/05&datatype=other",
+			wantCode: http.StatusOK,
+			want:     map[string]bool{},
+		},
+		{
+			name:     "bad-request",
+			target:   "/v2/reconcile",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fbq.loadCount = 0
+			rec := httptest.NewRecorder()
+			c.Reconcile(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Client.Reconcile() status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp ReconcileResponse
+			testingx.Must(t, json.Unmarshal(rec.Body.Bytes(), &resp), "failed to decode response")
+			if len(resp.Errors) != 0 {
+				t.Errorf("Client.Reconcile() errors = %v", resp.Errors)
+			}
+			got := map[string]bool{}
+			for _, r := range resp.Datatypes {
+				for _, g := range r.Gaps {
+					got[g.Partition] = g.Loaded
+				}
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Client.Reconcile() gaps mismatch (-got +want):\n%s", diff)
+			}
+			if fbq.loadCount != tt.wantLoads {
+				t.Errorf("Client.Reconcile() loaded %d partitions, want %d", fbq.loadCount, tt.wantLoads)
+			}
+		})
+	}
+}
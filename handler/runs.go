@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRuns is the number of recent runs kept in memory.
+	maxRuns = 100
+)
+
+// Run statuses.
+const (
+	RunRunning = "running"
+	RunOK      = "OK"
+	RunError   = "error"
+)
+
+// Run describes a single load request.
+type Run struct {
+	ID        string     `json:"id"`
+	Period    string     `json:"period"`
+	Start     string     `json:"start"` // inclusive.
+	End       string     `json:"end"`   // exclusive.
+	Filter    Filter     `json:"filter"`
+	Status    string     `json:"status"`
+	Started   time.Time  `json:"started"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Datatypes int        `json:"datatypes"`
+	Errors    []string   `json:"errors,omitempty"`
+	// Violations lists the loaded partitions failing a row check.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// runLog keeps the most recent runs in memory.
+type runLog struct {
+	mu   sync.Mutex
+	runs []*Run // Oldest first.
+}
+
+func newRunLog() *runLog {
+	return &runLog{runs: make([]*Run, 0)}
+}
+
+// start records a new run.
+func (l *runLog) start(r *Run) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Status = RunRunning
+	l.runs = append(l.runs, r)
+	if len(l.runs) > maxRuns {
+		l.runs = l.runs[len(l.runs)-maxRuns:]
+	}
+}
+
+// finish records the outcome of a run.
+func (l *runLog) finish(r *Run, datatypes int, errs, violations []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().UTC()
+	r.Finished = &now
+	r.Datatypes = datatypes
+	r.Errors = errs
+	if len(violations) != 0 {
+		r.Violations = violations
+	}
+	r.Status = RunOK
+	if len(errs) != 0 {
+		r.Status = RunError
+	}
+}
+
+// list returns a copy of the runs, most recent first. If id is not empty, it
+// only returns the run with that ID.
+func (l *runLog) list(id string) []Run {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	runs := make([]Run, 0)
+	for i := len(l.runs) - 1; i >= 0; i-- {
+		if id == "" || l.runs[i].ID == id {
+			runs = append(runs, *l.runs[i])
+		}
+	}
+	return runs
+}
+
+// Status writes the most recent runs handled by the client as JSON. The
+// `run` query parameter selects a single run by ID.
+func (c *Client) Status(w http.ResponseWriter, r *http.Request) {
+	runs := c.runs.list(r.URL.Query().Get("run"))
+	writeJSON(w, runs)
+}
+
+// writeJSON writes v as the JSON body of a 200 OK response.
+func writeJSON(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// ShareRuns makes the client record its runs and backfills in the same
+// history as prev, so the Status and Backfills handlers keep reporting them
+// when the client is replaced (e.g., after a configuration reload).
+func (c *Client) ShareRuns(prev *Client) {
+	c.runs = prev.runs
+	c.backfills = prev.backfills
+}
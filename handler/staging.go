@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+)
+
+// checkRows is the name of the staging check verifying the row checks.
+const checkRows = "rows"
+
+var errNoStaging = errors.New("BigQuery client does not load through staging tables")
+
+// StagedLoader is implemented by BQClients which load partitions through
+// staging tables (see bq.Client.LoadStaged). Staged loads require it.
+type StagedLoader interface {
+	LoadStaged(ctx context.Context, ds bqiface.Dataset, name string, checks []bq.StagingCheck, uri ...string) (*bq.LoadStatistics, error)
+}
+
+// Staging contains the options of a datatype's staged loads.
+type Staging struct {
+	// Checks are run on each staging table, after the row checks.
+	Checks []bq.StagingCheck
+}
+
+// staging returns the staging options of a datatype, or nil if its
+// partitions are loaded directly.
+func (c *Client) staging(dt *api.Datatype) *Staging {
+	if c.Staging == nil {
+		return nil
+	}
+	return c.Staging(dt)
+}
+
+// stagingChecks returns the checks of a partition loaded through a staging
+// table: the row checks (see Client.checkRows), whose violations keep the
+// partition from being written, followed by the datatype's own checks, if
+// any. Since the partition is not loaded, its violations are only reported as
+// the error of its load, not as flagged violations.
+func (c *Client) stagingChecks(dt *api.Datatype, s *Staging, dir gcs.Dir, prev *dayRows) []bq.StagingCheck {
+	rows := bq.StagingCheck{
+		Name: checkRows,
+		Check: func(ctx context.Context, _ *bq.Client, _ bqiface.Table, stats *bq.LoadStatistics) error {
+			if v := c.checkRows(ctx, dt, dir, stats, prev); len(v) != 0 {
+				return fmt.Errorf("%d row check violations, first: %s", len(v), v[0])
+			}
+			return nil
+		},
+	}
+	checks := []bq.StagingCheck{rows}
+	if s != nil {
+		checks = append(checks, s.Checks...)
+	}
+	return checks
+}
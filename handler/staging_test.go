@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+)
+
+// stagedBQ loads partitions through staging tables, recording the copied
+// partitions.
+type stagedBQ struct {
+	*fakeBQ
+	copied []string
+}
+
+func (b *stagedBQ) LoadStaged(ctx context.Context, ds bqiface.Dataset, name string, checks []bq.StagingCheck, uri ...string) (*bq.LoadStatistics, error) {
+	stats, err := b.fakeBQ.Load(ctx, ds, name, uri...)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if err := check.Check(ctx, nil, nil, stats); err != nil {
+			return stats, &bq.CheckError{Check: check.Name, Err: err}
+		}
+	}
+	b.copied = append(b.copied, name)
+	staged := *stats
+	staged.StagedJobID = "copy-job-id"
+	return &staged, nil
+}
+
+func TestClient_loadStaged(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "staged", Experiment: "exp", BucketName: "bucket"})
+	storage := &fakeStorage{
+		dirs: map[string][]gcs.Dir{
+			"staged": {
+				{Path: "gs://bucket/exp/staged/2023/06/01/*", Date: day(1)},
+				{Path: "gs://bucket/exp/staged/2023/06/02/*", Date: day(2)},
+			},
+		},
+	}
+	stats := func(rows int64) *bq.LoadStatistics {
+		return &bq.LoadStatistics{LoadStatistics: bigquery.LoadStatistics{OutputRows: rows}, JobID: "job-id"}
+	}
+	failing := bq.StagingCheck{
+		Name: "failing",
+		Check: func(context.Context, *bq.Client, bqiface.Table, *bq.LoadStatistics) error {
+			return errors.New("bad data")
+		},
+	}
+
+	tests := []struct {
+		name       string
+		bq         BQClient
+		staging    *Staging
+		checks     RowChecks
+		stats      *bq.LoadStatistics
+		wantErr    error
+		wantCopied int
+		wantJobID  string
+		violations int
+	}{
+		{
+			name:       "staged",
+			bq:         &stagedBQ{fakeBQ: &fakeBQ{}},
+			staging:    &Staging{},
+			stats:      stats(10),
+			wantCopied: 2,
+			wantJobID:  "copy-job-id",
+		},
+		{
+			name:      "row-check",
+			bq:        &stagedBQ{fakeBQ: &fakeBQ{}},
+			staging:   &Staging{},
+			checks:    RowChecks{MinRows: 11},
+			stats:     stats(10),
+			wantErr:   &bq.CheckError{},
+			wantJobID: "job-id",
+			// Violations of staged loads are only load errors.
+		},
+		{
+			name:      "custom-check",
+			bq:        &stagedBQ{fakeBQ: &fakeBQ{}},
+			staging:   &Staging{Checks: []bq.StagingCheck{failing}},
+			stats:     stats(10),
+			wantErr:   &bq.CheckError{},
+			wantJobID: "job-id",
+		},
+		{
+			name:      "direct",
+			bq:        &stagedBQ{fakeBQ: &fakeBQ{}},
+			checks:    RowChecks{MinRows: 11},
+			stats:     stats(10),
+			wantJobID: "job-id",
+			// Violations of direct loads are flagged after the load.
+			violations: 2,
+		},
+		{
+			name:    "not-staged-loader",
+			bq:      &fakeBQ{},
+			staging: &Staging{},
+			stats:   stats(10),
+			wantErr: errNoStaging,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			switch b := tt.bq.(type) {
+			case *stagedBQ:
+				b.loadStats = tt.stats
+			case *fakeBQ:
+				b.loadStats = tt.stats
+			}
+			sink := &memAudit{}
+			c := NewClient(storage, tt.bq)
+			c.Audit = sink
+			c.Checks = func(*api.Datatype) RowChecks { return tt.checks }
+			c.Staging = func(*api.Datatype) *Staging { return tt.staging }
+			ctx, log := withViolations(context.Background())
+
+			err := c.load(ctx, nil, dt, &LoadOptions{start: "2023/06/01", end: "2023/06/03", period: "custom"})
+			var checkErr *bq.CheckError
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Client.load() error = %v, want nil", err)
+			case errors.As(tt.wantErr, &checkErr) && !errors.As(err, &checkErr):
+				t.Fatalf("Client.load() error = %v, want check error", err)
+			case tt.wantErr == errNoStaging && err != errNoStaging:
+				t.Fatalf("Client.load() error = %v, want %v", err, errNoStaging)
+			}
+			if s, ok := tt.bq.(*stagedBQ); ok && len(s.copied) != tt.wantCopied {
+				t.Errorf("Client.load() copied %v, want %d partitions", s.copied, tt.wantCopied)
+			}
+			if got := len(log.strings()); got != tt.violations {
+				t.Errorf("Client.load() flagged %d violations, want %d", got, tt.violations)
+			}
+			for _, r := range sink.records {
+				if r.JobID != tt.wantJobID {
+					t.Errorf("Client.load() audited job %q, want %q", r.JobID, tt.wantJobID)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_LoadStagedViolation(t *testing.T) {
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "staged-violation", Experiment: "exp", BucketName: "bucket"})
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{dt},
+		dirs: map[string][]gcs.Dir{
+			"staged-violation": {{Path: "gs://bucket/exp/staged-violation/2023/06/01/*", Date: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+	}
+	fbq := &stagedBQ{fakeBQ: &fakeBQ{loadStats: &bq.LoadStatistics{LoadStatistics: bigquery.LoadStatistics{OutputRows: 10}}}}
+	sink := &memAudit{}
+	c := NewClient(storage, fbq)
+	c.Audit = sink
+	c.Checks = func(*api.Datatype) RowChecks { return RowChecks{MinRows: 11} }
+	c.Staging = func(*api.Datatype) *Staging { return &Staging{} }
+
+	rec := httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/?period=daily", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Client.Load() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	// The violation fails the load, and is reported once, as its error.
+	if got := strings.Count(rec.Body.String(), "failed min_rows check"); got != 1 {
+		t.Errorf("Client.Load() body reports the violation %d times, want 1:\n%s", got, rec.Body.String())
+	}
+	var audited int
+	for _, r := range sink.records {
+		audited += strings.Count(r.Error, "failed min_rows check")
+	}
+	if audited != 1 {
+		t.Errorf("Client.Load() audited the violation %d times, want 1", audited)
+	}
+}
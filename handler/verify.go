@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/logging"
+	"github.com/m-lab/autoloader/metrics"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/go/timex"
+)
+
+// Row checks.
+const (
+	CheckMinRows  = "min_rows"
+	CheckDrop     = "drop"
+	CheckManifest = "manifest"
+)
+
+// RowChecks are the expectations on the number of rows loaded to a
+// partition. Zero values disable the checks.
+type RowChecks struct {
+	// MinRows is the minimum number of rows of a partition.
+	MinRows int64
+	// MaxDrop is the largest fraction by which the rows of a partition may
+	// drop below those of the previous day.
+	MaxDrop float64
+	// Manifest requires the rows of a partition to match the lines of its
+	// source directory (see gcs.Dir.Lines), if known.
+	Manifest bool
+}
+
+// Violation describes a loaded partition failing a row check. The load itself
+// succeeded.
+type Violation struct {
+	Datatype  string `json:"datatype"`  // Datatype ID (see api.Datatype.ID).
+	Partition string `json:"partition"` // YYYYMMDD.
+	Check     string `json:"check"`
+	Rows      int64  `json:"rows"`
+	// Expected is the minimum, previous or manifest rows, depending on the
+	// check.
+	Expected int64 `json:"expected"`
+}
+
+// String returns a description of the violation.
+func (v Violation) String() string {
+	var want string
+	switch v.Check {
+	case CheckMinRows:
+		want = fmt.Sprintf("want at least %d", v.Expected)
+	case CheckDrop:
+		want = fmt.Sprintf("previous day had %d", v.Expected)
+	case CheckManifest:
+		want = fmt.Sprintf("source has %d lines", v.Expected)
+	}
+	return fmt.Sprintf("%s partition %s failed %s check: %d rows, %s", v.Datatype, v.Partition, v.Check, v.Rows, want)
+}
+
+// violationLog collects the violations found while handling a request.
+type violationLog struct {
+	mu         sync.Mutex
+	violations []Violation
+}
+
+type violationsKey struct{}
+
+// withViolations returns a context collecting the violations found by the
+// loads using it.
+func withViolations(ctx context.Context) (context.Context, *violationLog) {
+	l := &violationLog{violations: make([]Violation, 0)}
+	return context.WithValue(ctx, violationsKey{}, l), l
+}
+
+func (l *violationLog) add(v Violation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.violations = append(l.violations, v)
+}
+
+// strings returns the descriptions of the violations.
+func (l *violationLog) strings() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msgs := make([]string, 0, len(l.violations))
+	for _, v := range l.violations {
+		msgs = append(msgs, v.String())
+	}
+	return msgs
+}
+
+// dayRows is the number of rows loaded to the partition of a day.
+type dayRows struct {
+	date time.Time
+	rows int64
+}
+
+// verifyRows checks the rows loaded to a partition against the datatype's
+// expectations. Violations are logged, counted and collected in the context's
+// violation log, if any. prev is the previous partition loaded in the same
+// run, if any.
+func (c *Client) verifyRows(ctx context.Context, dt *api.Datatype, dir gcs.Dir, stats *bq.LoadStatistics, prev *dayRows) []Violation {
+	violations := c.checkRows(ctx, dt, dir, stats, prev)
+	l, _ := ctx.Value(violationsKey{}).(*violationLog)
+	for _, v := range violations {
+		logging.FromContext(ctx).Warn("loaded partition failed row check", "check", v.Check,
+			"rows", v.Rows, "expected", v.Expected)
+		metrics.RowCheckViolationsTotal.WithLabelValues(labels(dt, v.Check)...).Inc()
+		if l != nil {
+			l.add(v)
+		}
+	}
+	return violations
+}
+
+// checkRows returns the row checks failed by a partition, without reporting
+// them, so the caller decides whether they fail its load (see
+// Client.stagingChecks) or are flagged (see Client.verifyRows).
+func (c *Client) checkRows(ctx context.Context, dt *api.Datatype, dir gcs.Dir, stats *bq.LoadStatistics, prev *dayRows) []Violation {
+	if c.Checks == nil || stats == nil {
+		return nil
+	}
+	checks := c.Checks(dt)
+	rows := stats.OutputRows
+	partition := dir.Date.Format(timex.YYYYMMDD)
+	violations := make([]Violation, 0)
+	flag := func(check string, expected int64) {
+		violations = append(violations, Violation{
+			Datatype:  dt.ID(),
+			Partition: partition,
+			Check:     check,
+			Rows:      rows,
+			Expected:  expected,
+		})
+	}
+
+	if checks.MinRows > 0 && rows < checks.MinRows {
+		flag(CheckMinRows, checks.MinRows)
+	}
+	if checks.Manifest && dir.Lines != nil && rows != *dir.Lines {
+		flag(CheckManifest, *dir.Lines)
+	}
+	if checks.MaxDrop > 0 {
+		if p, ok := c.previousRows(ctx, dt, dir.Date, prev); ok && float64(rows) < float64(p)*(1-checks.MaxDrop) {
+			flag(CheckDrop, p)
+		}
+	}
+	return violations
+}
+
+// previousRows returns the rows loaded to the partition of the day before
+// date: from the previous partition of the run or, if it is not that day's,
+// from the most recent successful load recorded in the state store.
+func (c *Client) previousRows(ctx context.Context, dt *api.Datatype, date time.Time, prev *dayRows) (int64, bool) {
+	before := date.AddDate(0, 0, -1)
+	if prev != nil && prev.date.Equal(before) {
+		return prev.rows, true
+	}
+	if c.State == nil {
+		return 0, false
+	}
+	l, err := c.State.Latest(ctx, dt.ID(), before.Format(timex.YYYYMMDD))
+	if err != nil || l.Status != state.StatusOK {
+		return 0, false
+	}
+	return l.Rows, true
+}
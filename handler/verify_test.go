@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/m-lab/autoloader/api"
+	"github.com/m-lab/autoloader/bq"
+	"github.com/m-lab/autoloader/gcs"
+	"github.com/m-lab/autoloader/metrics"
+	"github.com/m-lab/autoloader/state"
+	"github.com/m-lab/go/testingx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClient_verifyRows(t *testing.T) {
+	store, err := state.OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	testingx.Must(t, err, "failed to open state store")
+	defer store.Close()
+
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "verified", Experiment: "exp", BucketName: "bucket"})
+	date := time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)
+	testingx.Must(t, store.Put(context.Background(), &state.Load{
+		Datatype: dt.ID(), Partition: "20230601", Status: state.StatusOK, Rows: 100,
+	}), "failed to put load")
+	stats := func(rows int64) *bq.LoadStatistics {
+		return &bq.LoadStatistics{LoadStatistics: bigquery.LoadStatistics{OutputRows: rows}}
+	}
+	lines := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name   string
+		checks *RowChecks
+		store  state.Store
+		dir    gcs.Dir
+		stats  *bq.LoadStatistics
+		prev   *dayRows
+		want   []string // Failed checks.
+	}{
+		{
+			name:  "no-checks",
+			dir:   gcs.Dir{Date: date},
+			stats: stats(0),
+		},
+		{
+			name:   "min-rows",
+			checks: &RowChecks{MinRows: 1},
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(0),
+			want:   []string{CheckMinRows},
+		},
+		{
+			name:   "min-rows-ok",
+			checks: &RowChecks{MinRows: 1},
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(1),
+		},
+		{
+			name:   "manifest",
+			checks: &RowChecks{Manifest: true},
+			dir:    gcs.Dir{Date: date, Lines: lines(10)},
+			stats:  stats(9),
+			want:   []string{CheckManifest},
+		},
+		{
+			name:   "manifest-unknown",
+			checks: &RowChecks{Manifest: true},
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(9),
+		},
+		{
+			name:   "drop-from-run",
+			checks: &RowChecks{MaxDrop: 0.5},
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(40),
+			prev:   &dayRows{date: date.AddDate(0, 0, -1), rows: 100},
+			want:   []string{CheckDrop},
+		},
+		{
+			name:   "drop-from-state",
+			checks: &RowChecks{MaxDrop: 0.5},
+			store:  store,
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(40),
+			prev:   &dayRows{date: date.AddDate(0, 0, -2), rows: 40},
+			want:   []string{CheckDrop},
+		},
+		{
+			name:   "drop-within-limit",
+			checks: &RowChecks{MaxDrop: 0.5},
+			store:  store,
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(60),
+		},
+		{
+			name:   "drop-no-previous",
+			checks: &RowChecks{MaxDrop: 0.5},
+			dir:    gcs.Dir{Date: date},
+			stats:  stats(1),
+		},
+		{
+			name:   "all",
+			checks: &RowChecks{MinRows: 1, MaxDrop: 0.5, Manifest: true},
+			store:  store,
+			dir:    gcs.Dir{Date: date, Lines: lines(10)},
+			stats:  stats(0),
+			want:   []string{CheckMinRows, CheckManifest, CheckDrop},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(&fakeStorage{}, &fakeBQ{})
+			c.State = tt.store
+			if tt.checks != nil {
+				c.Checks = func(*api.Datatype) RowChecks { return *tt.checks }
+			}
+			ctx, log := withViolations(context.Background())
+			var got []string
+			for _, v := range c.verifyRows(ctx, dt, tt.dir, tt.stats, tt.prev) {
+				got = append(got, v.Check)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Client.verifyRows() mismatch (-got +want):\n%s", diff)
+			}
+			if len(log.strings()) != len(tt.want) {
+				t.Errorf("Client.verifyRows() logged %v, want %d violations", log.strings(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestClient_LoadViolations(t *testing.T) {
+	dt := api.NewMlabDatatype(api.DatatypeOpts{Name: "empty", Experiment: "exp", BucketName: "bucket"})
+	storage := &fakeStorage{
+		datatypes: []*api.Datatype{dt},
+		dirs: map[string][]gcs.Dir{
+			"empty": {{Path: "fake-dir-path", Date: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+	}
+	fbq := &fakeBQ{
+		loadStats: &bq.LoadStatistics{},
+	}
+	c := NewClient(storage, fbq)
+	c.Checks = func(*api.Datatype) RowChecks { return RowChecks{MinRows: 1} }
+	counter := metrics.RowCheckViolationsTotal.WithLabelValues(labels(dt, CheckMinRows)...)
+	before := testutil.ToFloat64(counter)
+
+	rec := httptest.NewRecorder()
+	c.Load(rec, httptest.NewRequest(http.MethodGet, "/v2/load?period=daily", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Client.Load() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "partition 20230601 failed min_rows check: 0 rows") {
+		t.Errorf("Client.Load() body = %q, want row check violation", rec.Body.String())
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("Client.Load() violations metric = %v, want 1", got)
+	}
+	runs := c.runs.list(rec.Header().Get(RunIDHeader))
+	if len(runs) != 1 || len(runs[0].Violations) != 1 || runs[0].Status != RunOK {
+		t.Errorf("Client.Load() run = %+v, want OK run with 1 violation", runs)
+	}
+}
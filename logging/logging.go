@@ -0,0 +1,101 @@
+// Package logging provides structured, leveled logging with per-request
+// correlation. Loggers are carried in the context, so every log line written
+// while handling a request includes its run ID and the fields of the datatype
+// being processed.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/m-lab/autoloader/api"
+)
+
+// Consistent field keys used across the autoloader logs.
+const (
+	RunIDKey        = "run_id"
+	ExperimentKey   = "experiment"
+	DatatypeKey     = "datatype"
+	OrganizationKey = "organization"
+	BucketKey       = "bucket"
+	DatasetKey      = "dataset"
+	TableKey        = "table"
+	PartitionKey    = "partition"
+	JobIDKey        = "job_id"
+	PathKey         = "path"
+	ErrorKey        = "error"
+)
+
+type contextKey struct{}
+
+// Setup configures the default logger to write JSON lines to w, dropping
+// entries below the given level ("debug", "info", "warn" or "error").
+func Setup(w io.Writer, level string) error {
+	var l slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		l = slog.LevelDebug
+	case "info", "":
+		l = slog.LevelInfo
+	case "warn":
+		l = slog.LevelWarn
+	case "error":
+		l = slog.LevelError
+	default:
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: l})))
+	return nil
+}
+
+// FromContext returns the logger carried by the context, or the default
+// logger if there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// NewContext returns a copy of the context carrying the given logger.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// With returns a copy of the context whose logger includes the given fields.
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+// WithRunID returns a copy of the context whose logger includes the run ID.
+func WithRunID(ctx context.Context, id string) context.Context {
+	return With(ctx, RunIDKey, id)
+}
+
+// NewRunID returns a new random identifier for a run.
+func NewRunID() string {
+	b := make([]byte, 8)
+	// crypto/rand.Read never returns an error on supported platforms.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Datatype returns the log fields identifying a datatype and, if its naming
+// conventions are known, its BigQuery table.
+func Datatype(dt *api.Datatype) []any {
+	args := []any{
+		ExperimentKey, dt.Experiment,
+		DatatypeKey, dt.Name,
+		OrganizationKey, dt.Organization,
+		BucketKey, dt.BucketName,
+	}
+	if dt.Namer == nil {
+		return args
+	}
+	return append(args, DatasetKey, dt.Dataset(), TableKey, dt.Table())
+}
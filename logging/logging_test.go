@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/m-lab/autoloader/api"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		name     string
+		level    string
+		wantLogs int
+		wantErr  bool
+	}{
+		{
+			name:     "debug",
+			level:    "debug",
+			wantLogs: 4,
+		},
+		{
+			name:     "default",
+			level:    "",
+			wantLogs: 3,
+		},
+		{
+			name:     "warn",
+			level:    "WARN",
+			wantLogs: 2,
+		},
+		{
+			name:     "error",
+			level:    "error",
+			wantLogs: 1,
+		},
+		{
+			name:    "invalid",
+			level:   "verbose",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := Setup(buf, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			slog.Debug("debug")
+			slog.Info("info")
+			slog.Warn("warn")
+			slog.Error("error")
+
+			if got := bytes.Count(buf.Bytes(), []byte("\n")); got != tt.wantLogs {
+				t.Errorf("Setup() logged %d lines, want %d", got, tt.wantLogs)
+			}
+		})
+	}
+}
+
+func TestWithRunID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := NewContext(context.Background(), slog.New(slog.NewJSONHandler(buf, nil)))
+	ctx = WithRunID(ctx, "run-id")
+	dt := api.NewMlabDatatype(api.DatatypeOpts{
+		Name:         "datatype",
+		Experiment:   "experiment",
+		Organization: "organization",
+	})
+	ctx = With(ctx, Datatype(dt)...)
+
+	FromContext(ctx).Info("message")
+
+	got := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("FromContext() logged invalid JSON: %v", err)
+	}
+	want := map[string]string{
+		RunIDKey:        "run-id",
+		ExperimentKey:   "experiment",
+		DatatypeKey:     "datatype",
+		OrganizationKey: "organization",
+		DatasetKey:      dt.Dataset(),
+		TableKey:        dt.Table(),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("FromContext() field %s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestFromContext_Default(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Errorf("FromContext() = %v, want default logger", got)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	if len(a) != 16 {
+		t.Errorf("NewRunID() = %q, want 16 characters", a)
+	}
+	if a == b {
+		t.Errorf("NewRunID() returned the same ID twice: %q", a)
+	}
+}
+
+func TestDatatype(t *testing.T) {
+	opts := api.DatatypeOpts{Name: "datatype", Experiment: "experiment"}
+
+	tests := []struct {
+		name string
+		dt   *api.Datatype
+		want int
+	}{
+		{
+			name: "namer",
+			dt:   api.NewMlabDatatype(opts),
+			want: 12,
+		},
+		{
+			name: "no-namer",
+			dt:   &api.Datatype{DatatypeOpts: opts},
+			want: 8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Datatype(tt.dt); len(got) != tt.want {
+				t.Errorf("Datatype() = %v, want %d elements", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ var (
 				10000, 21500, 46400,
 			},
 		},
-		[]string{"experiment", "datatype", "period", "status"},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period", "status"},
 	)
 
 	// BigQueryOperationsTotal counts the number of create, update, and load operations
@@ -29,7 +29,7 @@ var (
 			Name: "autoloader_bigquery_operations_total",
 			Help: "The number of create, update, and load operations that the autoloader performs.",
 		},
-		[]string{"experiment", "datatype", "operation", "status"},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "operation", "status"},
 	)
 
 	// LoadedDates keeps track of the most recently loaded date for each datatype
@@ -39,6 +39,155 @@ var (
 			Name: "autoloader_loaded_dates",
 			Help: "Most recently loaded date for each datatype and job period type.",
 		},
-		[]string{"experiment", "datatype", "period", "status"},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period", "status"},
+	)
+
+	// LoadInputFilesTotal counts the number of source files read by load jobs.
+	LoadInputFilesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_load_input_files_total",
+			Help: "The number of source files read by load jobs.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LoadInputBytesTotal counts the number of source bytes read by load jobs.
+	LoadInputBytesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_load_input_bytes_total",
+			Help: "The number of source bytes read by load jobs.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LoadOutputRowsTotal counts the number of rows written to BigQuery by load jobs.
+	LoadOutputRowsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_load_output_rows_total",
+			Help: "The number of rows written to BigQuery by load jobs.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LoadBadRecordsTotal counts the number of records skipped by load jobs
+	// because they were invalid.
+	LoadBadRecordsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_load_bad_records_total",
+			Help: "The number of invalid records skipped by load jobs.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LoadOutputRows keeps track of the number of rows written to the most
+	// recently loaded partition for each datatype and job period type.
+	LoadOutputRows = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoloader_load_output_rows",
+			Help: "Number of rows written to the most recently loaded partition.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// PartitionLoadDuration is a histogram of the latency of loading a single
+	// partition.
+	PartitionLoadDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "autoloader_partition_load_duration",
+			Help: "A histogram of load latency for each partition.",
+			Buckets: []float64{
+				1, 2.15, 4.64,
+				10, 21.5, 46.4,
+				100, 215, 464,
+				1000, 2150, 4640,
+			},
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period", "status"},
+	)
+
+	// SourceUpdatedTime keeps track of the Unix time of the newest source object
+	// in GCS for each datatype and job period type.
+	SourceUpdatedTime = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoloader_source_updated_time",
+			Help: "Unix time of the newest source object in GCS for each datatype and job period type.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LastLoadTime keeps track of the Unix time of the last successful load of
+	// the newest partition of a run, for each datatype and job period type.
+	// Older partitions loaded by the same run (e.g., by backfills) are ignored.
+	LastLoadTime = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoloader_last_load_time",
+			Help: "Unix time of the last successful load of the newest partition of a run for each datatype and job period type.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// LoadLag keeps track of the time between the newest source object of a
+	// partition being updated in GCS and the partition being loaded. Like
+	// LastLoadTime, it is only set by the newest partition of a run.
+	LoadLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoloader_load_lag_seconds",
+			Help: "Seconds between the newest source object of the newest partition of a run and its successful load.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "period"},
+	)
+
+	// DiscoveryErrorsTotal counts the number of schema files (or prefixes) that
+	// could not be read or interpreted while discovering datatypes. The
+	// organization is empty if the path does not name one (e.g., v1 paths or
+	// out-of-band v2 schemas).
+	DiscoveryErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_discovery_errors_total",
+			Help: "The number of schema files or prefixes that failed datatype discovery. The organization is empty if the path does not name one.",
+		},
+		[]string{"organization", "version", "bucket"},
+	)
+
+	// NamingCollisionsTotal counts the number of datatypes refused because
+	// their BigQuery table or view names collide with another datatype.
+	NamingCollisionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_naming_collisions_total",
+			Help: "The number of datatypes refused due to colliding BigQuery names.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "kind"},
+	)
+
+	// ConfigReloadsTotal counts the attempts to reload the configuration.
+	// Reloads apply to the whole deployment, so they have no organization,
+	// version or bucket labels.
+	ConfigReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_config_reloads_total",
+			Help: "The number of configuration reloads. Reloads apply to every bucket, organization and version.",
+		},
+		[]string{"trigger", "status"},
+	)
+
+	// RowCheckViolationsTotal counts the loaded partitions failing a row
+	// check (e.g., with fewer rows than expected).
+	RowCheckViolationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_row_check_violations_total",
+			Help: "The number of loaded partitions failing a row check.",
+		},
+		[]string{"experiment", "datatype", "organization", "version", "bucket", "check"},
+	)
+
+	// AuditWriteErrorsTotal counts the audit records that could not be written.
+	// Audit records do not include the autoload version, so there is no
+	// version label.
+	AuditWriteErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoloader_audit_write_errors_total",
+			Help: "The number of audit records that failed to be written. Records do not include the autoload version.",
+		},
+		[]string{"action", "organization", "bucket"},
 	)
 )
@@ -3,7 +3,21 @@ package metrics
 import "testing"
 
 func TestLintMetrics(t *testing.T) {
-	AutoloadDuration.WithLabelValues("experiment", "datatype", "period", "status")
-	BigQueryOperationsTotal.WithLabelValues("experiment", "datatype", "operation", "status")
-	LoadedDates.WithLabelValues("experiment", "datatype", "period", "status")
+	AutoloadDuration.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period", "status")
+	BigQueryOperationsTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "operation", "status")
+	LoadedDates.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period", "status")
+	LoadInputFilesTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LoadInputBytesTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LoadOutputRowsTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LoadBadRecordsTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LoadOutputRows.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	PartitionLoadDuration.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period", "status")
+	SourceUpdatedTime.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LastLoadTime.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	LoadLag.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "period")
+	DiscoveryErrorsTotal.WithLabelValues("organization", "version", "bucket")
+	ConfigReloadsTotal.WithLabelValues("trigger", "status")
+	AuditWriteErrorsTotal.WithLabelValues("action", "organization", "bucket")
+	RowCheckViolationsTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "check")
+	NamingCollisionsTotal.WithLabelValues("experiment", "datatype", "organization", "version", "bucket", "kind")
 }
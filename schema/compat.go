@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Compatible checks that a table created with the previous schema can be
+// updated in place to the next one, which is what the autoloader does when a
+// schema file changes. BigQuery only allows adding NULLABLE or REPEATED fields
+// and relaxing REQUIRED fields to NULLABLE.
+// The returned error joins one *FieldError per incompatible change.
+func Compatible(prev, next bigquery.Schema) error {
+	return errors.Join(compatibleFields(prev, next, "")...)
+}
+
+func compatibleFields(prev, next bigquery.Schema, parent string) []error {
+	errs := make([]error, 0)
+
+	fields := make(map[string]*bigquery.FieldSchema)
+	for _, f := range next {
+		fields[strings.ToLower(f.Name)] = f
+	}
+	seen := make(map[string]bool)
+
+	for _, old := range prev {
+		p := join(parent, old.Name)
+		f, ok := fields[strings.ToLower(old.Name)]
+		if !ok {
+			errs = append(errs, &FieldError{Field: p, Msg: "field was removed"})
+			continue
+		}
+		seen[strings.ToLower(old.Name)] = true
+
+		switch {
+		case f.Type != old.Type:
+			errs = append(errs, &FieldError{Field: p,
+				Msg: fmt.Sprintf("type changed from %s to %s", old.Type, f.Type)})
+		case f.Repeated != old.Repeated:
+			errs = append(errs, &FieldError{Field: p,
+				Msg: fmt.Sprintf("mode changed from %s to %s", mode(old), mode(f))})
+		case f.Required && !old.Required:
+			errs = append(errs, &FieldError{Field: p,
+				Msg: fmt.Sprintf("mode changed from %s to REQUIRED", mode(old))})
+		case f.Type == bigquery.RecordFieldType:
+			errs = append(errs, compatibleFields(old.Schema, f.Schema, p)...)
+		}
+	}
+
+	for _, f := range next {
+		if !seen[strings.ToLower(f.Name)] && f.Required {
+			errs = append(errs, &FieldError{Field: join(parent, f.Name),
+				Msg: "new fields cannot be REQUIRED"})
+		}
+	}
+
+	return errs
+}
+
+func mode(f *bigquery.FieldSchema) string {
+	switch {
+	case f.Repeated:
+		return "REPEATED"
+	case f.Required:
+		return "REQUIRED"
+	default:
+		return "NULLABLE"
+	}
+}
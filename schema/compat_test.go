@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestCompatible(t *testing.T) {
+	prev := `[
+		{"name": "date", "type": "DATE"},
+		{"name": "id", "type": "STRING", "mode": "REQUIRED"},
+		{"name": "raw", "type": "RECORD", "fields": [{"name": "rtt", "type": "FLOAT"}]}
+	]`
+
+	tests := []struct {
+		name       string
+		next       string
+		wantFields []string
+	}{
+		{
+			name: "unchanged",
+			next: prev,
+		},
+		{
+			name: "add-nullable-and-relax",
+			next: `[
+				{"name": "date", "type": "DATE"},
+				{"name": "ID", "type": "STRING"},
+				{"name": "raw", "type": "RECORD", "fields": [
+					{"name": "rtt", "type": "FLOAT"},
+					{"name": "loss", "type": "FLOAT", "mode": "REPEATED"}
+				]}
+			]`,
+		},
+		{
+			name: "incompatible",
+			next: `[
+				{"name": "date", "type": "TIMESTAMP"},
+				{"name": "id", "type": "STRING", "mode": "REPEATED"},
+				{"name": "raw", "type": "RECORD", "fields": [
+					{"name": "rtt", "type": "FLOAT", "mode": "REQUIRED"},
+					{"name": "loss", "type": "FLOAT", "mode": "REQUIRED"}
+				]}
+			]`,
+			wantFields: []string{"date", "id", "raw.rtt", "raw.loss"},
+		},
+		{
+			name:       "removed",
+			next:       `[{"name": "date", "type": "DATE"}, {"name": "id", "type": "STRING"}]`,
+			wantFields: []string{"raw"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := bigquery.SchemaFromJSON([]byte(prev))
+			if err != nil {
+				t.Fatalf("SchemaFromJSON() error = %v", err)
+			}
+			n, err := bigquery.SchemaFromJSON([]byte(tt.next))
+			if err != nil {
+				t.Fatalf("SchemaFromJSON() error = %v", err)
+			}
+
+			err = Compatible(p, n)
+			if got := fields(err); strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("Compatible() error fields = %v, want %v (error = %v)", got, tt.wantFields, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Change describes a difference between two versions of a schema.
+type Change struct {
+	Field string // Dot-separated path of the field.
+	Op    string // "+" (added), "-" (removed) or "~" (modified).
+	Prev  string // Type and mode in the previous schema, if any.
+	Next  string // Type and mode in the next schema, if any.
+}
+
+// String returns the change in a diff-like format.
+func (c Change) String() string {
+	switch c.Op {
+	case "+":
+		return fmt.Sprintf("+ %s %s", c.Field, c.Next)
+	case "-":
+		return fmt.Sprintf("- %s %s", c.Field, c.Prev)
+	default:
+		return fmt.Sprintf("~ %s %s -> %s", c.Field, c.Prev, c.Next)
+	}
+}
+
+// Diff returns the fields that were added, removed or modified between two
+// versions of a schema, in schema order.
+func Diff(prev, next bigquery.Schema) []Change {
+	return diffFields(prev, next, "")
+}
+
+func diffFields(prev, next bigquery.Schema, parent string) []Change {
+	changes := make([]Change, 0)
+
+	fields := make(map[string]*bigquery.FieldSchema)
+	for _, f := range prev {
+		fields[strings.ToLower(f.Name)] = f
+	}
+	seen := make(map[string]bool)
+
+	for _, f := range next {
+		p := join(parent, f.Name)
+		old, ok := fields[strings.ToLower(f.Name)]
+		if !ok {
+			changes = append(changes, Change{Field: p, Op: "+", Next: describe(f)})
+			continue
+		}
+		seen[strings.ToLower(f.Name)] = true
+		if describe(old) != describe(f) {
+			changes = append(changes, Change{Field: p, Op: "~", Prev: describe(old), Next: describe(f)})
+			continue
+		}
+		if f.Type == bigquery.RecordFieldType {
+			changes = append(changes, diffFields(old.Schema, f.Schema, p)...)
+		}
+	}
+
+	for _, f := range prev {
+		if !seen[strings.ToLower(f.Name)] {
+			changes = append(changes, Change{Field: join(parent, f.Name), Op: "-", Prev: describe(f)})
+		}
+	}
+
+	return changes
+}
+
+// describe returns the type and mode of a field (e.g., "STRING NULLABLE").
+func describe(f *bigquery.FieldSchema) string {
+	return fmt.Sprintf("%s %s", f.Type, mode(f))
+}
@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestDiff(t *testing.T) {
+	prev, err := bigquery.SchemaFromJSON([]byte(`[
+		{"name": "date", "type": "DATE"},
+		{"name": "id", "type": "STRING", "mode": "REQUIRED"},
+		{"name": "old", "type": "STRING"},
+		{"name": "raw", "type": "RECORD", "fields": [{"name": "rtt", "type": "FLOAT"}]}
+	]`))
+	if err != nil {
+		t.Fatalf("SchemaFromJSON() error = %v", err)
+	}
+	next, err := bigquery.SchemaFromJSON([]byte(`[
+		{"name": "date", "type": "DATE"},
+		{"name": "id", "type": "STRING"},
+		{"name": "raw", "type": "RECORD", "fields": [
+			{"name": "rtt", "type": "FLOAT"},
+			{"name": "loss", "type": "FLOAT"}
+		]}
+	]`))
+	if err != nil {
+		t.Fatalf("SchemaFromJSON() error = %v", err)
+	}
+
+	want := []string{
+		"~ id STRING REQUIRED -> STRING NULLABLE",
+		"+ raw.loss FLOAT NULLABLE",
+		"- old STRING NULLABLE",
+	}
+	got := []string{}
+	for _, c := range Diff(prev, next) {
+		got = append(got, c.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+	if d := Diff(prev, prev); len(d) != 0 {
+		t.Errorf("Diff() = %v, want no changes", d)
+	}
+}
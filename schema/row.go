@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// ValidateRow checks that a JSON row (i.e., a single line of a newline
+// delimited JSON file) can be loaded into a table with the given schema.
+// The autoloader does not ignore unknown values, so fields not present in the
+// schema are reported as errors.
+// The returned error joins one *FieldError per invalid value.
+func ValidateRow(s bigquery.Schema, line []byte) error {
+	var row map[string]any
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&row); err != nil {
+		return &FieldError{Msg: fmt.Sprintf("invalid JSON row: %v", err)}
+	}
+	return errors.Join(validateRecord(s, row, "")...)
+}
+
+func validateRecord(s bigquery.Schema, row map[string]any, parent string) []error {
+	errs := make([]error, 0)
+
+	// Column names are case-insensitive.
+	fields := make(map[string]*bigquery.FieldSchema)
+	for _, f := range s {
+		fields[strings.ToLower(f.Name)] = f
+	}
+	values := make(map[string]any)
+	for k, v := range row {
+		if _, ok := fields[strings.ToLower(k)]; !ok {
+			errs = append(errs, &FieldError{Field: join(parent, k), Msg: "field is not in the schema"})
+			continue
+		}
+		values[strings.ToLower(k)] = v
+	}
+
+	for _, f := range s {
+		p := join(parent, f.Name)
+		v := values[strings.ToLower(f.Name)]
+		if v == nil {
+			if f.Required {
+				errs = append(errs, &FieldError{Field: p, Msg: "missing value for REQUIRED field"})
+			}
+			continue
+		}
+		if !f.Repeated {
+			errs = append(errs, validateValue(f, v, p)...)
+			continue
+		}
+		arr, ok := v.([]any)
+		if !ok {
+			errs = append(errs, &FieldError{Field: p, Msg: "REPEATED field must be an array"})
+			continue
+		}
+		for i, e := range arr {
+			errs = append(errs, validateValue(f, e, fmt.Sprintf("%s[%d]", p, i))...)
+		}
+	}
+
+	return errs
+}
+
+func validateValue(f *bigquery.FieldSchema, v any, p string) []error {
+	if f.Type == bigquery.RecordFieldType {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []error{&FieldError{Field: p, Msg: "RECORD field must be an object"}}
+		}
+		return validateRecord(f.Schema, obj, p)
+	}
+	if !validScalar(f.Type, v) {
+		return []error{&FieldError{Field: p, Msg: fmt.Sprintf("invalid %s value %v", f.Type, v)}}
+	}
+	return nil
+}
+
+// validScalar reports whether a decoded JSON value can be loaded into a
+// column of the given type.
+func validScalar(t bigquery.FieldType, v any) bool {
+	s, isString := v.(string)
+	n, isNumber := v.(json.Number)
+
+	switch t {
+	case bigquery.StringFieldType:
+		return isString || isNumber
+	case bigquery.BytesFieldType:
+		_, err := base64.StdEncoding.DecodeString(s)
+		return isString && err == nil
+	case bigquery.IntegerFieldType:
+		if isNumber {
+			s = n.String()
+		}
+		_, err := strconv.ParseInt(s, 10, 64)
+		return (isString || isNumber) && err == nil
+	case bigquery.FloatFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		if isNumber {
+			return true
+		}
+		_, err := strconv.ParseFloat(s, 64)
+		return isString && err == nil
+	case bigquery.BooleanFieldType:
+		_, isBool := v.(bool)
+		return isBool || (isString && (strings.EqualFold(s, "true") || strings.EqualFold(s, "false")))
+	case bigquery.DateFieldType:
+		_, err := time.Parse(time.DateOnly, s)
+		return isString && err == nil
+	case bigquery.TimestampFieldType:
+		return isString || isNumber
+	case bigquery.DateTimeFieldType, bigquery.TimeFieldType, bigquery.GeographyFieldType:
+		return isString
+	default:
+		// JSON, INTERVAL and RANGE values are checked by BigQuery.
+		return true
+	}
+}
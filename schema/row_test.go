@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRow(t *testing.T) {
+	s, err := Parse([]byte(`[
+		{"name": "date", "type": "DATE"},
+		{"name": "id", "type": "STRING", "mode": "REQUIRED"},
+		{"name": "count", "type": "INTEGER"},
+		{"name": "ok", "type": "BOOLEAN"},
+		{"name": "tags", "type": "STRING", "mode": "REPEATED"},
+		{"name": "raw", "type": "RECORD", "fields": [{"name": "rtt", "type": "FLOAT"}]}
+	]`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		row        string
+		wantFields []string
+	}{
+		{
+			name: "success",
+			row:  `{"date": "2023-03-06", "id": "a", "count": 3, "ok": true, "tags": ["x"], "raw": {"rtt": 1.5}}`,
+		},
+		{
+			name: "success-nulls-and-strings",
+			row:  `{"date": null, "ID": "a", "count": "3", "ok": "false", "raw": null}`,
+		},
+		{
+			name:       "invalid-json",
+			row:        `{"date": `,
+			wantFields: []string{""},
+		},
+		{
+			name:       "missing-required",
+			row:        `{"date": "2023-03-06"}`,
+			wantFields: []string{"id"},
+		},
+		{
+			name:       "unknown-field",
+			row:        `{"id": "a", "raw": {"rtt": 1, "extra": 2}}`,
+			wantFields: []string{"raw.extra"},
+		},
+		{
+			name:       "invalid-values",
+			row:        `{"date": "03/06/2023", "id": "a", "count": 1.5, "ok": 1, "tags": ["x", 1, {}], "raw": []}`,
+			wantFields: []string{"date", "count", "ok", "tags[2]", "raw"},
+		},
+		{
+			name:       "repeated-not-array",
+			row:        `{"id": "a", "tags": "x"}`,
+			wantFields: []string{"tags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRow(s, []byte(tt.row))
+			if got := fields(err); strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("ValidateRow() error fields = %v, want %v (error = %v)", got, tt.wantFields, err)
+			}
+		})
+	}
+}
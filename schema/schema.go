@@ -0,0 +1,165 @@
+// Package schema validates BigQuery table schemas against the rules the
+// autoloader relies on to create, update and load tables.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const (
+	// PartitionField is the name of the field used to partition the tables.
+	PartitionField = "date"
+	// MaxDepth is the maximum nesting depth of RECORD fields supported by
+	// BigQuery.
+	MaxDepth = 15
+	// maxNameLength is the maximum length of a field name.
+	maxNameLength = 300
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// reservedPrefixes cannot be used at the beginning of a field name.
+	reservedPrefixes = []string{"_table_", "_file_", "_partition", "_row_timestamp", "__root__", "_colidentifier"}
+)
+
+// FieldError describes a field that breaks a validation rule.
+type FieldError struct {
+	Field string // Dot-separated path of the field (e.g., "raw.client").
+	Msg   string // Description of the rule that was broken.
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return "schema: " + e.Msg
+	}
+	return fmt.Sprintf("schema: field %q: %s", e.Field, e.Msg)
+}
+
+// Parse parses a JSON schema file and validates it. It returns the parsed
+// schema along with the validation errors, if any.
+func Parse(data []byte) (bigquery.Schema, error) {
+	s, err := bigquery.SchemaFromJSON(data)
+	if err != nil {
+		return nil, &FieldError{Msg: fmt.Sprintf("invalid JSON schema: %v", err)}
+	}
+	return s, Validate(s)
+}
+
+// ParseUnpartitioned is like Parse, for the schemas of tables that are not
+// partitioned (see ValidateUnpartitioned).
+func ParseUnpartitioned(data []byte) (bigquery.Schema, error) {
+	s, err := bigquery.SchemaFromJSON(data)
+	if err != nil {
+		return nil, &FieldError{Msg: fmt.Sprintf("invalid JSON schema: %v", err)}
+	}
+	return s, ValidateUnpartitioned(s)
+}
+
+// Validate checks that a schema follows the autoloader rules:
+//   - it has a non-repeated PartitionField of type DATE at the top level,
+//   - field names are valid BigQuery column names,
+//   - field names are unique (case-insensitive) within a record,
+//   - RECORD fields are nested at most MaxDepth levels and have subfields.
+//
+// The returned error joins one *FieldError per broken rule.
+func Validate(s bigquery.Schema) error {
+	return validate(s, true)
+}
+
+// ValidateUnpartitioned is like Validate, for the schemas of tables that are
+// not partitioned (e.g., tables replaced as a whole): the PartitionField is
+// optional, but it must still be valid if present.
+func ValidateUnpartitioned(s bigquery.Schema) error {
+	return validate(s, false)
+}
+
+func validate(s bigquery.Schema, partitioned bool) error {
+	errs := validateFields(s, "", 1)
+
+	var date *bigquery.FieldSchema
+	for _, f := range s {
+		if f.Name == PartitionField {
+			date = f
+		}
+	}
+	switch {
+	case date == nil && !partitioned:
+	case date == nil:
+		errs = append(errs, &FieldError{Field: PartitionField,
+			Msg: "missing required partition field (add {\"name\": \"date\", \"type\": \"DATE\"})"})
+	case date.Type != bigquery.DateFieldType:
+		errs = append(errs, &FieldError{Field: PartitionField,
+			Msg: fmt.Sprintf("partition field must be of type DATE, not %s", date.Type)})
+	case date.Repeated:
+		errs = append(errs, &FieldError{Field: PartitionField,
+			Msg: "partition field cannot be REPEATED"})
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateFields(s bigquery.Schema, parent string, depth int) []error {
+	errs := make([]error, 0)
+	names := make(map[string]string)
+
+	for _, f := range s {
+		p := join(parent, f.Name)
+
+		if err := validateName(f.Name); err != "" {
+			errs = append(errs, &FieldError{Field: p, Msg: err})
+		}
+		if prev, ok := names[strings.ToLower(f.Name)]; ok {
+			errs = append(errs, &FieldError{Field: p,
+				Msg: fmt.Sprintf("duplicate field name (conflicts with %q)", join(parent, prev))})
+		}
+		names[strings.ToLower(f.Name)] = f.Name
+
+		if f.Type != bigquery.RecordFieldType {
+			continue
+		}
+		if depth >= MaxDepth {
+			errs = append(errs, &FieldError{Field: p,
+				Msg: fmt.Sprintf("records cannot be nested more than %d levels", MaxDepth)})
+			continue
+		}
+		if len(f.Schema) == 0 {
+			errs = append(errs, &FieldError{Field: p, Msg: "RECORD field must have at least one subfield"})
+			continue
+		}
+		errs = append(errs, validateFields(f.Schema, p, depth+1)...)
+	}
+
+	return errs
+}
+
+// validateName returns a description of what is wrong with a field name, or
+// an empty string if the name is valid.
+func validateName(name string) string {
+	switch {
+	case name == "":
+		return "field name cannot be empty"
+	case len(name) > maxNameLength:
+		return fmt.Sprintf("field name is longer than %d characters", maxNameLength)
+	case !namePattern.MatchString(name):
+		return "field name must contain only letters, numbers and underscores, and start with a letter or underscore"
+	}
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			return fmt.Sprintf("field name cannot start with reserved prefix %q", strings.ToUpper(prefix))
+		}
+	}
+	return ""
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	nested := `{"name": "r", "type": "RECORD", "fields": [%s]}`
+	deep := `{"name": "leaf", "type": "STRING"}`
+	for i := 0; i < MaxDepth; i++ {
+		deep = strings.Replace(nested, "%s", deep, 1)
+	}
+
+	tests := []struct {
+		name          string
+		schema        string
+		unpartitioned bool
+		wantFields    []string
+	}{
+		{
+			name: "success",
+			schema: `[
+				{"name": "date", "type": "DATE"},
+				{"name": "id", "type": "STRING"},
+				{"name": "raw", "type": "RECORD", "fields": [{"name": "id", "type": "INTEGER"}]}
+			]`,
+		},
+		{
+			name:       "invalid-json",
+			schema:     `{`,
+			wantFields: []string{""},
+		},
+		{
+			name:       "missing-date",
+			schema:     `[{"name": "id", "type": "STRING"}]`,
+			wantFields: []string{"date"},
+		},
+		{
+			name:          "unpartitioned-missing-date",
+			schema:        `[{"name": "id", "type": "STRING"}]`,
+			unpartitioned: true,
+		},
+		{
+			name:          "unpartitioned-wrong-date-type",
+			schema:        `[{"name": "date", "type": "TIMESTAMP"}]`,
+			unpartitioned: true,
+			wantFields:    []string{"date"},
+		},
+		{
+			name:       "wrong-date-type",
+			schema:     `[{"name": "date", "type": "TIMESTAMP"}]`,
+			wantFields: []string{"date"},
+		},
+		{
+			name:       "repeated-date",
+			schema:     `[{"name": "date", "type": "DATE", "mode": "REPEATED"}]`,
+			wantFields: []string{"date"},
+		},
+		{
+			name: "duplicate-names",
+			schema: `[
+				{"name": "date", "type": "DATE"},
+				{"name": "id", "type": "STRING"},
+				{"name": "ID", "type": "STRING"}
+			]`,
+			wantFields: []string{"ID"},
+		},
+		{
+			name: "invalid-names",
+			schema: `[
+				{"name": "date", "type": "DATE"},
+				{"name": "raw", "type": "RECORD", "fields": [{"name": "a-b", "type": "STRING"}]},
+				{"name": "_PARTITIONTIME", "type": "TIMESTAMP"},
+				{"name": "1st", "type": "STRING"}
+			]`,
+			wantFields: []string{"raw.a-b", "_PARTITIONTIME", "1st"},
+		},
+		{
+			name: "empty-record",
+			schema: `[
+				{"name": "date", "type": "DATE"},
+				{"name": "raw", "type": "RECORD"}
+			]`,
+			wantFields: []string{"raw"},
+		},
+		{
+			name:       "too-deep",
+			schema:     `[{"name": "date", "type": "DATE"}, ` + deep + `]`,
+			wantFields: []string{"r" + strings.Repeat(".r", MaxDepth-1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := Parse
+			if tt.unpartitioned {
+				parse = ParseUnpartitioned
+			}
+			_, err := parse([]byte(tt.schema))
+			if (err != nil) != (len(tt.wantFields) != 0) {
+				t.Fatalf("Parse() error = %v, want fields %v", err, tt.wantFields)
+			}
+
+			if got := fields(err); strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("Parse() error fields = %v, want %v (error = %v)", got, tt.wantFields, err)
+			}
+		})
+	}
+}
+
+// fields returns the fields of the *FieldErrors in err.
+func fields(err error) []string {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	got := []string{}
+	for _, e := range errs {
+		var fe *FieldError
+		if errors.As(e, &fe) {
+			got = append(got, fe.Field)
+		}
+	}
+	return got
+}
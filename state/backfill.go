@@ -0,0 +1,182 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backfill statuses.
+const (
+	BackfillRunning   = "running"
+	BackfillFailed    = "failed"
+	BackfillCancelled = "cancelled"
+
+	// backfillDeleted marks the deletion of a checkpoint in BigQueryStore.
+	backfillDeleted = "deleted"
+)
+
+// Backfill is the checkpoint of a load of the complete history of a datatype.
+// A backfill that did not complete resumes from its Next partition.
+type Backfill struct {
+	Datatype     string `json:"datatype" bigquery:"datatype"` // Datatype ID (see api.Datatype.ID).
+	Experiment   string `json:"experiment" bigquery:"experiment"`
+	Name         string `json:"name" bigquery:"name"`
+	Organization string `json:"organization,omitempty" bigquery:"organization"`
+	RunID        string `json:"run_id,omitempty" bigquery:"run_id"`
+	Start        string `json:"start" bigquery:"start"` // Inclusive start of the backfill (YYYY/MM/DD).
+	// Next is the first partition (YYYY/MM/DD) not loaded successfully yet.
+	Next   string `json:"next" bigquery:"next"`
+	Loaded int    `json:"loaded" bigquery:"loaded"` // Partitions loaded so far.
+	Status string `json:"status" bigquery:"status"`
+	Error  string `json:"error,omitempty" bigquery:"error"`
+	// Attempts is the number of runs of the backfill, including resumptions.
+	Attempts int       `json:"attempts" bigquery:"attempts"`
+	Started  time.Time `json:"started" bigquery:"started"`
+	Updated  time.Time `json:"updated" bigquery:"updated"`
+}
+
+// BackfillStore keeps the checkpoints of the backfills that did not complete.
+// It is implemented by BoltStore and BigQueryStore.
+type BackfillStore interface {
+	// PutBackfill creates or replaces the checkpoint of a datatype.
+	PutBackfill(ctx context.Context, b *Backfill) error
+	// GetBackfill returns the checkpoint of a datatype, or ErrNotFound.
+	GetBackfill(ctx context.Context, datatype string) (*Backfill, error)
+	// Backfills returns all the checkpoints, sorted by datatype.
+	Backfills(ctx context.Context) ([]*Backfill, error)
+	// DeleteBackfill deletes the checkpoint of a datatype, if any.
+	DeleteBackfill(ctx context.Context, datatype string) error
+}
+
+var backfillsBucket = []byte("backfills")
+
+// PutBackfill creates or replaces the checkpoint of a datatype.
+func (s *BoltStore) PutBackfill(ctx context.Context, b *Backfill) error {
+	v, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillsBucket).Put([]byte(b.Datatype), v)
+	})
+}
+
+// GetBackfill returns the checkpoint of a datatype.
+func (s *BoltStore) GetBackfill(ctx context.Context, datatype string) (*Backfill, error) {
+	var b *Backfill
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(backfillsBucket).Get([]byte(datatype))
+		if v == nil {
+			return ErrNotFound
+		}
+		b = &Backfill{}
+		return json.Unmarshal(v, b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Backfills returns all the checkpoints, sorted by datatype.
+func (s *BoltStore) Backfills(ctx context.Context) ([]*Backfill, error) {
+	backfills := make([]*Backfill, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillsBucket).ForEach(func(_, v []byte) error {
+			b := &Backfill{}
+			if err := json.Unmarshal(v, b); err != nil {
+				return err
+			}
+			backfills = append(backfills, b)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backfills, nil
+}
+
+// DeleteBackfill deletes the checkpoint of a datatype.
+func (s *BoltStore) DeleteBackfill(ctx context.Context, datatype string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillsBucket).Delete([]byte(datatype))
+	})
+}
+
+// PutBackfill inserts the checkpoint of a datatype, which replaces the
+// previous ones.
+func (s *BigQueryStore) PutBackfill(ctx context.Context, b *Backfill) error {
+	return s.backfills.Uploader().Put(ctx, b)
+}
+
+// GetBackfill returns the latest checkpoint of a datatype.
+func (s *BigQueryStore) GetBackfill(ctx context.Context, datatype string) (*Backfill, error) {
+	backfills, err := s.queryBackfills(ctx, "WHERE `datatype` = @datatype ORDER BY `updated` DESC LIMIT 1", datatype)
+	if err != nil {
+		return nil, err
+	}
+	if len(backfills) == 0 {
+		return nil, ErrNotFound
+	}
+	return backfills[0], nil
+}
+
+// Backfills returns the latest checkpoint of each datatype, sorted by
+// datatype.
+func (s *BigQueryStore) Backfills(ctx context.Context) ([]*Backfill, error) {
+	return s.queryBackfills(ctx, "WHERE TRUE"+
+		" QUALIFY ROW_NUMBER() OVER (PARTITION BY `datatype` ORDER BY `updated` DESC) = 1"+
+		" ORDER BY `datatype`", "")
+}
+
+// DeleteBackfill inserts a row marking the checkpoint of a datatype as
+// deleted, since streamed rows cannot be deleted right away.
+func (s *BigQueryStore) DeleteBackfill(ctx context.Context, datatype string) error {
+	return s.backfills.Uploader().Put(ctx, &Backfill{
+		Datatype: datatype,
+		Status:   backfillDeleted,
+		Updated:  time.Now().UTC(),
+	})
+}
+
+// queryBackfills returns the checkpoints selected by the clauses following
+// FROM, skipping the deleted ones.
+func (s *BigQueryStore) queryBackfills(ctx context.Context, clauses, datatype string) ([]*Backfill, error) {
+	rows, err := s.read(ctx, s.backfills, Backfill{}, clauses, datatype, "")
+	if err != nil {
+		return nil, err
+	}
+	backfills := make([]*Backfill, 0, len(rows))
+	for _, row := range rows {
+		if b := backfillFromRow(row); b.Status != backfillDeleted {
+			backfills = append(backfills, b)
+		}
+	}
+	return backfills, nil
+}
+
+func backfillFromRow(row map[string]bigquery.Value) *Backfill {
+	str := func(k string) string { s, _ := row[k].(string); return s }
+	num := func(k string) int { n, _ := row[k].(int64); return int(n) }
+	ts := func(k string) time.Time { t, _ := row[k].(time.Time); return t }
+	return &Backfill{
+		Datatype:     str("datatype"),
+		Experiment:   str("experiment"),
+		Name:         str("name"),
+		Organization: str("organization"),
+		RunID:        str("run_id"),
+		Start:        str("start"),
+		Next:         str("next"),
+		Loaded:       num("loaded"),
+		Status:       str("status"),
+		Error:        str("error"),
+		Attempts:     num("attempts"),
+		Started:      ts("started"),
+		Updated:      ts("updated"),
+	}
+}
@@ -0,0 +1,66 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBoltStore_Backfills(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	ctx := context.Background()
+	started := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	a := &Backfill{Datatype: "b/o/ndt/ndt7", Start: "0000/00/00", Next: "2020/01/01", Status: BackfillFailed, Started: started}
+	b := &Backfill{Datatype: "b/o/ndt/annotation2", Start: "0000/00/00", Next: "2019/01/01", Status: BackfillRunning, Started: started}
+
+	if _, err := s.GetBackfill(ctx, a.Datatype); !errors.Is(err, ErrNotFound) {
+		t.Errorf("BoltStore.GetBackfill() error = %v, want %v", err, ErrNotFound)
+	}
+	for _, bf := range []*Backfill{a, b} {
+		if err := s.PutBackfill(ctx, bf); err != nil {
+			t.Fatalf("BoltStore.PutBackfill() error = %v", err)
+		}
+	}
+
+	// Checkpoints are replaced and persist across reopens.
+	a.Next, a.Loaded = "2021/01/01", 366
+	if err := s.PutBackfill(ctx, a); err != nil {
+		t.Fatalf("BoltStore.PutBackfill() error = %v", err)
+	}
+	s.Close()
+	s, err = OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer s.Close()
+
+	got, err := s.GetBackfill(ctx, a.Datatype)
+	if err != nil {
+		t.Fatalf("BoltStore.GetBackfill() error = %v", err)
+	}
+	if diff := cmp.Diff(got, a); diff != "" {
+		t.Errorf("BoltStore.GetBackfill() diff (-got +want):\n%s", diff)
+	}
+	all, err := s.Backfills(ctx)
+	if err != nil {
+		t.Fatalf("BoltStore.Backfills() error = %v", err)
+	}
+	if diff := cmp.Diff(all, []*Backfill{b, a}); diff != "" {
+		t.Errorf("BoltStore.Backfills() diff (-got +want):\n%s", diff)
+	}
+
+	if err := s.DeleteBackfill(ctx, a.Datatype); err != nil {
+		t.Fatalf("BoltStore.DeleteBackfill() error = %v", err)
+	}
+	if _, err := s.GetBackfill(ctx, a.Datatype); !errors.Is(err, ErrNotFound) {
+		t.Errorf("BoltStore.GetBackfill() error = %v, want %v", err, ErrNotFound)
+	}
+}
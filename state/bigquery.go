@@ -0,0 +1,226 @@
+package state
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"google.golang.org/api/iterator"
+)
+
+// BigQueryStore is a Store backed by a BigQuery metadata table, with a row
+// per load attempt. It is also a BackfillStore, with a row per update of a
+// checkpoint in a second table.
+type BigQueryStore struct {
+	client    bqiface.Client
+	table     bqiface.Table
+	backfills bqiface.Table
+}
+
+// NewBigQueryStore returns a store using the tables of loads and backfill
+// checkpoints, queried with the client.
+func NewBigQueryStore(c bqiface.Client, loads, backfills bqiface.Table) *BigQueryStore {
+	return &BigQueryStore{client: c, table: loads, backfills: backfills}
+}
+
+// CreateTable creates the store's tables if they do not exist. The table of
+// loads is partitioned by the attempt's finish time. Otherwise, it adds the
+// columns of fields added to Load or Backfill since the tables were created.
+func (s *BigQueryStore) CreateTable(ctx context.Context) error {
+	err := createTable(ctx, s.table, Load{}, &bigquery.TimePartitioning{
+		Type:  bigquery.DayPartitioningType,
+		Field: "finished",
+	})
+	if err != nil {
+		return err
+	}
+	return createTable(ctx, s.backfills, Backfill{}, nil)
+}
+
+// createTable creates a table with the schema of the row, or adds the
+// missing columns to an existing one.
+func createTable(ctx context.Context, t bqiface.Table, row any, tp *bigquery.TimePartitioning) error {
+	schema, err := bigquery.InferSchema(row)
+	if err != nil {
+		return err
+	}
+	if md, err := t.Metadata(ctx); err == nil {
+		return addColumns(ctx, t, md, schema)
+	}
+	return t.Create(ctx, &bigquery.TableMetadata{
+		Name:             t.TableID(),
+		Schema:           schema,
+		TimePartitioning: tp,
+	})
+}
+
+// addColumns adds the fields of the schema missing from the table, as
+// NULLABLE or REPEATED columns (BigQuery cannot add REQUIRED columns).
+func addColumns(ctx context.Context, t bqiface.Table, md *bigquery.TableMetadata, schema bigquery.Schema) error {
+	existing := make(map[string]bool, len(md.Schema))
+	for _, f := range md.Schema {
+		existing[f.Name] = true
+	}
+	updated := append(bigquery.Schema{}, md.Schema...)
+	for _, f := range schema {
+		if !existing[f.Name] {
+			added := *f
+			added.Required = false
+			updated = append(updated, &added)
+		}
+	}
+	if len(updated) == len(md.Schema) {
+		return nil
+	}
+	_, err := t.Update(ctx, bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag)
+	return err
+}
+
+// Put inserts the load attempt into the table.
+func (s *BigQueryStore) Put(ctx context.Context, l *Load) error {
+	return s.table.Uploader().Put(ctx, l)
+}
+
+// Latest returns the most recent load attempt of a partition.
+func (s *BigQueryStore) Latest(ctx context.Context, datatype, partition string) (*Load, error) {
+	loads, err := s.query(ctx, "WHERE `datatype` = @datatype AND `partition` = @partition"+
+		" ORDER BY `finished` DESC LIMIT 1", datatype, partition)
+	if err != nil {
+		return nil, err
+	}
+	if len(loads) == 0 {
+		return nil, ErrNotFound
+	}
+	return loads[0], nil
+}
+
+// Partitions returns the most recent load attempt of each partition of a
+// datatype, sorted by partition.
+func (s *BigQueryStore) Partitions(ctx context.Context, datatype string) ([]*Load, error) {
+	return s.query(ctx, "WHERE `datatype` = @datatype"+
+		" QUALIFY ROW_NUMBER() OVER (PARTITION BY `partition` ORDER BY `finished` DESC) = 1"+
+		" ORDER BY `partition`", datatype, "")
+}
+
+// History returns the load attempts of a partition, oldest first.
+func (s *BigQueryStore) History(ctx context.Context, datatype, partition string) ([]*Load, error) {
+	return s.query(ctx, "WHERE `datatype` = @datatype AND `partition` = @partition"+
+		" ORDER BY `finished`", datatype, partition)
+}
+
+// LoadedFiles returns the files loaded by every successful load of a
+// partition, sorted. The table keeps every attempt, so they are those of its
+// history.
+func (s *BigQueryStore) LoadedFiles(ctx context.Context, datatype, partition string) ([]string, error) {
+	loads, err := s.History(ctx, datatype, partition)
+	if err != nil {
+		return nil, err
+	}
+	return loadedFiles(loads), nil
+}
+
+// Close does nothing. The client is owned by the caller.
+func (s *BigQueryStore) Close() error {
+	return nil
+}
+
+// query returns the loads selected by the clauses following FROM.
+func (s *BigQueryStore) query(ctx context.Context, clauses, datatype, partition string) ([]*Load, error) {
+	rows, err := s.read(ctx, s.table, Load{}, clauses, datatype, partition)
+	if err != nil {
+		return nil, err
+	}
+	loads := make([]*Load, 0, len(rows))
+	for _, row := range rows {
+		loads = append(loads, loadFromRow(row))
+	}
+	return loads, nil
+}
+
+// read returns the rows of the table selected by the clauses following FROM,
+// with the columns of the row type. Column names must be quoted, since some
+// of them (e.g., partition and rows) are reserved keywords.
+func (s *BigQueryStore) read(ctx context.Context, t bqiface.Table, row any, clauses, datatype, partition string) ([]map[string]bigquery.Value, error) {
+	columns, err := quotedColumns(row)
+	if err != nil {
+		return nil, err
+	}
+	// GoogleSQL table names are project.dataset.table.
+	table := strings.Replace(t.FullyQualifiedName(), ":", ".", 1)
+	q := "SELECT " + columns + " FROM `" + table + "` " + clauses
+	query := s.client.Query(q)
+	query.SetQueryConfig(bqiface.QueryConfig{
+		QueryConfig: bigquery.QueryConfig{
+			Q: q,
+			Parameters: []bigquery.QueryParameter{
+				{Name: "datatype", Value: datatype},
+				{Name: "partition", Value: partition},
+			},
+		},
+	})
+	it, err := query.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]bigquery.Value, 0)
+	for {
+		var row map[string]bigquery.Value
+		err := it.Next(&row)
+		if err == iterator.Done {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// quotedColumns returns the quoted, comma-separated columns of the schema of
+// the row type.
+func quotedColumns(row any) (string, error) {
+	schema, err := bigquery.InferSchema(row)
+	if err != nil {
+		return "", err
+	}
+	columns := make([]string, 0, len(schema))
+	for _, f := range schema {
+		columns = append(columns, "`"+f.Name+"`")
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+func loadFromRow(row map[string]bigquery.Value) *Load {
+	str := func(k string) string { s, _ := row[k].(string); return s }
+	num := func(k string) int64 { n, _ := row[k].(int64); return n }
+	ts := func(k string) time.Time { t, _ := row[k].(time.Time); return t }
+	var files []string
+	values, _ := row["files"].([]bigquery.Value)
+	for _, v := range values {
+		if f, ok := v.(string); ok {
+			files = append(files, f)
+		}
+	}
+	return &Load{
+		Datatype:    str("datatype"),
+		Dataset:     str("dataset"),
+		Table:       str("table"),
+		Partition:   str("partition"),
+		Source:      str("source"),
+		Fingerprint: str("fingerprint"),
+		Files:       files,
+		RunID:       str("run_id"),
+		JobID:       str("job_id"),
+		Status:      str("status"),
+		Error:       str("error"),
+		Rows:        num("rows"),
+		BadRecords:  num("bad_records"),
+		InputFiles:  num("input_files"),
+		InputBytes:  num("input_bytes"),
+		Started:     ts("started"),
+		Finished:    ts("finished"),
+	}
+}
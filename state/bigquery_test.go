@@ -0,0 +1,316 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/bigquery/bqiface"
+	"github.com/m-lab/go/cloudtest/bqfake"
+)
+
+type fakeUploader struct {
+	bqiface.Uploader
+	rows []any
+}
+
+func (u *fakeUploader) Put(ctx context.Context, src interface{}) error {
+	u.rows = append(u.rows, src)
+	return nil
+}
+
+type fakeTable struct {
+	bqiface.Table
+	md       *bigquery.TableMetadata
+	created  *bigquery.TableMetadata
+	updated  *bigquery.TableMetadataToUpdate
+	uploader *fakeUploader
+	id       string // Defaults to loads.
+}
+
+func (t *fakeTable) Update(ctx context.Context, md bigquery.TableMetadataToUpdate, etag string) (*bigquery.TableMetadata, error) {
+	t.updated = &md
+	return t.md, nil
+}
+
+func (t *fakeTable) Metadata(ctx context.Context) (*bigquery.TableMetadata, error) {
+	if t.md == nil {
+		return nil, errors.New("not found")
+	}
+	return t.md, nil
+}
+
+func (t *fakeTable) Create(ctx context.Context, md *bigquery.TableMetadata) error {
+	t.created = md
+	return nil
+}
+
+func (t *fakeTable) TableID() string {
+	if t.id == "" {
+		return "loads"
+	}
+	return t.id
+}
+
+func (t *fakeTable) FullyQualifiedName() string {
+	return "project:autoloader." + t.TableID()
+}
+
+func (t *fakeTable) Uploader() bqiface.Uploader {
+	return t.uploader
+}
+
+func TestBigQueryStore_Put(t *testing.T) {
+	table := &fakeTable{uploader: &fakeUploader{}}
+	backfills := &fakeTable{id: "backfills"}
+	s := NewBigQueryStore(nil, table, backfills)
+	ctx := context.Background()
+
+	if err := s.CreateTable(ctx); err != nil {
+		t.Fatalf("BigQueryStore.CreateTable() error = %v", err)
+	}
+	if table.created == nil || table.created.TimePartitioning.Field != "finished" {
+		t.Errorf("BigQueryStore.CreateTable() created = %v, want partitioned table", table.created)
+	}
+	if backfills.created == nil || backfills.created.Name != "backfills" {
+		t.Errorf("BigQueryStore.CreateTable() created = %v, want backfills table", backfills.created)
+	}
+
+	l := &Load{Datatype: "dt", Partition: "20230601"}
+	if err := s.Put(ctx, l); err != nil {
+		t.Fatalf("BigQueryStore.Put() error = %v", err)
+	}
+	if len(table.uploader.rows) != 1 || table.uploader.rows[0] != l {
+		t.Errorf("BigQueryStore.Put() rows = %v, want %v", table.uploader.rows, l)
+	}
+}
+
+func TestBigQueryStore_CreateTableAddsColumns(t *testing.T) {
+	schema, err := bigquery.InferSchema(Load{})
+	if err != nil {
+		t.Fatalf("InferSchema() error = %v", err)
+	}
+	var old bigquery.Schema
+	for _, f := range schema {
+		if f.Name != "files" && f.Name != "run_id" {
+			old = append(old, f)
+		}
+	}
+	tests := []struct {
+		name  string
+		md    *bigquery.TableMetadata
+		added []string
+	}{
+		{name: "current", md: &bigquery.TableMetadata{Schema: schema}},
+		{name: "old", md: &bigquery.TableMetadata{Schema: old}, added: []string{"files", "run_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &fakeTable{md: tt.md}
+			if err := NewBigQueryStore(nil, table, &fakeTable{id: "backfills"}).CreateTable(context.Background()); err != nil {
+				t.Fatalf("BigQueryStore.CreateTable() error = %v", err)
+			}
+			if table.created != nil {
+				t.Errorf("BigQueryStore.CreateTable() created existing table")
+			}
+			if (table.updated != nil) != (len(tt.added) != 0) {
+				t.Fatalf("BigQueryStore.CreateTable() updated = %v, want added %v", table.updated, tt.added)
+			}
+			if table.updated == nil {
+				return
+			}
+			var added []string
+			for _, f := range table.updated.Schema[len(old):] {
+				added = append(added, f.Name)
+				if f.Required {
+					t.Errorf("BigQueryStore.CreateTable() added required column %s", f.Name)
+				}
+			}
+			if diff := cmp.Diff(added, tt.added); diff != "" {
+				t.Errorf("BigQueryStore.CreateTable() added columns mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBigQueryStore_Latest(t *testing.T) {
+	finished := time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		config  bqfake.QueryConfig
+		want    *Load
+		wantErr error
+	}{
+		{
+			name: "found",
+			config: bqfake.QueryConfig{
+				RowIteratorConfig: bqfake.RowIteratorConfig{
+					Rows: []map[string]bigquery.Value{{
+						"datatype": "dt", "partition": "20230601", "status": StatusOK,
+						"rows": int64(10), "job_id": "job", "finished": finished,
+						"files": []bigquery.Value{"gs://bucket/a.json"},
+					}},
+				},
+			},
+			want: &Load{Datatype: "dt", Partition: "20230601", Status: StatusOK, Rows: 10, JobID: "job", Finished: finished,
+				Files: []string{"gs://bucket/a.json"}},
+		},
+		{
+			name:    "not-found",
+			config:  bqfake.QueryConfig{},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "read-error",
+			config:  bqfake.QueryConfig{ReadErr: errors.New("read failed")},
+			wantErr: errors.New("read failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewBigQueryStore(bqfake.NewQueryReadClient(tt.config), &fakeTable{}, &fakeTable{id: "backfills"})
+			got, err := s.Latest(context.Background(), "dt", "20230601")
+			if (err != nil) != (tt.wantErr != nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Errorf("BigQueryStore.Latest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("BigQueryStore.Latest() diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBigQueryStore_Partitions(t *testing.T) {
+	config := bqfake.QueryConfig{
+		RowIteratorConfig: bqfake.RowIteratorConfig{
+			Rows: []map[string]bigquery.Value{
+				{"datatype": "dt", "partition": "20230601", "status": StatusOK},
+				{"datatype": "dt", "partition": "20230602", "status": StatusError, "error": "failed"},
+			},
+		},
+	}
+	s := NewBigQueryStore(bqfake.NewQueryReadClient(config), &fakeTable{}, &fakeTable{id: "backfills"})
+	want := []*Load{
+		{Datatype: "dt", Partition: "20230601", Status: StatusOK},
+		{Datatype: "dt", Partition: "20230602", Status: StatusError, Error: "failed"},
+	}
+
+	got, err := s.Partitions(context.Background(), "dt")
+	if err != nil {
+		t.Fatalf("BigQueryStore.Partitions() error = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("BigQueryStore.Partitions() diff (-got +want):\n%s", diff)
+	}
+
+	s = NewBigQueryStore(bqfake.NewQueryReadClient(config), &fakeTable{}, &fakeTable{id: "backfills"})
+	got, err = s.History(context.Background(), "dt", "20230601")
+	if err != nil {
+		t.Fatalf("BigQueryStore.History() error = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("BigQueryStore.History() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestBigQueryStore_LoadedFiles(t *testing.T) {
+	config := bqfake.QueryConfig{
+		RowIteratorConfig: bqfake.RowIteratorConfig{
+			Rows: []map[string]bigquery.Value{
+				{"datatype": "dt", "partition": "20230601", "status": StatusOK, "files": []bigquery.Value{"gs://b/b", "gs://b/a"}},
+				{"datatype": "dt", "partition": "20230601", "status": StatusError, "files": []bigquery.Value{"gs://b/c"}},
+				{"datatype": "dt", "partition": "20230601", "status": StatusOK, "files": []bigquery.Value{"gs://b/a", "gs://b/d"}},
+			},
+		},
+	}
+	s := NewBigQueryStore(bqfake.NewQueryReadClient(config), &fakeTable{}, &fakeTable{id: "backfills"})
+
+	got, err := s.LoadedFiles(context.Background(), "dt", "20230601")
+	if err != nil {
+		t.Fatalf("BigQueryStore.LoadedFiles() error = %v", err)
+	}
+	if diff := cmp.Diff(got, []string{"gs://b/a", "gs://b/b", "gs://b/d"}); diff != "" {
+		t.Errorf("BigQueryStore.LoadedFiles() diff (-got +want):\n%s", diff)
+	}
+}
+
+// queryClient records the text of the queries it runs.
+type queryClient struct {
+	bqiface.Client
+	queries []string
+}
+
+func (c *queryClient) Query(q string) bqiface.Query {
+	c.queries = append(c.queries, q)
+	return c.Client.Query(q)
+}
+
+func TestBigQueryStore_queries(t *testing.T) {
+	c := &queryClient{Client: bqfake.NewQueryReadClient(bqfake.QueryConfig{})}
+	s := NewBigQueryStore(c, &fakeTable{}, &fakeTable{id: "backfills"})
+	ctx := context.Background()
+	s.Latest(ctx, "dt", "20230601")
+	s.Partitions(ctx, "dt")
+	s.History(ctx, "dt", "20230601")
+	s.GetBackfill(ctx, "dt")
+	s.Backfills(ctx)
+
+	columns := "SELECT `datatype`, `dataset`, `table`, `partition`, `source`, `fingerprint`, `files`, `run_id`, `job_id`," +
+		" `status`, `error`, `rows`, `bad_records`, `input_files`, `input_bytes`, `started`, `finished`" +
+		" FROM `project.autoloader.loads` "
+	backfills := "SELECT `datatype`, `experiment`, `name`, `organization`, `run_id`, `start`, `next`, `loaded`," +
+		" `status`, `error`, `attempts`, `started`, `updated` FROM `project.autoloader.backfills` "
+	want := []string{
+		columns + "WHERE `datatype` = @datatype AND `partition` = @partition ORDER BY `finished` DESC LIMIT 1",
+		columns + "WHERE `datatype` = @datatype" +
+			" QUALIFY ROW_NUMBER() OVER (PARTITION BY `partition` ORDER BY `finished` DESC) = 1 ORDER BY `partition`",
+		columns + "WHERE `datatype` = @datatype AND `partition` = @partition ORDER BY `finished`",
+		backfills + "WHERE `datatype` = @datatype ORDER BY `updated` DESC LIMIT 1",
+		backfills + "WHERE TRUE" +
+			" QUALIFY ROW_NUMBER() OVER (PARTITION BY `datatype` ORDER BY `updated` DESC) = 1 ORDER BY `datatype`",
+	}
+	if diff := cmp.Diff(c.queries, want); diff != "" {
+		t.Errorf("BigQueryStore queries diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestBigQueryStore_Backfills(t *testing.T) {
+	updated := time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)
+	config := bqfake.QueryConfig{
+		RowIteratorConfig: bqfake.RowIteratorConfig{
+			Rows: []map[string]bigquery.Value{
+				{"datatype": "a", "next": "2023/06/02", "loaded": int64(2), "status": BackfillFailed,
+					"attempts": int64(1), "updated": updated},
+				{"datatype": "b", "status": backfillDeleted},
+			},
+		},
+	}
+	backfills := &fakeTable{id: "backfills", uploader: &fakeUploader{}}
+	s := NewBigQueryStore(bqfake.NewQueryReadClient(config), &fakeTable{}, backfills)
+	ctx := context.Background()
+
+	got, err := s.Backfills(ctx)
+	if err != nil {
+		t.Fatalf("BigQueryStore.Backfills() error = %v", err)
+	}
+	want := []*Backfill{{Datatype: "a", Next: "2023/06/02", Loaded: 2, Status: BackfillFailed, Attempts: 1, Updated: updated}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("BigQueryStore.Backfills() diff (-got +want):\n%s", diff)
+	}
+
+	// The latest row of a deleted checkpoint marks it deleted.
+	config.RowIteratorConfig.Rows = config.RowIteratorConfig.Rows[1:]
+	s = NewBigQueryStore(bqfake.NewQueryReadClient(config), &fakeTable{}, backfills)
+	if _, err := s.GetBackfill(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("BigQueryStore.GetBackfill() error = %v, want %v", err, ErrNotFound)
+	}
+	if err := s.DeleteBackfill(ctx, "a"); err != nil {
+		t.Fatalf("BigQueryStore.DeleteBackfill() error = %v", err)
+	}
+	if len(backfills.uploader.rows) != 1 || backfills.uploader.rows[0].(*Backfill).Status != backfillDeleted {
+		t.Errorf("BigQueryStore.DeleteBackfill() rows = %v, want deleted checkpoint", backfills.uploader.rows)
+	}
+}
@@ -0,0 +1,233 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxHistory is the number of load attempts kept for each partition.
+const maxHistory = 50
+
+var (
+	loadsBucket = []byte("loads")
+	filesBucket = []byte("files")
+)
+
+// BoltStore is a Store backed by a local BoltDB file. Loads are kept in a
+// bucket per datatype and a nested bucket per partition, keyed by sequence.
+// The files of successful loads are also kept, without limit, in a separate
+// bucket per datatype and partition, keyed by file URI.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the BoltDB file at path, creating it if needed.
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{loadsBucket, filesBucket, backfillsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Put records a load attempt, dropping the oldest attempts of the partition
+// beyond maxHistory.
+func (s *BoltStore) Put(ctx context.Context, l *Load) error {
+	v, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		dt, err := tx.Bucket(loadsBucket).CreateBucketIfNotExists([]byte(l.Datatype))
+		if err != nil {
+			return err
+		}
+		p, err := dt.CreateBucketIfNotExists([]byte(l.Partition))
+		if err != nil {
+			return err
+		}
+		seq, err := p.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := p.Put(seqKey(seq), v); err != nil {
+			return err
+		}
+		if err := putFiles(tx, l); err != nil {
+			return err
+		}
+		if seq <= maxHistory {
+			return nil
+		}
+		old := make([][]byte, 0)
+		c := p.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= seq-maxHistory; k, _ = c.Next() {
+			old = append(old, k)
+		}
+		for _, k := range old {
+			if err := p.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Latest returns the most recent load attempt of a partition.
+func (s *BoltStore) Latest(ctx context.Context, datatype, partition string) (*Load, error) {
+	var l *Load
+	err := s.db.View(func(tx *bolt.Tx) error {
+		p := s.partition(tx, datatype, partition)
+		if p == nil {
+			return ErrNotFound
+		}
+		_, v := p.Cursor().Last()
+		if v == nil {
+			return ErrNotFound
+		}
+		l = &Load{}
+		return json.Unmarshal(v, l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Partitions returns the most recent load attempt of each partition of a
+// datatype, sorted by partition.
+func (s *BoltStore) Partitions(ctx context.Context, datatype string) ([]*Load, error) {
+	loads := make([]*Load, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		dt := tx.Bucket(loadsBucket).Bucket([]byte(datatype))
+		if dt == nil {
+			return nil
+		}
+		// Partition IDs (YYYYMMDD) sort in date order.
+		return dt.ForEach(func(k, _ []byte) error {
+			_, v := dt.Bucket(k).Cursor().Last()
+			if v == nil {
+				return nil
+			}
+			l := &Load{}
+			if err := json.Unmarshal(v, l); err != nil {
+				return err
+			}
+			loads = append(loads, l)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loads, nil
+}
+
+// History returns the load attempts of a partition, oldest first.
+func (s *BoltStore) History(ctx context.Context, datatype, partition string) ([]*Load, error) {
+	loads := make([]*Load, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		p := s.partition(tx, datatype, partition)
+		if p == nil {
+			return nil
+		}
+		return p.ForEach(func(_, v []byte) error {
+			l := &Load{}
+			if err := json.Unmarshal(v, l); err != nil {
+				return err
+			}
+			loads = append(loads, l)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loads, nil
+}
+
+// LoadedFiles returns the files loaded by every successful load of a
+// partition, including the loads dropped from its history, sorted.
+func (s *BoltStore) LoadedFiles(ctx context.Context, datatype, partition string) ([]string, error) {
+	// Loads recorded before the files were kept separately are only in the
+	// history.
+	loads, err := s.History(ctx, datatype, partition)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		dt := tx.Bucket(filesBucket).Bucket([]byte(datatype))
+		if dt == nil {
+			return nil
+		}
+		p := dt.Bucket([]byte(partition))
+		if p == nil {
+			return nil
+		}
+		return p.ForEach(func(k, _ []byte) error {
+			kept = append(kept, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loadedFiles(loads, kept...), nil
+}
+
+// putFiles keeps the files of a successful load.
+func putFiles(tx *bolt.Tx, l *Load) error {
+	if l.Status != StatusOK || len(l.Files) == 0 {
+		return nil
+	}
+	dt, err := tx.Bucket(filesBucket).CreateBucketIfNotExists([]byte(l.Datatype))
+	if err != nil {
+		return err
+	}
+	p, err := dt.CreateBucketIfNotExists([]byte(l.Partition))
+	if err != nil {
+		return err
+	}
+	for _, f := range l.Files {
+		if err := p.Put([]byte(f), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) partition(tx *bolt.Tx, datatype, partition string) *bolt.Bucket {
+	dt := tx.Bucket(loadsBucket).Bucket([]byte(datatype))
+	if dt == nil {
+		return nil
+	}
+	return dt.Bucket([]byte(partition))
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
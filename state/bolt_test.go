@@ -0,0 +1,118 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	ctx := context.Background()
+	finished := time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)
+	loads := []*Load{
+		{Datatype: "b/o/ndt/ndt7", Partition: "20230602", Status: StatusError, Error: "failed", Finished: finished},
+		{Datatype: "b/o/ndt/ndt7", Partition: "20230601", Status: StatusOK, Rows: 10, JobID: "job-1", Finished: finished},
+		{Datatype: "b/o/ndt/ndt7", Partition: "20230602", Status: StatusOK, Rows: 20, JobID: "job-2", Fingerprint: "f", Finished: finished.Add(time.Hour)},
+		{Datatype: "b/o/ndt/tcpinfo", Partition: "20230601", Status: StatusOK, Rows: 5, Finished: finished},
+	}
+	for _, l := range loads {
+		if err := s.Put(ctx, l); err != nil {
+			t.Fatalf("BoltStore.Put() error = %v", err)
+		}
+	}
+
+	got, err := s.Latest(ctx, "b/o/ndt/ndt7", "20230602")
+	if err != nil {
+		t.Fatalf("BoltStore.Latest() error = %v", err)
+	}
+	if diff := cmp.Diff(got, loads[2]); diff != "" {
+		t.Errorf("BoltStore.Latest() diff (-got +want):\n%s", diff)
+	}
+	if _, err := s.Latest(ctx, "b/o/ndt/ndt7", "20230603"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("BoltStore.Latest() error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.Latest(ctx, "unknown", "20230601"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("BoltStore.Latest() error = %v, want %v", err, ErrNotFound)
+	}
+
+	parts, err := s.Partitions(ctx, "b/o/ndt/ndt7")
+	if err != nil {
+		t.Fatalf("BoltStore.Partitions() error = %v", err)
+	}
+	if diff := cmp.Diff(parts, []*Load{loads[1], loads[2]}); diff != "" {
+		t.Errorf("BoltStore.Partitions() diff (-got +want):\n%s", diff)
+	}
+	if parts, _ := s.Partitions(ctx, "unknown"); len(parts) != 0 {
+		t.Errorf("BoltStore.Partitions() = %v, want none", parts)
+	}
+
+	history, err := s.History(ctx, "b/o/ndt/ndt7", "20230602")
+	if err != nil {
+		t.Fatalf("BoltStore.History() error = %v", err)
+	}
+	if diff := cmp.Diff(history, []*Load{loads[0], loads[2]}); diff != "" {
+		t.Errorf("BoltStore.History() diff (-got +want):\n%s", diff)
+	}
+
+	// The history persists across reopens.
+	if err := s.Close(); err != nil {
+		t.Fatalf("BoltStore.Close() error = %v", err)
+	}
+	s, err = OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer s.Close()
+	if got, err := s.Latest(ctx, "b/o/ndt/tcpinfo", "20230601"); err != nil || got.Rows != 5 {
+		t.Errorf("BoltStore.Latest() = %v, %v, want 5 rows", got, err)
+	}
+}
+
+func TestBoltStore_MaxHistory(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	// The files of successful loads outlive their history.
+	loaded := &Load{Datatype: "dt", Partition: "20230601", Status: StatusOK, Files: []string{"gs://b/a", "gs://b/b"}}
+	if err := s.Put(ctx, loaded); err != nil {
+		t.Fatalf("BoltStore.Put() error = %v", err)
+	}
+	for i := 0; i < maxHistory+10; i++ {
+		if err := s.Put(ctx, &Load{Datatype: "dt", Partition: "20230601", JobID: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("BoltStore.Put() error = %v", err)
+		}
+	}
+	history, err := s.History(ctx, "dt", "20230601")
+	if err != nil {
+		t.Fatalf("BoltStore.History() error = %v", err)
+	}
+	if len(history) != maxHistory || history[0].JobID != "10" || history[maxHistory-1].JobID != fmt.Sprint(maxHistory+9) {
+		t.Errorf("BoltStore.History() = %d loads from %s, want %d from 10", len(history), history[0].JobID, maxHistory)
+	}
+	files, err := s.LoadedFiles(ctx, "dt", "20230601")
+	if err != nil {
+		t.Fatalf("BoltStore.LoadedFiles() error = %v", err)
+	}
+	if diff := cmp.Diff(files, loaded.Files); diff != "" {
+		t.Errorf("BoltStore.LoadedFiles() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestOpenBolt_Error(t *testing.T) {
+	if _, err := OpenBolt(filepath.Join(t.TempDir(), "missing", "state.db")); err == nil {
+		t.Errorf("OpenBolt() error = nil, want error")
+	}
+}
@@ -0,0 +1,90 @@
+// Package state records the load history of each table partition: which
+// source was loaded, when, by which job and with what outcome. It lets the
+// autoloader know what it loaded without re-deriving it from GCS listings and
+// table metadata.
+package state
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Load statuses.
+const (
+	StatusOK    = "OK"
+	StatusError = "error"
+)
+
+// ErrNotFound is returned when no load was recorded for a partition.
+var ErrNotFound = errors.New("no load recorded")
+
+// Load describes an attempt to load a partition.
+type Load struct {
+	Datatype  string `json:"datatype" bigquery:"datatype"` // Datatype ID (see api.Datatype.ID).
+	Dataset   string `json:"dataset" bigquery:"dataset"`
+	Table     string `json:"table" bigquery:"table"`
+	Partition string `json:"partition" bigquery:"partition"` // YYYYMMDD.
+
+	// Source is the GCS URI of the loaded directory, and Fingerprint
+	// identifies its contents (see gcs.Dir).
+	Source      string `json:"source" bigquery:"source"`
+	Fingerprint string `json:"fingerprint" bigquery:"fingerprint"`
+	// Files are the URIs of the loaded objects.
+	Files []string `json:"files,omitempty" bigquery:"files"`
+
+	RunID      string    `json:"run_id,omitempty" bigquery:"run_id"`
+	JobID      string    `json:"job_id,omitempty" bigquery:"job_id"`
+	Status     string    `json:"status" bigquery:"status"`
+	Error      string    `json:"error,omitempty" bigquery:"error"`
+	Rows       int64     `json:"rows" bigquery:"rows"`
+	BadRecords int64     `json:"bad_records" bigquery:"bad_records"`
+	InputFiles int64     `json:"input_files" bigquery:"input_files"`
+	InputBytes int64     `json:"input_bytes" bigquery:"input_bytes"`
+	Started    time.Time `json:"started" bigquery:"started"`
+	Finished   time.Time `json:"finished" bigquery:"finished"`
+}
+
+// Store keeps the load history of partitions.
+type Store interface {
+	// Put records a load attempt.
+	Put(ctx context.Context, l *Load) error
+	// Latest returns the most recent load attempt of a partition, or
+	// ErrNotFound.
+	Latest(ctx context.Context, datatype, partition string) (*Load, error)
+	// Partitions returns the most recent load attempt of each partition of a
+	// datatype, sorted by partition.
+	Partitions(ctx context.Context, datatype string) ([]*Load, error)
+	// History returns the load attempts of a partition, oldest first. Stores
+	// may drop the oldest attempts.
+	History(ctx context.Context, datatype, partition string) ([]*Load, error)
+	// LoadedFiles returns the files loaded by every successful load of a
+	// partition, including the loads dropped from its history, sorted.
+	LoadedFiles(ctx context.Context, datatype, partition string) ([]string, error)
+	// Close releases the store's resources.
+	Close() error
+}
+
+// loadedFiles returns the sorted files of the successful loads, without
+// duplicates, along with the files of extra.
+func loadedFiles(loads []*Load, extra ...string) []string {
+	set := make(map[string]bool)
+	for _, f := range extra {
+		set[f] = true
+	}
+	for _, l := range loads {
+		if l.Status != StatusOK {
+			continue
+		}
+		for _, f := range l.Files {
+			set[f] = true
+		}
+	}
+	files := make([]string, 0, len(set))
+	for f := range set {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
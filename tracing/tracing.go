@@ -0,0 +1,140 @@
+// Package tracing configures OpenTelemetry tracing for the autoloader.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/m-lab/autoloader/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/m-lab/autoloader"
+)
+
+// Attribute keys added to the autoloader spans.
+const (
+	Experiment   = attribute.Key("autoloader.experiment")
+	Datatype     = attribute.Key("autoloader.datatype")
+	Organization = attribute.Key("autoloader.organization")
+	Bucket       = attribute.Key("autoloader.bucket")
+	Period       = attribute.Key("autoloader.period")
+	RunID        = attribute.Key("autoloader.run_id")
+	Prefix       = attribute.Key("autoloader.gcs.prefix")
+	Dataset      = attribute.Key("autoloader.bigquery.dataset")
+	Table        = attribute.Key("autoloader.bigquery.table")
+	Partition    = attribute.Key("autoloader.bigquery.partition")
+	JobID        = attribute.Key("autoloader.bigquery.job_id")
+)
+
+// Exporters supported by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Tracer returns the tracer used to instrument the autoloader. It uses the
+// global tracer provider, so tests may install their own provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup installs a global tracer provider that exports spans using the given
+// exporter ("none", "stdout" or "otlp"), and a global propagator reading the
+// W3C trace context and baggage of incoming requests. The OTLP exporter is
+// configured using the standard OTEL_EXPORTER_OTLP_* environment variables.
+// It returns a function that flushes and shuts down the provider.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New()
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q (want %q, %q or %q)",
+			exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// End records the error (if any) in the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Handler returns a handler starting a server span for each request, as a
+// child of the trace context propagated by the caller, if any (see Setup).
+// Responses with a 5xx status mark the span as failed.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// DatatypeAttributes returns the span attributes identifying a datatype and,
+// if its naming conventions are known, its BigQuery table.
+func DatatypeAttributes(dt *api.Datatype) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		Experiment.String(dt.Experiment),
+		Datatype.String(dt.Name),
+		Organization.String(dt.Organization),
+		Bucket.String(dt.BucketName),
+	}
+	if dt.Namer == nil {
+		return attrs
+	}
+	return append(attrs, Dataset.String(dt.Dataset()), Table.String(dt.Table()))
+}
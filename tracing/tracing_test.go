@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m-lab/autoloader/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{
+			name:     "none",
+			exporter: ExporterNone,
+		},
+		{
+			name:     "empty",
+			exporter: "",
+		},
+		{
+			name:     "stdout",
+			exporter: ExporterStdout,
+		},
+		{
+			name:     "otlp",
+			exporter: ExporterOTLP,
+		},
+		{
+			name:     "invalid",
+			exporter: "invalid",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tt.exporter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("Setup() shutdown error = %v", err)
+			}
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{
+			name:       "success",
+			wantStatus: codes.Unset,
+		},
+		{
+			name:       "error",
+			err:        errors.New("fake error"),
+			wantStatus: codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			_, span := tp.Tracer("test").Start(context.Background(), "span")
+
+			End(span, tt.err)
+
+			spans := sr.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("End() ended %d spans, want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.wantStatus {
+				t.Errorf("End() status = %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	shutdown, err := Setup(context.Background(), ExporterNone)
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	defer shutdown(context.Background())
+
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus codes.Code
+	}{
+		{
+			name:       "success",
+			status:     http.StatusOK,
+			wantStatus: codes.Unset,
+		},
+		{
+			name:       "client-error",
+			status:     http.StatusBadRequest,
+			wantStatus: codes.Unset,
+		},
+		{
+			name:       "server-error",
+			status:     http.StatusInternalServerError,
+			wantStatus: codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inner trace.SpanContext
+			h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inner = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(tt.status)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/v2/datatypes", nil)
+			req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			spans := sr.Ended()
+			span := spans[len(spans)-1]
+			if span.Name() != "GET /v2/datatypes" || span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("Handler() span = %s (%v), want a server span for GET /v2/datatypes", span.Name(), span.SpanKind())
+			}
+			if got := span.Parent().TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+				t.Errorf("Handler() parent trace = %s, want the propagated trace", got)
+			}
+			if inner.SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("Handler() request context span = %v, want %v", inner.SpanID(), span.SpanContext().SpanID())
+			}
+			if got := span.Status().Code; got != tt.wantStatus {
+				t.Errorf("Handler() status = %v, want %v", got, tt.wantStatus)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("Handler() response status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestDatatypeAttributes(t *testing.T) {
+	opts := api.DatatypeOpts{
+		Name:         "datatype",
+		Experiment:   "experiment",
+		Organization: "organization",
+		BucketName:   "bucket",
+	}
+
+	tests := []struct {
+		name string
+		dt   *api.Datatype
+		want int
+	}{
+		{
+			name: "namer",
+			dt:   api.NewMlabDatatype(opts),
+			want: 6,
+		},
+		{
+			name: "no-namer",
+			dt:   &api.Datatype{DatatypeOpts: opts},
+			want: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DatatypeAttributes(tt.dt); len(got) != tt.want {
+				t.Errorf("DatatypeAttributes() = %v, want %d attributes", got, tt.want)
+			}
+		})
+	}
+}